@@ -1,4 +1,19 @@
 document.addEventListener('DOMContentLoaded', async () => {
+  // Links mailed by the server carry their token in the query string.
+  const params = new URLSearchParams(window.location.search);
+  const resetToken = params.get('reset_token');
+  const verifyToken = params.get('verify_token');
+  if (resetToken || verifyToken) {
+    history.replaceState(null, '', window.location.pathname);
+  }
+  if (resetToken) {
+    showPasswordReset(resetToken);
+    return;
+  }
+  if (verifyToken) {
+    await confirmEmail(verifyToken);
+  }
+
   const token = localStorage.getItem('token');
 
   if (token) {
@@ -24,6 +39,7 @@ document.getElementById('login-form').addEventListener('submit', async (event) =
 async function createVideoDraft() {
   const title = document.getElementById('video-title').value;
   const description = document.getElementById('video-description').value;
+  const visibility = document.getElementById('video-visibility').value;
 
   try {
     const res = await fetch('/api/videos', {
@@ -32,7 +48,7 @@ async function createVideoDraft() {
         'Content-Type': 'application/json',
         Authorization: `Bearer ${localStorage.getItem('token')}`,
       },
-      body: JSON.stringify({ title, description }),
+      body: JSON.stringify({ title, description, visibility }),
     });
     const data = await res.json();
     if (!res.ok) {
@@ -102,6 +118,83 @@ async function signup() {
   }
 }
 
+async function requestPasswordReset() {
+  const email = document.getElementById('email').value;
+  if (!email) {
+    alert('Enter your email address first.');
+    return;
+  }
+
+  try {
+    const res = await fetch('/api/password_reset', {
+      method: 'POST',
+      headers: {
+        'Content-Type': 'application/json',
+      },
+      body: JSON.stringify({ email }),
+    });
+    if (!res.ok) {
+      const data = await res.json();
+      throw new Error(`Failed to request password reset: ${data.error}`);
+    }
+    alert('If an account exists for that address, a reset link is on its way.');
+  } catch (error) {
+    alert(`Error: ${error.message}`);
+  }
+}
+
+function showPasswordReset(token) {
+  document.getElementById('auth-section').style.display = 'none';
+  document.getElementById('video-section').style.display = 'none';
+  document.getElementById('password-reset-section').style.display = 'block';
+  document.getElementById('password-reset-form').onsubmit = async (event) => {
+    event.preventDefault();
+    await resetPassword(token);
+  };
+}
+
+async function resetPassword(token) {
+  const password = document.getElementById('new-password').value;
+
+  try {
+    const res = await fetch('/api/password_reset/confirm', {
+      method: 'POST',
+      headers: {
+        'Content-Type': 'application/json',
+      },
+      body: JSON.stringify({ token, password }),
+    });
+    if (!res.ok) {
+      const data = await res.json();
+      throw new Error(`Failed to reset password: ${data.error}`);
+    }
+    alert('Password changed. Please log in again.');
+    document.getElementById('password-reset-section').style.display = 'none';
+    logout();
+  } catch (error) {
+    alert(`Error: ${error.message}`);
+  }
+}
+
+async function confirmEmail(token) {
+  try {
+    const res = await fetch('/api/email_verification/confirm', {
+      method: 'POST',
+      headers: {
+        'Content-Type': 'application/json',
+      },
+      body: JSON.stringify({ token }),
+    });
+    if (!res.ok) {
+      const data = await res.json();
+      throw new Error(`Failed to verify email: ${data.error}`);
+    }
+    alert('Email address verified.');
+  } catch (error) {
+    alert(`Error: ${error.message}`);
+  }
+}
+
 function logout() {
   localStorage.removeItem('token');
   document.getElementById('auth-section').style.display = 'block';
@@ -175,8 +268,9 @@ async function uploadVideoFile(videoID) {
       throw new Error(`Failed to upload video file. Error: ${data.error}`);
     }
 
-    console.log('Video uploaded!');
+    console.log('Video uploaded, processing...');
     await getVideo(videoID);
+    watchVideoProcessing(videoID);
   } catch (error) {
     alert(`Error: ${error.message}`);
   }
@@ -184,6 +278,50 @@ async function uploadVideoFile(videoID) {
   setUploadButtonState(false, uploadBtnSelector);
 }
 
+// EventSource can't send the Authorization header private videos need, so
+// the event stream is read through fetch instead.
+async function watchVideoProcessing(videoID) {
+  try {
+    const res = await fetch(`/api/videos/${videoID}/events`, {
+      headers: {
+        Authorization: `Bearer ${localStorage.getItem('token')}`,
+      },
+    });
+    if (!res.ok) return;
+
+    const reader = res.body.pipeThrough(new TextDecoderStream()).getReader();
+    let buffer = '';
+    while (true) {
+      const { value, done } = await reader.read();
+      if (done) return;
+      buffer += value;
+
+      let end;
+      while ((end = buffer.indexOf('\n\n')) !== -1) {
+        const message = buffer.slice(0, end);
+        buffer = buffer.slice(end + 2);
+        const data = message
+          .split('\n')
+          .filter((line) => line.startsWith('data: '))
+          .map((line) => line.slice('data: '.length))
+          .join('\n');
+        if (data) handleVideoStatus(JSON.parse(data));
+      }
+    }
+  } catch (error) {
+    console.log(`Stopped watching video processing: ${error.message}`);
+  }
+}
+
+function handleVideoStatus(video) {
+  if (currentVideo && currentVideo.id === video.id) {
+    viewVideo(video);
+  }
+  if (video.status === 'failed') {
+    alert(`Video processing failed: ${video.failure_reason}`);
+  }
+}
+
 const videoStateHandler = createVideoStateHandler();
 
 async function getVideos() {
@@ -204,7 +342,10 @@ async function getVideos() {
     videoList.innerHTML = '';
     for (const video of videos) {
       const listItem = document.createElement('li');
-      listItem.textContent = video.title;
+      if (video.thumbnail_url) {
+        listItem.appendChild(createThumbnail(video, 160));
+      }
+      listItem.appendChild(document.createTextNode(video.title));
       listItem.onclick = () => videoStateHandler(video.id);
       videoList.appendChild(listItem);
     }
@@ -250,6 +391,31 @@ async function getVideo(videoID) {
 
 let currentVideo = null;
 
+// The LQIP is shown as the background of the image until it has loaded, so
+// tiles never flash blank.
+function setPlaceholder(img, video) {
+  img.style.backgroundImage = video.lqip ? `url("${video.lqip}")` : '';
+  img.style.backgroundSize = 'cover';
+  img.onload = () => {
+    img.style.backgroundImage = '';
+  };
+}
+
+function createThumbnail(video, width) {
+  const img = document.createElement('img');
+  img.width = width;
+  img.loading = 'lazy';
+  img.alt = '';
+  setPlaceholder(img, video);
+  const webp = (video.thumbnails || []).filter((t) => t.mime_type === 'image/webp');
+  if (webp.length > 0) {
+    img.srcset = webp.map((t) => `${t.url} ${t.width}w`).join(', ');
+    img.sizes = `${width}px`;
+  }
+  img.src = video.thumbnail_url;
+  return img;
+}
+
 function viewVideo(video) {
   currentVideo = video;
   document.getElementById('video-display').style.display = 'block';
@@ -262,6 +428,7 @@ function viewVideo(video) {
   } else {
     thumbnailImg.style.display = 'block';
     timeNow = Date.now()
+    setPlaceholder(thumbnailImg, video);
     thumbnailImg.src = video.thumbnail_url;
   }
 
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// contentAddressedPattern matches keys with a random hex name component,
+// which are never overwritten and can be cached forever.
+var contentAddressedPattern = regexp.MustCompile(`(^|[/-])[0-9a-f]{32,}([/.]|$)`)
+
+// mutableAssetExts are rewritten in place even below content-addressed
+// names, e.g. when caption tracks change.
+var mutableAssetExts = map[string]bool{
+	".m3u8": true,
+	".mpd":  true,
+}
+
+func assetCacheControl(key string) string {
+	if contentAddressedPattern.MatchString(key) && !mutableAssetExts[path.Ext(key)] {
+		return "public, max-age=31536000, immutable"
+	}
+	return "no-cache"
+}
+
+// assetETag is a strong validator. Objects are replaced by renaming a
+// complete file into place, so modification time and size identify them.
+func assetETag(stat fs.FileInfo) string {
+	return fmt.Sprintf(`"%x-%x"`, stat.ModTime().UnixNano(), stat.Size())
+}
+
+// assetsHandler serves files below root with validators, cache headers and
+// byte-range support so players can seek in locally stored videos.
+func assetsHandler(root string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			respondWithError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
+			return
+		}
+
+		key := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+		if key == "" || strings.HasPrefix(path.Base(key), ".") {
+			http.NotFound(w, r)
+			return
+		}
+
+		file, err := os.Open(filepath.Join(root, filepath.FromSlash(key)))
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrPermission) {
+				http.NotFound(w, r)
+				return
+			}
+			respondWithError(w, http.StatusInternalServerError, "Couldn't open asset", err)
+			return
+		}
+		defer file.Close()
+
+		stat, err := file.Stat()
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't stat asset", err)
+			return
+		}
+		if stat.IsDir() {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", contentTypeForKey(key))
+		w.Header().Set("ETag", assetETag(stat))
+		w.Header().Set("Cache-Control", assetCacheControl(key))
+		http.ServeContent(w, r, key, stat.ModTime(), file)
+	})
+}
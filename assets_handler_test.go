@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAssetCacheControl(t *testing.T) {
+	tests := map[string]string{
+		"videos/0b6f1f44-8c1a-4a3e-9a4e-5f7c1a2b3c4d/landscape/" + "0123456789abcdef0123456789abcdef" + ".mp4": "public, max-age=31536000, immutable",
+		"videos/0b6f1f44-8c1a-4a3e-9a4e-5f7c1a2b3c4d/thumbnails/0123456789abcdef0123456789abcdef/320.webp":     "public, max-age=31536000, immutable",
+		"videos/0b6f1f44-8c1a-4a3e-9a4e-5f7c1a2b3c4d/captions/en-0123456789abcdef0123456789abcdef.vtt":         "public, max-age=31536000, immutable",
+		"videos/0b6f1f44-8c1a-4a3e-9a4e-5f7c1a2b3c4d/captions/en-0123456789abcdef0123456789abcdef.m3u8":        "no-cache",
+		"videos/0b6f1f44-8c1a-4a3e-9a4e-5f7c1a2b3c4d/hls/master.m3u8":                                          "no-cache",
+		"videos/0b6f1f44-8c1a-4a3e-9a4e-5f7c1a2b3c4d/trickplay/sprite_000.jpg":                                 "no-cache",
+	}
+	for key, want := range tests {
+		if got := assetCacheControl(key); got != want {
+			t.Errorf("assetCacheControl(%q) = %q, want %q", key, got, want)
+		}
+	}
+}
+
+func TestAssetsHandler(t *testing.T) {
+	root := t.TempDir()
+	key := "videos/landscape/0123456789abcdef0123456789abcdef.mp4"
+	if err := os.MkdirAll(filepath.Join(root, "videos", "landscape"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, filepath.FromSlash(key)), []byte("0123456789"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	handler := http.StripPrefix("/assets", assetsHandler(root))
+
+	get := func(path string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get("/assets/"+key, nil)
+	if rec.Code != http.StatusOK || rec.Body.String() != "0123456789" {
+		t.Fatalf("GET = %v %q", rec.Code, rec.Body.String())
+	}
+	etag := rec.Header().Get("ETag")
+	if etag == "" || etag[0] != '"' {
+		t.Errorf("ETag = %q, want a strong validator", etag)
+	}
+	if rec.Header().Get("Last-Modified") == "" {
+		t.Error("Last-Modified not set")
+	}
+	if got := rec.Header().Get("Content-Type"); got != "video/mp4" {
+		t.Errorf("Content-Type = %q", got)
+	}
+
+	rec = get("/assets/"+key, map[string]string{"Range": "bytes=2-5"})
+	if rec.Code != http.StatusPartialContent || rec.Body.String() != "2345" {
+		t.Errorf("Range GET = %v %q", rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get("Content-Range"); got != "bytes 2-5/10" {
+		t.Errorf("Content-Range = %q", got)
+	}
+
+	rec = get("/assets/"+key, map[string]string{"Range": "bytes=2-5", "If-Range": `"stale"`})
+	if rec.Code != http.StatusOK {
+		t.Errorf("Range GET with stale If-Range = %v, want full response", rec.Code)
+	}
+
+	rec = get("/assets/"+key, map[string]string{"If-None-Match": etag})
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("conditional GET = %v, want 304", rec.Code)
+	}
+
+	for _, path := range []string{"/assets/videos/landscape", "/assets/videos/missing.mp4", "/assets/../go.mod"} {
+		if rec := get(path, nil); rec.Code != http.StatusNotFound {
+			t.Errorf("GET %v = %v, want 404", path, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/google/uuid"
+)
+
+var (
+	errInvalidAPIKey = errors.New("invalid API key")
+	errMissingScope  = errors.New("API key lacks the required scope")
+	errTokenRevoked  = errors.New("access token was revoked")
+)
+
+// requestUser identifies the user behind r from either an access token
+// (Authorization: Bearer) or an API key (Authorization: ApiKey). Access
+// tokens grant every scope, API keys only the ones they were created with.
+// Access tokens issued before the user last reset their password are
+// rejected.
+func (cfg *apiConfig) requestUser(r *http.Request, scope auth.Scope) (uuid.UUID, error) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "ApiKey ") {
+		token, err := auth.GetBearerToken(r.Header)
+		if err != nil {
+			return uuid.Nil, err
+		}
+		userID, issuedAt, err := auth.ValidateJWTIssuedAt(token, cfg.jwtKeys)
+		if err != nil {
+			return uuid.Nil, err
+		}
+		user, err := cfg.db.GetUser(userID)
+		if err != nil {
+			return uuid.Nil, err
+		}
+		if user == nil || (user.TokensValidAfter != nil && issuedAt.Before(*user.TokensValidAfter)) {
+			return uuid.Nil, errTokenRevoked
+		}
+		return userID, nil
+	}
+
+	presented, err := auth.GetAPIKey(r.Header)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	prefix, err := auth.ParseAPIKey(presented)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	key, err := cfg.db.GetAPIKeyByPrefix(prefix)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if key.ID == uuid.Nil || key.RevokedAt != nil || !auth.CheckAPIKeyHash(presented, key.KeyHash) {
+		return uuid.Nil, errInvalidAPIKey
+	}
+	if !slices.Contains(key.Scopes, string(scope)) {
+		return uuid.Nil, errMissingScope
+	}
+	if err := cfg.db.TouchAPIKey(key.ID, time.Now()); err != nil {
+		log.Printf("couldn't record use of API key %v: %v", key.ID, err)
+	}
+	return key.UserID, nil
+}
+
+// authenticateUser is requestUser for handlers that require a user,
+// writing the error response itself on failure.
+func (cfg *apiConfig) authenticateUser(w http.ResponseWriter, r *http.Request, scope auth.Scope) (uuid.UUID, bool) {
+	userID, err := cfg.requestUser(r, scope)
+	switch {
+	case errors.Is(err, auth.ErrNoAuthHeaderIncluded):
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find credentials", err)
+		return uuid.Nil, false
+	case errors.Is(err, errMissingScope):
+		respondWithError(w, http.StatusForbidden, "API key lacks the "+string(scope)+" scope", err)
+		return uuid.Nil, false
+	case err != nil:
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate credentials", err)
+		return uuid.Nil, false
+	}
+	return userID, true
+}
+
+// authenticateAccessToken is authenticateUser for handlers an API key must
+// not reach whatever its scopes, so a leaked key can't mint or revoke keys.
+func (cfg *apiConfig) authenticateAccessToken(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	if strings.HasPrefix(r.Header.Get("Authorization"), "ApiKey ") {
+		respondWithError(w, http.StatusForbidden, "API keys can't manage API keys", nil)
+		return uuid.Nil, false
+	}
+	return cfg.authenticateUser(w, r, auth.ScopeAccount)
+}
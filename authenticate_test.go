@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// newTestAPIKey stores an API key of user with scopes and returns it along
+// with the key to present.
+func newTestAPIKey(t *testing.T, cfg *apiConfig, user database.User, scopes ...auth.Scope) (database.APIKey, string) {
+	t.Helper()
+	key, prefix, err := auth.MakeAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := database.CreateAPIKeyParams{UserID: user.ID, Name: "test", Prefix: prefix, KeyHash: auth.HashAPIKey(key)}
+	for _, scope := range scopes {
+		params.Scopes = append(params.Scopes, string(scope))
+	}
+	apiKey, err := cfg.db.CreateAPIKey(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return apiKey, key
+}
+
+func TestRequestUser(t *testing.T) {
+	cfg := newTestConfig(t)
+	user, token := newTestUser(t, cfg, "user@example.com")
+	readKey, readSecret := newTestAPIKey(t, cfg, user, auth.ScopeVideosRead)
+	revokedKey, revokedSecret := newTestAPIKey(t, cfg, user, auth.ScopeVideosRead)
+	if err := cfg.db.RevokeAPIKey(revokedKey.ID); err != nil {
+		t.Fatal(err)
+	}
+	_, unscopedSecret := newTestAPIKey(t, cfg, user)
+	wrongSecret := readSecret[:len(readSecret)-1] + "x"
+
+	tests := []struct {
+		name          string
+		authorization string
+		scope         auth.Scope
+		wantErr       error
+	}{
+		{"access token", "Bearer " + token, auth.ScopeAccount, nil},
+		{"key with the scope", "ApiKey " + readSecret, auth.ScopeVideosRead, nil},
+		{"key without the scope", "ApiKey " + readSecret, auth.ScopeVideosWrite, errMissingScope},
+		{"key without scopes", "ApiKey " + unscopedSecret, auth.ScopeVideosRead, errMissingScope},
+		{"revoked key", "ApiKey " + revokedSecret, auth.ScopeVideosRead, errInvalidAPIKey},
+		{"wrong secret", "ApiKey " + wrongSecret, auth.ScopeVideosRead, errInvalidAPIKey},
+		{"malformed key", "ApiKey nonsense", auth.ScopeVideosRead, auth.ErrMalformedAPIKey},
+		{"no credentials", "", auth.ScopeVideosRead, auth.ErrNoAuthHeaderIncluded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			userID, err := cfg.requestUser(req, tt.scope)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("requestUser() err = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && userID != user.ID {
+				t.Errorf("requestUser() = %v, want %v", userID, user.ID)
+			}
+			if tt.wantErr != nil && userID != uuid.Nil {
+				t.Errorf("requestUser() = %v on error", userID)
+			}
+		})
+	}
+
+	readKey, err := cfg.db.GetAPIKey(readKey.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if readKey.LastUsedAt == nil {
+		t.Error("successful use of the key wasn't recorded")
+	}
+}
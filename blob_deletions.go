@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+	"github.com/google/uuid"
+)
+
+const (
+	blobDeletionBatchSize  = 50
+	blobDeletionInterval   = time.Minute
+	blobDeletionMaxBackoff = 6 * time.Hour
+)
+
+// videoPrefix is where derived artifacts of a video (renditions, sprites,
+// captions, ...) are stored, so they can be deleted as a group.
+func videoPrefix(videoID uuid.UUID) string {
+	return fmt.Sprintf("videos/%v/", videoID)
+}
+
+// storedKey returns the storage key of an asset reference saved on a
+// video. References are keys, except in rows written before playback URLs
+// were signed, which hold the URL produced by cfg.store.URL.
+func (cfg *apiConfig) storedKey(ref *string) (string, bool) {
+	if ref == nil || *ref == "" {
+		return "", false
+	}
+	if key, ok := strings.CutPrefix(*ref, cfg.store.URL("")); ok {
+		return key, true
+	}
+	if strings.Contains(*ref, "://") {
+		return "", false
+	}
+	return *ref, true
+}
+
+// legacyAssetPath maps a reference written when every asset was served from
+// assetsRoot, such as "http://localhost:8091/assets/<file>", to its path on
+// disk. Those files stay behind when the store is switched to S3.
+func (cfg *apiConfig) legacyAssetPath(ref *string) (string, bool) {
+	if ref == nil {
+		return "", false
+	}
+	u, err := url.Parse(*ref)
+	if err != nil || u.Hostname() != "localhost" {
+		return "", false
+	}
+	rel, ok := strings.CutPrefix(u.Path, "/assets/")
+	if !ok || !filepath.IsLocal(filepath.FromSlash(rel)) {
+		return "", false
+	}
+	return filepath.Join(cfg.assetsRoot, filepath.FromSlash(rel)), true
+}
+
+// refBlob is the outbox entry that deletes what an asset reference points
+// at, either an object in the store or a legacy file in assetsRoot.
+func (cfg *apiConfig) refBlob(ref *string) (database.CreateBlobDeletionParams, bool) {
+	if key, ok := cfg.storedKey(ref); ok {
+		return database.CreateBlobDeletionParams{Key: key}, true
+	}
+	if path, ok := cfg.legacyAssetPath(ref); ok {
+		return database.CreateBlobDeletionParams{Key: path, IsFile: true}, true
+	}
+	return database.CreateBlobDeletionParams{}, false
+}
+
+// videoBlobs lists every stored artifact belonging to video, including the
+// staged file or multipart upload of an upload that never finished.
+func (cfg *apiConfig) videoBlobs(video database.Video) ([]database.CreateBlobDeletionParams, error) {
+	blobs := []database.CreateBlobDeletionParams{
+		{Key: videoPrefix(video.ID), IsPrefix: true},
+	}
+	for _, ref := range []*string{video.VideoURL, video.ThumbnailURL} {
+		if blob, ok := cfg.refBlob(ref); ok {
+			blobs = append(blobs, blob)
+		}
+	}
+
+	tusUpload, err := cfg.db.GetVideoUpload(video.ID)
+	if err != nil {
+		return nil, err
+	}
+	if tusUpload.FilePath != "" {
+		blobs = append(blobs, database.CreateBlobDeletionParams{Key: tusUpload.FilePath, IsFile: true})
+	}
+
+	directUpload, err := cfg.db.GetDirectUpload(video.ID)
+	if err != nil {
+		return nil, err
+	}
+	if directUpload.UploadID != "" {
+		blobs = append(blobs, database.CreateBlobDeletionParams{
+			Key:      directUpload.Key,
+			UploadID: &directUpload.UploadID,
+		})
+	}
+	return blobs, nil
+}
+
+// wakeBlobDeletions asks the worker to run now instead of at the next tick.
+func (cfg *apiConfig) wakeBlobDeletions() {
+	select {
+	case cfg.blobDeletionWake <- struct{}{}:
+	default:
+	}
+}
+
+func (cfg *apiConfig) runBlobDeletionWorker(ctx context.Context) {
+	ticker := time.NewTicker(blobDeletionInterval)
+	defer ticker.Stop()
+
+	for {
+		cfg.processBlobDeletions(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-cfg.blobDeletionWake:
+		}
+	}
+}
+
+func (cfg *apiConfig) processBlobDeletions(ctx context.Context) {
+	deletions, err := cfg.db.GetDueBlobDeletions(time.Now(), blobDeletionBatchSize)
+	if err != nil {
+		log.Printf("GetDueBlobDeletions returned err: %v", err)
+		return
+	}
+
+	for _, deletion := range deletions {
+		if err := cfg.deleteBlob(ctx, deletion); err != nil {
+			backoff := blobDeletionBackoff(deletion.Attempts)
+			log.Printf("couldn't delete %q (attempt %d), retrying in %v: %v", deletion.Key, deletion.Attempts+1, backoff, err)
+			if err := cfg.db.RetryBlobDeletion(deletion.ID, err.Error(), time.Now().Add(backoff)); err != nil {
+				log.Printf("RetryBlobDeletion returned err: %v", err)
+			}
+			continue
+		}
+		if err := cfg.db.CompleteBlobDeletion(deletion.ID); err != nil {
+			log.Printf("CompleteBlobDeletion returned err: %v", err)
+		}
+	}
+}
+
+// blobDeletionBackoff doubles the wait after every failed attempt, starting
+// at a minute, up to blobDeletionMaxBackoff.
+func blobDeletionBackoff(attempts int) time.Duration {
+	return min(time.Duration(1<<min(attempts, 16))*time.Minute, blobDeletionMaxBackoff)
+}
+
+func (cfg *apiConfig) deleteBlob(ctx context.Context, deletion database.BlobDeletion) error {
+	switch {
+	case deletion.IsFile:
+		if err := os.Remove(deletion.Key); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		return nil
+	case deletion.UploadID != nil:
+		multipart, ok := cfg.store.(storage.MultipartStore)
+		if !ok {
+			return nil
+		}
+		return multipart.AbortMultipartUpload(ctx, deletion.Key, *deletion.UploadID)
+	case deletion.IsPrefix:
+		return cfg.deletePrefix(ctx, deletion.Key)
+	default:
+		return cfg.store.Delete(ctx, deletion.Key)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+)
+
+// failingStore refuses every delete, so the outbox has to retry.
+type failingStore struct {
+	*storage.MemoryStore
+}
+
+func (s failingStore) Delete(ctx context.Context, key string) error {
+	return errors.New("store unavailable")
+}
+
+func enqueueTestDeletion(t *testing.T, cfg *apiConfig, blobs []database.CreateBlobDeletionParams) {
+	t.Helper()
+	user, _ := newTestUser(t, cfg, "owner@example.com")
+	video := newTestVideo(t, cfg, user)
+	if err := cfg.db.DeleteVideoWithBlobs(video.ID, blobs); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLegacyAssetPath(t *testing.T) {
+	cfg := &apiConfig{assetsRoot: "/srv/assets"}
+	tests := []struct {
+		ref  string
+		want string
+		ok   bool
+	}{
+		{"http://localhost:8091/assets/thumbnails/a.png", "/srv/assets/thumbnails/a.png", true},
+		{"http://localhost:1234/assets/a.png", "/srv/assets/a.png", true},
+		{"http://localhost:8091/assets/../etc/passwd", "", false},
+		{"https://cdn.example.com/assets/a.png", "", false},
+		{"videos/1/a.png", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := cfg.legacyAssetPath(&tt.ref)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("legacyAssetPath(%q) = %q, %v, want %q, %v", tt.ref, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestVideoBlobsIncludesLegacyThumbnail(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.store = storage.NewMemoryStore("https://bucket.s3.amazonaws.com")
+	thumbnail := "http://localhost:8091/assets/a.png"
+	video := database.Video{ThumbnailURL: &thumbnail}
+
+	blobs, err := cfg.videoBlobs(video)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := filepath.Join(cfg.assetsRoot, "a.png")
+	for _, blob := range blobs {
+		if blob.Key == want && blob.IsFile {
+			return
+		}
+	}
+	t.Errorf("videoBlobs() = %+v, want file deletion of %q", blobs, want)
+}
+
+func TestProcessBlobDeletions(t *testing.T) {
+	cfg := newTestConfig(t)
+	store := cfg.store
+	ctx := context.Background()
+
+	for _, key := range []string{"videos/1/a.m3u8", "videos/1/b.ts", "videos/2/c.mp4"} {
+		if err := store.Put(ctx, key, strings.NewReader("x"), "application/octet-stream"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	staged := filepath.Join(cfg.assetsRoot, "staged.part")
+	if err := os.WriteFile(staged, []byte("x"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	enqueueTestDeletion(t, cfg, []database.CreateBlobDeletionParams{
+		{Key: "videos/1/", IsPrefix: true},
+		{Key: "videos/2/c.mp4"},
+		{Key: staged, IsFile: true},
+		{Key: filepath.Join(cfg.assetsRoot, "already-gone.part"), IsFile: true},
+	})
+	cfg.processBlobDeletions(ctx)
+
+	if objects, _ := store.List(ctx, "videos/"); len(objects) != 0 {
+		t.Errorf("objects left after deletion: %v", objects)
+	}
+	if _, err := os.Stat(staged); !os.IsNotExist(err) {
+		t.Errorf("staged file not removed, stat err = %v", err)
+	}
+	if due, _ := cfg.db.GetDueBlobDeletions(time.Now().Add(24*time.Hour), 10); len(due) != 0 {
+		t.Errorf("deletions left in the outbox: %+v", due)
+	}
+}
+
+func TestProcessBlobDeletionsRetries(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.store = failingStore{storage.NewMemoryStore("http://cdn.test")}
+	enqueueTestDeletion(t, cfg, []database.CreateBlobDeletionParams{{Key: "videos/a.mp4"}})
+
+	start := time.Now()
+	cfg.processBlobDeletions(context.Background())
+
+	due, err := cfg.db.GetDueBlobDeletions(start.Add(24*time.Hour), 10)
+	if err != nil || len(due) != 1 {
+		t.Fatalf("failed deletion dropped from the outbox: %v, %v", due, err)
+	}
+	if due[0].Attempts != 1 || due[0].LastError == nil || *due[0].LastError != "store unavailable" {
+		t.Errorf("attempts = %d, last error = %v", due[0].Attempts, due[0].LastError)
+	}
+	if got := due[0].NextAttemptAt.Sub(start); got < time.Minute || got > 2*time.Minute {
+		t.Errorf("next attempt in %v, want a minute", got)
+	}
+}
+
+func TestBlobDeletionBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, time.Minute},
+		{1, 2 * time.Minute},
+		{5, 32 * time.Minute},
+		{9, blobDeletionMaxBackoff},
+		{100, blobDeletionMaxBackoff},
+	}
+	for _, tt := range tests {
+		if got := blobDeletionBackoff(tt.attempts); got != tt.want {
+			t.Errorf("blobDeletionBackoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const hlsSubtitleGroup = "subs"
+
+var (
+	languageCodePattern = regexp.MustCompile(`^[a-z]{2,3}(-[A-Za-z0-9]{2,8})*$`)
+	srtTimingPattern    = regexp.MustCompile(`^(\d{1,2}:\d{2}:\d{2}),(\d{3}) --> (\d{1,2}:\d{2}:\d{2}),(\d{3})(.*)$`)
+)
+
+func captionsPrefix(videoID uuid.UUID) string {
+	return videoPrefix(videoID) + "captions/"
+}
+
+// toWebVTT returns data as WebVTT. Files that already are WebVTT are only
+// normalised, anything else is parsed as SRT.
+func toWebVTT(data []byte) ([]byte, error) {
+	if !utf8.Valid(data) {
+		return nil, invalidMedia("captions must be UTF-8 encoded")
+	}
+	text := strings.TrimPrefix(string(data), "\ufeff")
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+
+	if strings.HasPrefix(text, "WEBVTT") {
+		if !strings.Contains(text, "-->") {
+			return nil, invalidMedia("captions contain no cues")
+		}
+		return []byte(text), nil
+	}
+
+	var vtt strings.Builder
+	vtt.WriteString("WEBVTT\n")
+	cues := 0
+	for _, block := range strings.Split(strings.TrimSpace(text), "\n\n") {
+		lines := strings.Split(strings.TrimSpace(block), "\n")
+		// The numeric counter before the timing line is optional.
+		if len(lines) > 1 && !strings.Contains(lines[0], "-->") {
+			lines = lines[1:]
+		}
+		match := srtTimingPattern.FindStringSubmatch(lines[0])
+		if match == nil {
+			return nil, invalidMedia("captions are neither WebVTT nor SRT")
+		}
+		fmt.Fprintf(&vtt, "\n%v.%v --> %v.%v%v\n", match[1], match[2], match[3], match[4], match[5])
+		for _, line := range lines[1:] {
+			vtt.WriteString(line + "\n")
+		}
+		cues++
+	}
+	if cues == 0 {
+		return nil, invalidMedia("captions contain no cues")
+	}
+	return []byte(vtt.String()), nil
+}
+
+// subtitlePlaylist wraps a single WebVTT file in an HLS media playlist.
+func subtitlePlaylist(vttName string, durationSeconds float64) string {
+	return fmt.Sprintf("#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:%d\n#EXT-X-MEDIA-SEQUENCE:0\n#EXT-X-PLAYLIST-TYPE:VOD\n#EXTINF:%.3f,\n%v\n#EXT-X-ENDLIST\n",
+		int(math.Ceil(durationSeconds)), durationSeconds, vttName)
+}
+
+type hlsSubtitle struct {
+	Language string
+	Name     string
+	URI      string
+}
+
+// withSubtitles rewrites an HLS master playlist so its variants reference
+// exactly the given subtitle renditions. It can be applied repeatedly.
+func withSubtitles(master string, subtitles []hlsSubtitle) string {
+	var out strings.Builder
+	inserted := false
+	for _, line := range strings.Split(strings.TrimRight(master, "\n"), "\n") {
+		if strings.HasPrefix(line, "#EXT-X-MEDIA:") && strings.Contains(line, "TYPE=SUBTITLES") {
+			continue
+		}
+		if strings.HasPrefix(line, "#EXT-X-STREAM-INF:") {
+			if !inserted {
+				for i, subtitle := range subtitles {
+					isDefault := "NO"
+					if i == 0 {
+						isDefault = "YES"
+					}
+					fmt.Fprintf(&out, "#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID=%q,NAME=%q,LANGUAGE=%q,DEFAULT=%v,AUTOSELECT=YES,URI=%q\n",
+						hlsSubtitleGroup, subtitle.Name, subtitle.Language, isDefault, subtitle.URI)
+				}
+				inserted = true
+			}
+			line = strings.Replace(line, fmt.Sprintf(",SUBTITLES=%q", hlsSubtitleGroup), "", 1)
+			if len(subtitles) > 0 {
+				line += fmt.Sprintf(",SUBTITLES=%q", hlsSubtitleGroup)
+			}
+		}
+		out.WriteString(line + "\n")
+	}
+	return out.String()
+}
+
+// updateHLSCaptions points the video's HLS master playlist at its current
+// caption tracks. Videos that haven't been packaged yet are skipped; the
+// processing job calls this again once they are. The tracks are read from
+// the database rather than video, which the job loaded before it started.
+func (cfg *apiConfig) updateHLSCaptions(ctx context.Context, video database.Video) error {
+	masterKey, ok := cfg.storedKey(video.HLSURL)
+	if !ok {
+		return nil
+	}
+	duration := 0.0
+	if video.Media.DurationSeconds != nil {
+		duration = *video.Media.DurationSeconds
+	}
+
+	tracks, err := cfg.db.GetCaptionTracks(video.ID)
+	if err != nil {
+		return err
+	}
+
+	subtitles := []hlsSubtitle{}
+	for _, track := range tracks {
+		vttKey, ok := cfg.storedKey(&track.URL)
+		if !ok {
+			continue
+		}
+		playlistKey := strings.TrimSuffix(vttKey, ".vtt") + ".m3u8"
+		playlist := subtitlePlaylist(path.Base(vttKey), duration)
+		if err := cfg.store.Put(ctx, playlistKey, strings.NewReader(playlist), contentTypeForKey(playlistKey)); err != nil {
+			return err
+		}
+		subtitles = append(subtitles, hlsSubtitle{
+			Language: track.Language,
+			Name:     track.Label,
+			URI:      relativeKey(path.Dir(masterKey), playlistKey),
+		})
+	}
+
+	body, _, err := cfg.store.Get(ctx, masterKey)
+	if err != nil {
+		return err
+	}
+	master, err := io.ReadAll(body)
+	body.Close()
+	if err != nil {
+		return err
+	}
+	updated := withSubtitles(string(master), subtitles)
+	return cfg.store.Put(ctx, masterKey, bytes.NewReader([]byte(updated)), contentTypeForKey(masterKey))
+}
+
+// relativeKey returns the path of key relative to the directory dir, both
+// being storage keys.
+func relativeKey(dir, key string) string {
+	dirParts := strings.Split(dir, "/")
+	keyParts := strings.Split(key, "/")
+	common := 0
+	for common < len(dirParts) && common < len(keyParts)-1 && dirParts[common] == keyParts[common] {
+		common++
+	}
+	return strings.Repeat("../", len(dirParts)-common) + strings.Join(keyParts[common:], "/")
+}
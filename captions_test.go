@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+func TestToWebVTTFromSRT(t *testing.T) {
+	srt := "\ufeff1\r\n00:00:01,000 --> 00:00:02,500\r\nHello\r\nworld\r\n\r\n2\r\n00:00:03,000 --> 00:00:04,000\r\nBye\r\n"
+	got, err := toWebVTT([]byte(srt))
+	if err != nil {
+		t.Fatalf("toWebVTT() err = %v", err)
+	}
+	want := "WEBVTT\n\n00:00:01.000 --> 00:00:02.500\nHello\nworld\n\n00:00:03.000 --> 00:00:04.000\nBye\n"
+	if string(got) != want {
+		t.Errorf("toWebVTT() = %q, want %q", got, want)
+	}
+}
+
+func TestToWebVTTRejectsInvalid(t *testing.T) {
+	for _, data := range []string{"", "WEBVTT\n", "just some text", "1\n00:00:01 --> 00:00:02\nmissing millis"} {
+		if _, err := toWebVTT([]byte(data)); !isInvalidMedia(err) {
+			t.Errorf("toWebVTT(%q) err = %v, want invalid media", data, err)
+		}
+	}
+}
+
+func TestWithSubtitles(t *testing.T) {
+	master := "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-STREAM-INF:BANDWIDTH=1000,RESOLUTION=640x360\n360p/index.m3u8\n"
+	subtitles := []hlsSubtitle{{Language: "en", Name: "English", URI: "../captions/en.m3u8"}}
+
+	got := withSubtitles(master, subtitles)
+	if !strings.Contains(got, `#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID="subs",NAME="English",LANGUAGE="en",DEFAULT=YES,AUTOSELECT=YES,URI="../captions/en.m3u8"`) {
+		t.Errorf("missing subtitle rendition:\n%v", got)
+	}
+	if !strings.Contains(got, `RESOLUTION=640x360,SUBTITLES="subs"`+"\n") {
+		t.Errorf("variant doesn't reference subtitles:\n%v", got)
+	}
+	if again := withSubtitles(got, subtitles); again != got {
+		t.Errorf("withSubtitles isn't idempotent:\n%v", again)
+	}
+	if removed := withSubtitles(got, nil); removed != master {
+		t.Errorf("withSubtitles(nil) = %q, want %q", removed, master)
+	}
+}
+
+func TestRelativeKey(t *testing.T) {
+	got := relativeKey("videos/1/hls", "videos/1/captions/en.m3u8")
+	if want := "../captions/en.m3u8"; got != want {
+		t.Errorf("relativeKey() = %q, want %q", got, want)
+	}
+}
+
+func TestUpdateHLSCaptionsUsesCurrentTracks(t *testing.T) {
+	cfg := newTestConfig(t)
+	ctx := context.Background()
+	user, _ := newTestUser(t, cfg, "owner@example.com")
+	video := newTestVideo(t, cfg, user)
+
+	// The job's copy of the video predates the caption upload.
+	masterKey := hlsPrefix(video.ID) + "master.m3u8"
+	video.HLSURL = &masterKey
+	master := "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-STREAM-INF:BANDWIDTH=1000,RESOLUTION=640x360\n360p/index.m3u8\n"
+	if err := cfg.store.Put(ctx, masterKey, strings.NewReader(master), "application/vnd.apple.mpegurl"); err != nil {
+		t.Fatal(err)
+	}
+	_, _, err := cfg.db.CreateCaptionTrack(database.CreateCaptionTrackParams{
+		VideoID:  video.ID,
+		Language: "en",
+		Label:    "English",
+		URL:      videoPrefix(video.ID) + "captions/en.vtt",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cfg.updateHLSCaptions(ctx, video); err != nil {
+		t.Fatalf("updateHLSCaptions() err = %v", err)
+	}
+
+	body, _, err := cfg.store.Get(ctx, masterKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	updated, _ := io.ReadAll(body)
+	body.Close()
+	if !strings.Contains(string(updated), `LANGUAGE="en"`) || !strings.Contains(string(updated), `URI="../captions/en.m3u8"`) {
+		t.Errorf("master playlist lacks the track added after the video was loaded:\n%s", updated)
+	}
+	if _, err := cfg.store.Stat(ctx, videoPrefix(video.ID)+"captions/en.m3u8"); err != nil {
+		t.Errorf("subtitle playlist not written: %v", err)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/google/uuid"
+)
+
+func cmafPrefix(videoID uuid.UUID) string {
+	return videoPrefix(videoID) + "cmaf/"
+}
+
+// packageCMAF encodes the HLS ladder once into fragmented MP4 (CMAF)
+// segments and writes both a DASH MPD and HLS playlists that point at the
+// same segments. It returns the keys of the HLS master playlist and MPD.
+func (cfg *apiConfig) packageCMAF(ctx context.Context, videoID uuid.UUID, filePath string) (string, string, error) {
+	probe, err := probeMedia(filePath)
+	if err != nil {
+		return "", "", err
+	}
+	if !probe.HasVideo {
+		return "", "", fmt.Errorf("no video streams found")
+	}
+
+	outputDir, err := os.MkdirTemp("", "tubely-cmaf-")
+	if err != nil {
+		return "", "", err
+	}
+	defer os.RemoveAll(outputDir)
+
+	cmd := exec.CommandContext(ctx, "ffmpeg", cmafArgs(filePath, filepath.Join(outputDir, "manifest.mpd"), probe)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", "", fmt.Errorf("ffmpeg dash err: %w: %s", err, lastLine(stderr.String()))
+	}
+
+	prefix := cmafPrefix(videoID)
+	if err := cfg.putDir(ctx, outputDir, prefix); err != nil {
+		return "", "", fmt.Errorf("couldn't store CMAF output: %w", err)
+	}
+	return prefix + "master.m3u8", prefix + "manifest.mpd", nil
+}
+
+// cmafArgs builds the ffmpeg arguments that encode the video described by
+// probe into every rendition of its ladder in a single pass, writing the
+// MPD to outputPath.
+func cmafArgs(filePath, outputPath string, probe mediaProbe) []string {
+	width, height := probe.displaySize()
+	audio := probe.HasAudio
+
+	renditions := hlsRenditionsFor(min(width, height))
+	args := []string{"-i", filePath}
+	for range renditions {
+		args = append(args, "-map", "0:v:0")
+	}
+	if audio {
+		args = append(args, "-map", "0:a:0")
+	}
+
+	args = append(args, "-c:v", "libx264", "-preset", "veryfast", "-profile:v", "main",
+		segmentKeyframes[0], segmentKeyframes[1], "-sc_threshold", "0")
+	for i, rendition := range renditions {
+		scale, _, _ := renditionScale(width, height, rendition)
+		args = append(args,
+			fmt.Sprintf("-filter:v:%d", i), scale,
+			fmt.Sprintf("-b:v:%d", i), fmt.Sprintf("%dk", rendition.VideoBitrate),
+			fmt.Sprintf("-maxrate:v:%d", i), fmt.Sprintf("%dk", rendition.VideoBitrate*107/100),
+			fmt.Sprintf("-bufsize:v:%d", i), fmt.Sprintf("%dk", rendition.VideoBitrate*3/2),
+		)
+	}
+
+	adaptationSets := "id=0,streams=v"
+	if audio {
+		// A single audio track is shared by every video representation.
+		args = append(args, "-c:a", "aac", "-ac", "2", "-b:a", fmt.Sprintf("%dk", renditions[0].AudioBitrate))
+		adaptationSets += " id=1,streams=a"
+	}
+
+	return append(args,
+		"-f", "dash",
+		"-seg_duration", fmt.Sprintf("%d", hlsSegmentSeconds),
+		"-use_template", "1",
+		"-use_timeline", "1",
+		"-adaptation_sets", adaptationSets,
+		"-init_seg_name", "init-$RepresentationID$.m4s",
+		"-media_seg_name", "chunk-$RepresentationID$-$Number%05d$.m4s",
+		"-hls_playlist", "1",
+		"-hls_master_name", "master.m3u8",
+		outputPath,
+	)
+}
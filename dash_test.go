@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// argValue returns the argument following flag in args.
+func argValue(args []string, flag string) string {
+	i := slices.Index(args, flag)
+	if i < 0 || i+1 >= len(args) {
+		return ""
+	}
+	return args[i+1]
+}
+
+func TestCMAFArgs(t *testing.T) {
+	args := cmafArgs("in.mp4", "out/manifest.mpd", mediaProbe{HasVideo: true, Width: 1920, Height: 1080, HasAudio: true})
+
+	joined := strings.Join(args, " ")
+	if got := strings.Count(joined, "-map 0:v:0"); got != 4 {
+		t.Errorf("want 4 video maps for 1080p, got %d", got)
+	}
+	if !strings.Contains(joined, "-map 0:a:0") || argValue(args, "-c:a") != "aac" || argValue(args, "-b:a") != "192k" {
+		t.Errorf("want the audio track shared at the top rendition bitrate: %v", args)
+	}
+	if got := argValue(args, "-filter:v:0"); got != "scale=-2:1080" {
+		t.Errorf("-filter:v:0 = %q, want scale=-2:1080", got)
+	}
+	if got := argValue(args, "-filter:v:3"); got != "scale=-2:360" {
+		t.Errorf("-filter:v:3 = %q, want scale=-2:360", got)
+	}
+	if got := argValue(args, "-b:v:1"); got != "2800k" {
+		t.Errorf("-b:v:1 = %q, want 2800k", got)
+	}
+	if got := argValue(args, segmentKeyframes[0]); got != segmentKeyframes[1] {
+		t.Errorf("keyframes = %q, want %q", got, segmentKeyframes[1])
+	}
+	if got := argValue(args, "-adaptation_sets"); got != "id=0,streams=v id=1,streams=a" {
+		t.Errorf("-adaptation_sets = %q", got)
+	}
+	if args[len(args)-1] != "out/manifest.mpd" {
+		t.Errorf("want the MPD path last, got %q", args[len(args)-1])
+	}
+}
+
+func TestCMAFArgs_noAudio(t *testing.T) {
+	args := cmafArgs("in.mp4", "manifest.mpd", mediaProbe{HasVideo: true, Width: 640, Height: 360})
+
+	if slices.Contains(args, "0:a:0") || slices.Contains(args, "-c:a") {
+		t.Errorf("want no audio arguments for a silent video: %v", args)
+	}
+	if got := argValue(args, "-adaptation_sets"); got != "id=0,streams=v" {
+		t.Errorf("-adaptation_sets = %q, want id=0,streams=v", got)
+	}
+}
+
+func TestCMAFArgs_smallPortraitSource(t *testing.T) {
+	args := cmafArgs("in.mp4", "manifest.mpd", mediaProbe{HasVideo: true, Width: 201, Height: 400, HasAudio: true})
+
+	if got := strings.Count(strings.Join(args, " "), "-map 0:v:0"); got != 1 {
+		t.Errorf("want a single rendition below the ladder, got %d", got)
+	}
+	if got := argValue(args, "-filter:v:0"); got != "scale=200:-2" {
+		t.Errorf("-filter:v:0 = %q, want scale=200:-2", got)
+	}
+	if got := argValue(args, "-b:a"); got != "96k" {
+		t.Errorf("-b:a = %q, want the lowest rung's 96k", got)
+	}
+}
+
+func TestPackageCMAF(t *testing.T) {
+	fakeTool(t, "ffprobe", `echo '{"streams":[{"codec_type":"video","width":1280,"height":720}],"format":{}}'`)
+	fakeTool(t, "ffmpeg", `for last; do :; done
+dir=$(dirname "$last")
+echo mpd > "$last"
+echo m3u8 > "$dir/master.m3u8"
+echo chunk > "$dir/chunk-0-00001.m4s"
+`)
+	cfg := newTestConfig(t)
+	videoID := uuid.New()
+
+	hlsKey, dashKey, err := cfg.packageCMAF(context.Background(), videoID, "in.mp4")
+	if err != nil {
+		t.Fatalf("packageCMAF() err = %v", err)
+	}
+	prefix := cmafPrefix(videoID)
+	if hlsKey != prefix+"master.m3u8" || dashKey != prefix+"manifest.mpd" {
+		t.Errorf("keys = %q, %q", hlsKey, dashKey)
+	}
+	objects, err := cfg.store.List(context.Background(), prefix)
+	if err != nil || len(objects) != 3 {
+		t.Errorf("stored %v, %v, want the MPD, playlist and segment", objects, err)
+	}
+}
+
+func TestPackageCMAF_audioOnly(t *testing.T) {
+	fakeTool(t, "ffprobe", `echo '{"streams":[{"codec_type":"audio","channels":2}],"format":{}}'`)
+	fakeTool(t, "ffmpeg", `exit 1`)
+	cfg := newTestConfig(t)
+
+	if _, _, err := cfg.packageCMAF(context.Background(), uuid.New(), "in.m4a"); err == nil || !strings.Contains(err.Error(), "no video streams") {
+		t.Errorf("packageCMAF() err = %v, want no video streams", err)
+	}
+}
+
+func TestPackageCMAF_ffmpegFailure(t *testing.T) {
+	fakeTool(t, "ffprobe", `echo '{"streams":[{"codec_type":"video","width":640,"height":360}],"format":{}}'`)
+	fakeTool(t, "ffmpeg", `echo "first line" >&2; echo "Unknown encoder 'libx264'" >&2; exit 1`)
+	cfg := newTestConfig(t)
+
+	_, _, err := cfg.packageCMAF(context.Background(), uuid.New(), "in.mp4")
+	if err == nil || !strings.HasSuffix(err.Error(), "Unknown encoder 'libx264'") {
+		t.Errorf("packageCMAF() err = %v, want the last line of ffmpeg's stderr", err)
+	}
+}
+
+func TestCMAFArgs_rotatedSource(t *testing.T) {
+	// A phone video recorded upright: landscape coded frames, shown rotated.
+	args := cmafArgs("in.mp4", "manifest.mpd", mediaProbe{HasVideo: true, Width: 1920, Height: 1080, Rotation: 90})
+
+	if got := argValue(args, "-filter:v:0"); got != "scale=1080:-2" {
+		t.Errorf("-filter:v:0 = %q, want the portrait scale=1080:-2", got)
+	}
+}
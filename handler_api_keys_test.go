@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+)
+
+func TestAPIKeyCreate(t *testing.T) {
+	cfg := newTestConfig(t)
+	_, token := newTestUser(t, cfg, "user@example.com")
+
+	rec := serveTestRequest("POST /api/api_keys", cfg.handlerAPIKeyCreate,
+		http.MethodPost, "/api/api_keys", "Bearer "+token, strings.NewReader(`{"name": "ci"}`))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusCreated)
+	}
+	var created struct {
+		Key    string   `json:"key"`
+		Scopes []string `json:"scopes"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&created); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(created.Scopes, []string{"videos:read", "videos:write", "account"}) {
+		t.Errorf("scopes = %v, want the owner's full access", created.Scopes)
+	}
+
+	// The key works wherever an access token would.
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "ApiKey "+created.Key)
+	for _, scope := range auth.AllScopes {
+		if _, err := cfg.requestUser(req, scope); err != nil {
+			t.Errorf("requestUser(%v) err = %v", scope, err)
+		}
+	}
+}
+
+func TestAPIKeyCreateScopes(t *testing.T) {
+	cfg := newTestConfig(t)
+	_, token := newTestUser(t, cfg, "user@example.com")
+
+	for body, want := range map[string]int{
+		`{"name": "ci", "scopes": []}`:              http.StatusCreated,
+		`{"name": "ci", "scopes": ["admin"]}`:       http.StatusBadRequest,
+		`{"name": "ci", "scopes": ["videos:read"]}`: http.StatusCreated,
+		`{"scopes": ["videos:read"]}`:               http.StatusBadRequest,
+	} {
+		rec := serveTestRequest("POST /api/api_keys", cfg.handlerAPIKeyCreate,
+			http.MethodPost, "/api/api_keys", "Bearer "+token, strings.NewReader(body))
+		if rec.Code != want {
+			t.Errorf("%v: status = %d, want %d", body, rec.Code, want)
+		}
+	}
+}
+
+func TestAPIKeyManagementRejectsAPIKeys(t *testing.T) {
+	cfg := newTestConfig(t)
+	user, _ := newTestUser(t, cfg, "user@example.com")
+	key, secret := newTestAPIKey(t, cfg, user, auth.ScopeVideosRead, auth.ScopeVideosWrite, auth.ScopeAccount)
+	authorization := "ApiKey " + secret
+
+	if rec := serveTestRequest("POST /api/api_keys", cfg.handlerAPIKeyCreate, http.MethodPost, "/api/api_keys",
+		authorization, strings.NewReader(`{"name": "minted", "scopes": ["account"]}`)); rec.Code != http.StatusForbidden {
+		t.Errorf("create: status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+	if rec := serveTestRequest("GET /api/api_keys", cfg.handlerAPIKeysList, http.MethodGet, "/api/api_keys",
+		authorization, nil); rec.Code != http.StatusForbidden {
+		t.Errorf("list: status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+	if rec := serveTestRequest("DELETE /api/api_keys/{keyID}", cfg.handlerAPIKeyRevoke, http.MethodDelete,
+		fmt.Sprintf("/api/api_keys/%v", key.ID), authorization, nil); rec.Code != http.StatusForbidden {
+		t.Errorf("revoke: status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+
+	keys, err := cfg.db.GetAPIKeys(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0].RevokedAt != nil {
+		t.Errorf("keys = %+v, want the original key untouched", keys)
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const maxCaptionSize = 5 << 20
+
+func (cfg *apiConfig) handlerCaptionsCreate(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.authorizeVideoOwner(w, r)
+	if !ok {
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxCaptionSize)
+	if err := r.ParseMultipartForm(maxCaptionSize); err != nil {
+		respondWithError(w, http.StatusBadRequest, "couldn't parse form", err)
+		return
+	}
+
+	language := r.FormValue("language")
+	if !languageCodePattern.MatchString(language) {
+		respondWithError(w, http.StatusBadRequest, "language must be a language code like en or pt-BR", nil)
+		return
+	}
+	label := strings.TrimSpace(r.FormValue("label"))
+	if label == "" {
+		label = language
+	}
+
+	file, _, err := r.FormFile("captions")
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "couldn't find captions", err)
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "couldn't read captions", err)
+		return
+	}
+	vtt, err := toWebVTT(data)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	randKey := make([]byte, 16)
+	rand.Read(randKey)
+	key := fmt.Sprintf("%v%v-%v.vtt", captionsPrefix(video.ID), language, hex.EncodeToString(randKey))
+	if err := cfg.store.Put(r.Context(), key, bytes.NewReader(vtt), contentTypeForKey(key)); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't store captions", err)
+		return
+	}
+
+	track, replaced, err := cfg.db.CreateCaptionTrack(database.CreateCaptionTrackParams{
+		VideoID:  video.ID,
+		Language: language,
+		Label:    label,
+		URL:      key,
+	})
+	if err != nil {
+		cfg.store.Delete(r.Context(), key)
+		respondWithError(w, http.StatusInternalServerError, "couldn't create caption track", err)
+		return
+	}
+	if replaced.ID != uuid.Nil {
+		cfg.deleteCaptionFiles(r.Context(), replaced)
+	}
+	cfg.refreshHLSCaptions(r.Context(), video.ID)
+
+	signed, err := cfg.signedCaptionTrack(r.Context(), track)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't sign caption URL", err)
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, signed)
+}
+
+func (cfg *apiConfig) handlerCaptionsList(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.authorizeVideoViewer(w, r)
+	if !ok {
+		return
+	}
+
+	tracks, err := cfg.db.GetCaptionTracks(video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get caption tracks", err)
+		return
+	}
+
+	for i, track := range tracks {
+		tracks[i], err = cfg.signedCaptionTrack(r.Context(), track)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't sign caption URLs", err)
+			return
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, tracks)
+}
+
+func (cfg *apiConfig) handlerCaptionsDelete(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.authorizeVideoOwner(w, r)
+	if !ok {
+		return
+	}
+
+	trackID, err := uuid.Parse(r.PathValue("trackID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid track ID", err)
+		return
+	}
+	track, err := cfg.db.GetCaptionTrack(trackID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't get caption track", err)
+		return
+	}
+	if track.VideoID != video.ID {
+		respondWithError(w, http.StatusNotFound, "caption track doesn't exist", nil)
+		return
+	}
+
+	if err := cfg.db.DeleteCaptionTrack(track.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't delete caption track", err)
+		return
+	}
+	cfg.deleteCaptionFiles(r.Context(), track)
+	cfg.refreshHLSCaptions(r.Context(), video.ID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deleteCaptionFiles removes a track's WebVTT file and HLS playlist. Any
+// leftovers are removed with the rest of the video.
+func (cfg *apiConfig) deleteCaptionFiles(ctx context.Context, track database.CaptionTrack) {
+	key, ok := cfg.storedKey(&track.URL)
+	if !ok {
+		return
+	}
+	for _, k := range []string{key, strings.TrimSuffix(key, ".vtt") + ".m3u8"} {
+		if err := cfg.store.Delete(ctx, k); err != nil {
+			log.Printf("couldn't delete caption file %q: %v", k, err)
+		}
+	}
+}
+
+// refreshHLSCaptions reloads the video and updates its HLS playlists. The
+// track change itself has been saved, so failures are only logged.
+func (cfg *apiConfig) refreshHLSCaptions(ctx context.Context, videoID uuid.UUID) {
+	video, err := cfg.db.GetVideo(videoID)
+	if err == nil {
+		err = cfg.updateHLSCaptions(ctx, video)
+	}
+	if err != nil {
+		log.Printf("couldn't update HLS captions of %v: %v", videoID, err)
+	}
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+	"github.com/google/uuid"
+)
+
+const (
+	directUploadMaxParts  = 10000
+	directUploadURLExpiry = time.Hour
+)
+
+// handlerDirectUploadStart starts a multipart upload in the bucket and
+// returns one presigned PUT URL per part. The client PUTs the parts itself
+// and then calls handlerDirectUploadComplete with the ETags it got back.
+func (cfg *apiConfig) handlerDirectUploadStart(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		ContentType string `json:"content_type"`
+		Parts       int32  `json:"parts"`
+	}
+	type partURL struct {
+		PartNumber int32  `json:"part_number"`
+		URL        string `json:"url"`
+	}
+	type response struct {
+		UploadID  string    `json:"upload_id"`
+		Key       string    `json:"key"`
+		PartURLs  []partURL `json:"part_urls"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+
+	multipart, ok := cfg.store.(storage.MultipartStore)
+	if !ok {
+		respondWithError(w, http.StatusNotImplemented, "storage backend doesn't support direct uploads", nil)
+		return
+	}
+
+	video, ok := cfg.authorizeVideoOwner(w, r)
+	if !ok {
+		return
+	}
+
+	params := parameters{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	mimeType, _, err := mime.ParseMediaType(params.ContentType)
+	extension, ok := videoUploadTypes[mimeType]
+	if !ok {
+		respondWithError(w, http.StatusBadRequest, "wrong file format", err)
+		return
+	}
+	if params.Parts < 1 || params.Parts > directUploadMaxParts {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("parts must be between 1 and %d", directUploadMaxParts), nil)
+		return
+	}
+
+	if err := cfg.discardDirectUpload(r.Context(), multipart, video.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't discard previous upload", err)
+		return
+	}
+
+	randKey := make([]byte, 16)
+	rand.Read(randKey)
+	key := fmt.Sprintf("%vincoming/%v.%v", videoPrefix(video.ID), hex.EncodeToString(randKey), extension)
+
+	uploadID, err := multipart.CreateMultipartUpload(r.Context(), key, mimeType)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't start upload", err)
+		return
+	}
+
+	_, err = cfg.db.CreateDirectUpload(database.CreateDirectUploadParams{
+		VideoID:  video.ID,
+		UserID:   video.UserID,
+		UploadID: uploadID,
+		Key:      key,
+		MimeType: mimeType,
+	})
+	if err != nil {
+		multipart.AbortMultipartUpload(r.Context(), key, uploadID)
+		respondWithError(w, http.StatusInternalServerError, "couldn't save upload", err)
+		return
+	}
+
+	resp := response{
+		UploadID:  uploadID,
+		Key:       key,
+		PartURLs:  make([]partURL, 0, params.Parts),
+		ExpiresAt: time.Now().UTC().Add(directUploadURLExpiry),
+	}
+	for partNumber := int32(1); partNumber <= params.Parts; partNumber++ {
+		url, err := multipart.PresignUploadPart(r.Context(), key, uploadID, partNumber, directUploadURLExpiry)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "couldn't presign part", err)
+			return
+		}
+		resp.PartURLs = append(resp.PartURLs, partURL{PartNumber: partNumber, URL: url})
+	}
+
+	respondWithJSON(w, http.StatusCreated, resp)
+}
+
+// discardDirectUpload aborts the unfinished upload of videoID, if any, and
+// forgets it. When the abort fails it's left to the blob deletion worker,
+// so a flaky bucket can't keep the user from starting over.
+func (cfg *apiConfig) discardDirectUpload(ctx context.Context, multipart storage.MultipartStore, videoID uuid.UUID) error {
+	previous, err := cfg.db.GetDirectUpload(videoID)
+	if err != nil {
+		return err
+	}
+	if previous.UploadID == "" {
+		return nil
+	}
+
+	if err := multipart.AbortMultipartUpload(ctx, previous.Key, previous.UploadID); err != nil {
+		log.Printf("couldn't abort upload %v, retrying later: %v", previous.UploadID, err)
+		err = cfg.db.CreateBlobDeletions([]database.CreateBlobDeletionParams{
+			{Key: previous.Key, UploadID: &previous.UploadID},
+		})
+		if err != nil {
+			return err
+		}
+		cfg.wakeBlobDeletions()
+	}
+	return cfg.db.DeleteDirectUpload(videoID)
+}
+
+// handlerDirectUploadComplete assembles the uploaded parts and queues the
+// object for faststart processing like a regular upload.
+func (cfg *apiConfig) handlerDirectUploadComplete(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		UploadID string                  `json:"upload_id"`
+		Parts    []storage.CompletedPart `json:"parts"`
+	}
+
+	multipart, ok := cfg.store.(storage.MultipartStore)
+	if !ok {
+		respondWithError(w, http.StatusNotImplemented, "storage backend doesn't support direct uploads", nil)
+		return
+	}
+
+	video, ok := cfg.authorizeVideoOwner(w, r)
+	if !ok {
+		return
+	}
+
+	params := parameters{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	upload, err := cfg.db.GetDirectUpload(video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't get upload", err)
+		return
+	}
+	if upload.VideoID == uuid.Nil || upload.UploadID != params.UploadID || upload.UserID != video.UserID {
+		respondWithError(w, http.StatusNotFound, "upload not found", nil)
+		return
+	}
+	if len(params.Parts) == 0 {
+		respondWithError(w, http.StatusBadRequest, "parts are required", nil)
+		return
+	}
+
+	err = multipart.CompleteMultipartUpload(r.Context(), upload.Key, upload.UploadID, params.Parts)
+	if errors.Is(err, storage.ErrInvalidParts) {
+		respondWithError(w, http.StatusBadRequest, "couldn't complete upload", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't complete upload", err)
+		return
+	}
+	if err := cfg.db.DeleteDirectUpload(video.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't finish upload", err)
+		return
+	}
+
+	queuedVideo, err := cfg.enqueueVideoProcessing(video.ID, processVideoPayload{
+		SourceKey: upload.Key,
+		MimeType:  upload.MimeType,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't queue video processing", err)
+		return
+	}
+
+	cfg.respondWithVideo(w, r, http.StatusAccepted, queuedVideo)
+}
+
+func (cfg *apiConfig) handlerDirectUploadAbort(w http.ResponseWriter, r *http.Request) {
+	multipart, ok := cfg.store.(storage.MultipartStore)
+	if !ok {
+		respondWithError(w, http.StatusNotImplemented, "storage backend doesn't support direct uploads", nil)
+		return
+	}
+
+	video, ok := cfg.authorizeVideoOwner(w, r)
+	if !ok {
+		return
+	}
+
+	upload, err := cfg.db.GetDirectUpload(video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't get upload", err)
+		return
+	}
+	if upload.VideoID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "upload not found", nil)
+		return
+	}
+
+	if err := multipart.AbortMultipartUpload(r.Context(), upload.Key, upload.UploadID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't abort upload", err)
+		return
+	}
+	if err := cfg.db.DeleteDirectUpload(video.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't delete upload", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// downloadToTemp copies a stored object into a temp file for ffmpeg.
+func (cfg *apiConfig) downloadToTemp(ctx context.Context, key string) (string, error) {
+	body, _, err := cfg.store.Get(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+
+	file, err := os.CreateTemp("", "tubely-direct-upload-*"+path.Ext(key))
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(file, body); err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+	return file.Name(), nil
+}
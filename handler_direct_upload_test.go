@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+)
+
+// multipartMemoryStore hands out upload IDs without storing parts, and
+// fails completions with completeErr and aborts with abortErr.
+type multipartMemoryStore struct {
+	*storage.MemoryStore
+	uploads     int
+	aborted     []string
+	completeErr error
+	abortErr    error
+}
+
+func (s *multipartMemoryStore) CreateMultipartUpload(ctx context.Context, key, contentType string) (string, error) {
+	s.uploads++
+	return fmt.Sprintf("upload-%d", s.uploads), nil
+}
+
+func (s *multipartMemoryStore) PresignUploadPart(ctx context.Context, key, uploadID string, partNumber int32, expiresIn time.Duration) (string, error) {
+	return fmt.Sprintf("http://cdn.test/%v?uploadId=%v&partNumber=%d", key, uploadID, partNumber), nil
+}
+
+func (s *multipartMemoryStore) CompleteMultipartUpload(ctx context.Context, key, uploadID string, parts []storage.CompletedPart) error {
+	return s.completeErr
+}
+
+func (s *multipartMemoryStore) AbortMultipartUpload(ctx context.Context, key, uploadID string) error {
+	if s.abortErr != nil {
+		return s.abortErr
+	}
+	s.aborted = append(s.aborted, uploadID)
+	return nil
+}
+
+func TestDirectUploadStartReplacesPreviousUpload(t *testing.T) {
+	tests := []struct {
+		name         string
+		abortErr     error
+		wantDeferred bool
+	}{
+		{name: "aborted", abortErr: nil, wantDeferred: false},
+		{name: "abort failed", abortErr: errors.New("bucket unavailable"), wantDeferred: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newTestConfig(t)
+			store := &multipartMemoryStore{MemoryStore: storage.NewMemoryStore("http://cdn.test"), abortErr: tt.abortErr}
+			cfg.store = store
+			user, token := newTestUser(t, cfg, "owner@example.com")
+			video := newTestVideo(t, cfg, user)
+
+			_, err := cfg.db.CreateDirectUpload(database.CreateDirectUploadParams{
+				VideoID:  video.ID,
+				UserID:   user.ID,
+				UploadID: "stale",
+				Key:      videoPrefix(video.ID) + "incoming/stale.mp4",
+				MimeType: "video/mp4",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rec := serveTestRequest("POST /api/video_upload/{videoID}/direct", cfg.handlerDirectUploadStart,
+				http.MethodPost, fmt.Sprintf("/api/video_upload/%v/direct", video.ID), "Bearer "+token,
+				strings.NewReader(`{"content_type":"video/mp4","parts":2}`))
+			if rec.Code != http.StatusCreated {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusCreated, rec.Body)
+			}
+
+			upload, err := cfg.db.GetDirectUpload(video.ID)
+			if err != nil || upload.UploadID != "upload-1" {
+				t.Errorf("direct upload = %+v, %v, want upload-1", upload, err)
+			}
+
+			deferred, err := cfg.db.GetDueBlobDeletions(time.Now(), 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantDeferred {
+				if len(deferred) != 1 || deferred[0].UploadID == nil || *deferred[0].UploadID != "stale" {
+					t.Errorf("blob deletions = %+v, want the stale upload", deferred)
+				}
+			} else if len(deferred) != 0 || len(store.aborted) != 1 || store.aborted[0] != "stale" {
+				t.Errorf("aborted = %v, blob deletions = %+v, want stale aborted right away", store.aborted, deferred)
+			}
+		})
+	}
+}
+
+func TestDirectUploadStartRequiresOwner(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.store = &multipartMemoryStore{MemoryStore: storage.NewMemoryStore("http://cdn.test")}
+	owner, _ := newTestUser(t, cfg, "owner@example.com")
+	_, otherToken := newTestUser(t, cfg, "other@example.com")
+	video := newTestVideo(t, cfg, owner)
+
+	rec := serveTestRequest("POST /api/video_upload/{videoID}/direct", cfg.handlerDirectUploadStart,
+		http.MethodPost, fmt.Sprintf("/api/video_upload/%v/direct", video.ID), "Bearer "+otherToken,
+		strings.NewReader(`{"content_type":"video/mp4","parts":1}`))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestDirectUploadCompleteFailures(t *testing.T) {
+	tests := []struct {
+		name        string
+		completeErr error
+		wantStatus  int
+	}{
+		{name: "invalid parts", completeErr: fmt.Errorf("wrapped: %w", storage.ErrInvalidParts), wantStatus: http.StatusBadRequest},
+		{name: "backend failure", completeErr: errors.New("bucket unavailable"), wantStatus: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newTestConfig(t)
+			cfg.store = &multipartMemoryStore{MemoryStore: storage.NewMemoryStore("http://cdn.test"), completeErr: tt.completeErr}
+			user, token := newTestUser(t, cfg, "owner@example.com")
+			video := newTestVideo(t, cfg, user)
+			_, err := cfg.db.CreateDirectUpload(database.CreateDirectUploadParams{
+				VideoID:  video.ID,
+				UserID:   user.ID,
+				UploadID: "upload-1",
+				Key:      videoPrefix(video.ID) + "incoming/upload.mp4",
+				MimeType: "video/mp4",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rec := serveTestRequest("POST /api/video_upload/{videoID}/direct/complete", cfg.handlerDirectUploadComplete,
+				http.MethodPost, fmt.Sprintf("/api/video_upload/%v/direct/complete", video.ID), "Bearer "+token,
+				strings.NewReader(`{"upload_id":"upload-1","parts":[{"part_number":1,"etag":"abc"}]}`))
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if upload, _ := cfg.db.GetDirectUpload(video.ID); upload.UploadID != "upload-1" {
+				t.Errorf("direct upload = %+v, want it kept for a retry", upload)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// handlerEmailVerificationRequest mails a new verification link to the
+// signed in user, replacing any earlier one.
+func (cfg *apiConfig) handlerEmailVerificationRequest(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticateUser(w, r, auth.ScopeAccount)
+	if !ok {
+		return
+	}
+
+	user, err := cfg.db.GetUser(userID)
+	if err != nil || user == nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+		return
+	}
+	if user.EmailVerifiedAt != nil {
+		respondWithError(w, http.StatusConflict, "Email is already verified", nil)
+		return
+	}
+
+	if err := cfg.mailUserToken(r.Context(), *user, emailVerificationEmail); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't send verification email", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (cfg *apiConfig) handlerEmailVerificationConfirm(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Token string `json:"token"`
+	}
+
+	params := parameters{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if params.Token == "" {
+		respondWithError(w, http.StatusBadRequest, "Token is required", nil)
+		return
+	}
+
+	now := time.Now()
+	userID, err := cfg.db.UseUserToken(auth.HashToken(params.Token), database.UserTokenEmailVerification, now)
+	if errors.Is(err, database.ErrUserTokenUnusable) {
+		respondWithError(w, http.StatusBadRequest, "Verification link is invalid or expired", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check verification token", err)
+		return
+	}
+
+	if err := cfg.db.SetUserEmailVerified(userID, now); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't verify email", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+func TestPasswordResetConfirm(t *testing.T) {
+	cfg := newTestConfig(t)
+	user, accessToken := newTestUser(t, cfg, "user@example.com")
+	session := newTestRefreshToken(t, cfg, user, "session", time.Now().Add(time.Hour))
+	key, _ := newTestAPIKey(t, cfg, user, auth.ScopeVideosRead)
+	err := cfg.db.CreateUserToken(database.CreateUserTokenParams{
+		TokenHash: auth.HashToken("reset"),
+		UserID:    user.ID,
+		Purpose:   database.UserTokenPasswordReset,
+		ExpiresAt: time.Now().Add(passwordResetTTL),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	confirm := func() int {
+		rec := serveTestRequest("POST /api/password_reset/confirm", cfg.handlerPasswordResetConfirm, http.MethodPost,
+			"/api/password_reset/confirm", "", strings.NewReader(`{"token": "reset", "password": "new password"}`))
+		return rec.Code
+	}
+	listSessions := func() int {
+		rec := serveTestRequest("GET /api/sessions", cfg.handlerSessionsList, http.MethodGet,
+			"/api/sessions", "Bearer "+accessToken, nil)
+		return rec.Code
+	}
+	if code := listSessions(); code != http.StatusOK {
+		t.Fatalf("before reset: status = %d, want %d", code, http.StatusOK)
+	}
+
+	if code := confirm(); code != http.StatusNoContent {
+		t.Fatalf("status = %d, want %d", code, http.StatusNoContent)
+	}
+	if code := listSessions(); code != http.StatusUnauthorized {
+		t.Errorf("access token from before the reset: status = %d, want %d", code, http.StatusUnauthorized)
+	}
+
+	stored, err := cfg.db.GetUser(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if match, _ := auth.CheckPasswordHash("new password", stored.Password); !match {
+		t.Error("password wasn't changed")
+	}
+	if stored.EmailVerifiedAt == nil {
+		t.Error("email wasn't marked verified")
+	}
+	if rt, _ := cfg.db.GetRefreshToken(session.Token); rt.RevokedAt == nil {
+		t.Error("session wasn't revoked")
+	}
+	if key, _ = cfg.db.GetAPIKey(key.ID); key.RevokedAt == nil {
+		t.Error("API key wasn't revoked")
+	}
+
+	if code := confirm(); code != http.StatusBadRequest {
+		t.Errorf("reused link: status = %d, want %d", code, http.StatusBadRequest)
+	}
+}
@@ -1,15 +1,21 @@
 package main
 
 import (
+	"errors"
 	"net/http"
 	"time"
 
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
 )
 
+// handlerRefresh trades a refresh token for a new access token and a new
+// refresh token in the same family. Presenting a token that was already
+// rotated means it has leaked, so the whole family is revoked.
 func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
 	type response struct {
-		Token string `json:"token"`
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
 	}
 
 	refreshToken, err := auth.GetBearerToken(r.Header)
@@ -18,24 +24,59 @@ func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := cfg.db.GetUserByRefreshToken(refreshToken)
+	current, err := cfg.db.GetRefreshToken(refreshToken)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't get user for refresh token", err)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get refresh token", err)
+		return
+	}
+	if current.Token == "" {
+		respondWithError(w, http.StatusUnauthorized, "Invalid refresh token", nil)
+		return
+	}
+
+	nextToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create refresh token", err)
+		return
+	}
+	now := time.Now().UTC()
+	userAgent, ipAddress := clientInfo(r)
+	next, err := cfg.db.RotateRefreshToken(current, database.CreateRefreshTokenParams{
+		Token:     nextToken,
+		ExpiresAt: now.Add(refreshTokenTTL),
+		UserAgent: userAgent,
+		IPAddress: ipAddress,
+	}, now)
+	if errors.Is(err, database.ErrRefreshTokenUnusable) {
+		// A token that is unexpired but can't be rotated has been used
+		// before, possibly by a concurrent request that got there first.
+		if current.RevokedAt != nil || current.ExpiresAt.After(now) {
+			if err := cfg.db.RevokeRefreshTokenFamily(current.FamilyID); err != nil {
+				respondWithError(w, http.StatusInternalServerError, "Couldn't revoke session", err)
+				return
+			}
+		}
+		respondWithError(w, http.StatusUnauthorized, "Refresh token is revoked or expired", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't rotate refresh token", err)
 		return
 	}
 
 	accessToken, err := auth.MakeJWT(
-		user.ID,
-		cfg.jwtSecret,
+		next.UserID,
+		cfg.jwtKeys,
 		time.Hour,
 	)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't validate token", err)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create access JWT", err)
 		return
 	}
 
 	respondWithJSON(w, http.StatusOK, response{
-		Token: accessToken,
+		Token:        accessToken,
+		RefreshToken: next.Token,
 	})
 }
 
@@ -46,7 +87,17 @@ func (cfg *apiConfig) handlerRevoke(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = cfg.db.RevokeRefreshToken(refreshToken)
+	current, err := cfg.db.GetRefreshToken(refreshToken)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get refresh token", err)
+		return
+	}
+	if current.Token == "" {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	err = cfg.db.RevokeRefreshTokenFamily(current.FamilyID)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke session", err)
 		return
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+func newTestRefreshToken(t *testing.T, cfg *apiConfig, user database.User, token string, expiresAt time.Time) database.RefreshToken {
+	t.Helper()
+	rt, err := cfg.db.CreateRefreshToken(database.CreateRefreshTokenParams{Token: token, UserID: user.ID, ExpiresAt: expiresAt})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rt
+}
+
+// refreshTestToken posts token to handlerRefresh, returning the status and
+// the refresh token it was rotated to.
+func refreshTestToken(t *testing.T, cfg *apiConfig, token string) (int, string) {
+	t.Helper()
+	rec := serveTestRequest("POST /api/refresh", cfg.handlerRefresh, http.MethodPost, "/api/refresh", "Bearer "+token, nil)
+	var response struct {
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	if rec.Code == http.StatusOK {
+		if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+		if response.Token == "" {
+			t.Error("no access token in the response")
+		}
+	}
+	return rec.Code, response.RefreshToken
+}
+
+func TestRefreshRotatesToken(t *testing.T) {
+	cfg := newTestConfig(t)
+	user, _ := newTestUser(t, cfg, "user@example.com")
+	root := newTestRefreshToken(t, cfg, user, "root", time.Now().Add(time.Hour))
+
+	code, next := refreshTestToken(t, cfg, root.Token)
+	if code != http.StatusOK || next == "" || next == root.Token {
+		t.Fatalf("refresh = %d, %q, want a new token", code, next)
+	}
+	code, last := refreshTestToken(t, cfg, next)
+	if code != http.StatusOK || last == "" || last == next {
+		t.Fatalf("refreshing the rotated token = %d, %q, want a new token", code, last)
+	}
+
+	rt, err := cfg.db.GetRefreshToken(last)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rt.FamilyID != root.FamilyID || rt.RevokedAt != nil {
+		t.Errorf("latest token = %+v, want it active in the original family", rt)
+	}
+}
+
+func TestRefreshReuseRevokesFamily(t *testing.T) {
+	cfg := newTestConfig(t)
+	user, _ := newTestUser(t, cfg, "user@example.com")
+	root := newTestRefreshToken(t, cfg, user, "root", time.Now().Add(time.Hour))
+	other := newTestRefreshToken(t, cfg, user, "other", time.Now().Add(time.Hour))
+
+	_, next := refreshTestToken(t, cfg, root.Token)
+	if code, _ := refreshTestToken(t, cfg, root.Token); code != http.StatusUnauthorized {
+		t.Fatalf("reused token: status = %d, want %d", code, http.StatusUnauthorized)
+	}
+	if code, _ := refreshTestToken(t, cfg, next); code != http.StatusUnauthorized {
+		t.Errorf("token rotated from a reused one: status = %d, want %d", code, http.StatusUnauthorized)
+	}
+	if code, _ := refreshTestToken(t, cfg, other.Token); code != http.StatusOK {
+		t.Errorf("token of another session: status = %d, want %d", code, http.StatusOK)
+	}
+}
+
+func TestRefreshRejectsExpiredAndUnknownTokens(t *testing.T) {
+	cfg := newTestConfig(t)
+	user, _ := newTestUser(t, cfg, "user@example.com")
+	expired := newTestRefreshToken(t, cfg, user, "expired", time.Now().Add(-time.Minute))
+
+	for _, token := range []string{expired.Token, "unknown"} {
+		if code, _ := refreshTestToken(t, cfg, token); code != http.StatusUnauthorized {
+			t.Errorf("%v: status = %d, want %d", token, code, http.StatusUnauthorized)
+		}
+	}
+	if rt, _ := cfg.db.GetRefreshToken(expired.Token); rt.RevokedAt != nil {
+		t.Error("an expired token was treated as reused")
+	}
+}
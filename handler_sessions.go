@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+)
+
+const maxUserAgentLength = 512
+
+// clientInfo describes the client making r for the session list. The
+// address is the direct peer; proxy headers are not trusted.
+func clientInfo(r *http.Request) (userAgent, ipAddress string) {
+	userAgent = r.UserAgent()
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+	ipAddress, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ipAddress = r.RemoteAddr
+	}
+	return userAgent, ipAddress
+}
+
+func (cfg *apiConfig) handlerSessionsList(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticateUser(w, r, auth.ScopeAccount)
+	if !ok {
+		return
+	}
+
+	sessions, err := cfg.db.GetSessions(userID, time.Now())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get sessions", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, sessions)
+}
+
+func (cfg *apiConfig) handlerSessionRevoke(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticateUser(w, r, auth.ScopeAccount)
+	if !ok {
+		return
+	}
+
+	revoked, err := cfg.db.RevokeSession(userID, r.PathValue("sessionID"))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke session", err)
+		return
+	}
+	if !revoked {
+		respondWithError(w, http.StatusNotFound, "Session not found", nil)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerSessionsRevokeOthers signs the user out everywhere except the
+// session that refresh_token belongs to. Without it, every session ends.
+func (cfg *apiConfig) handlerSessionsRevokeOthers(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	userID, ok := cfg.authenticateUser(w, r, auth.ScopeAccount)
+	if !ok {
+		return
+	}
+
+	params := parameters{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil && !errors.Is(err, io.EOF) {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	keepID := ""
+	if params.RefreshToken != "" {
+		current, err := cfg.db.GetRefreshToken(params.RefreshToken)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get refresh token", err)
+			return
+		}
+		if current.Token == "" || current.UserID != userID {
+			respondWithError(w, http.StatusBadRequest, "refresh_token doesn't belong to this user", nil)
+			return
+		}
+		keepID = current.FamilyID
+	}
+
+	if err := cfg.db.RevokeOtherSessions(userID, keepID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke sessions", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
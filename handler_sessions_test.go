@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+func listTestSessions(t *testing.T, cfg *apiConfig, token string) []database.Session {
+	t.Helper()
+	rec := serveTestRequest("GET /api/sessions", cfg.handlerSessionsList, http.MethodGet, "/api/sessions", "Bearer "+token, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("list sessions: status = %d, body %s", rec.Code, rec.Body)
+	}
+	var sessions []database.Session
+	if err := json.NewDecoder(rec.Body).Decode(&sessions); err != nil {
+		t.Fatal(err)
+	}
+	return sessions
+}
+
+func TestSessionRevoke(t *testing.T) {
+	cfg := newTestConfig(t)
+	user, token := newTestUser(t, cfg, "user@example.com")
+	other, _ := newTestUser(t, cfg, "other@example.com")
+	session := newTestRefreshToken(t, cfg, user, "mine", time.Now().Add(time.Hour))
+	otherSession := newTestRefreshToken(t, cfg, other, "theirs", time.Now().Add(time.Hour))
+
+	sessions := listTestSessions(t, cfg, token)
+	if len(sessions) != 1 || sessions[0].ID != session.FamilyID {
+		t.Fatalf("sessions = %+v, want only the user's own", sessions)
+	}
+	if sessions[0].ID == session.Token {
+		t.Error("session ID is the refresh token")
+	}
+
+	revoke := func(sessionID string) int {
+		rec := serveTestRequest("DELETE /api/sessions/{sessionID}", cfg.handlerSessionRevoke,
+			http.MethodDelete, "/api/sessions/"+sessionID, "Bearer "+token, nil)
+		return rec.Code
+	}
+	if code := revoke(otherSession.FamilyID); code != http.StatusNotFound {
+		t.Errorf("another user's session: status = %d, want %d", code, http.StatusNotFound)
+	}
+	if rt, _ := cfg.db.GetRefreshToken(otherSession.Token); rt.RevokedAt != nil {
+		t.Error("another user's session was revoked")
+	}
+	if code := revoke(session.FamilyID); code != http.StatusNoContent {
+		t.Fatalf("own session: status = %d, want %d", code, http.StatusNoContent)
+	}
+	if code := revoke(session.FamilyID); code != http.StatusNotFound {
+		t.Errorf("revoked session: status = %d, want %d", code, http.StatusNotFound)
+	}
+	if sessions := listTestSessions(t, cfg, token); len(sessions) != 0 {
+		t.Errorf("sessions after revoking = %+v", sessions)
+	}
+}
+
+func TestSessionsRevokeOthers(t *testing.T) {
+	cfg := newTestConfig(t)
+	user, token := newTestUser(t, cfg, "user@example.com")
+	other, _ := newTestUser(t, cfg, "other@example.com")
+	current := newTestRefreshToken(t, cfg, user, "current", time.Now().Add(time.Hour))
+	newTestRefreshToken(t, cfg, user, "stale", time.Now().Add(time.Hour))
+	otherSession := newTestRefreshToken(t, cfg, other, "theirs", time.Now().Add(time.Hour))
+
+	revokeOthers := func(refreshToken string) int {
+		body := fmt.Sprintf(`{"refresh_token": %q}`, refreshToken)
+		rec := serveTestRequest("POST /api/sessions/revoke_others", cfg.handlerSessionsRevokeOthers,
+			http.MethodPost, "/api/sessions/revoke_others", "Bearer "+token, strings.NewReader(body))
+		return rec.Code
+	}
+
+	if code := revokeOthers(otherSession.Token); code != http.StatusBadRequest {
+		t.Errorf("another user's refresh token: status = %d, want %d", code, http.StatusBadRequest)
+	}
+	if sessions := listTestSessions(t, cfg, token); len(sessions) != 2 {
+		t.Fatalf("a rejected request revoked sessions: %+v", sessions)
+	}
+
+	if code := revokeOthers(current.Token); code != http.StatusNoContent {
+		t.Fatalf("status = %d, want %d", code, http.StatusNoContent)
+	}
+	if sessions := listTestSessions(t, cfg, token); len(sessions) != 1 || sessions[0].ID != current.FamilyID {
+		t.Errorf("sessions = %+v, want only the current one", sessions)
+	}
+	if rt, _ := cfg.db.GetRefreshToken(otherSession.Token); rt.RevokedAt != nil {
+		t.Error("another user's session was revoked")
+	}
+
+	if code := revokeOthers(""); code != http.StatusNoContent {
+		t.Fatalf("without a refresh token: status = %d, want %d", code, http.StatusNoContent)
+	}
+	if sessions := listTestSessions(t, cfg, token); len(sessions) != 0 {
+		t.Errorf("sessions = %+v, want all revoked", sessions)
+	}
+}
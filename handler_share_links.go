@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	shareLinkDefaultExpiry = 7 * 24 * time.Hour
+	shareLinkMaxExpiry     = 90 * 24 * time.Hour
+)
+
+type shareLinkResponse struct {
+	database.ShareLink
+	HasPassword bool `json:"has_password"`
+}
+
+func newShareLinkResponse(link database.ShareLink) shareLinkResponse {
+	return shareLinkResponse{
+		ShareLink:   link,
+		HasPassword: link.PasswordHash != nil,
+	}
+}
+
+func (cfg *apiConfig) handlerShareLinkCreate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		ExpiresInSeconds int    `json:"expires_in_seconds"`
+		MaxViews         *int   `json:"max_views"`
+		Password         string `json:"password"`
+	}
+
+	video, ok := cfg.authorizeVideoOwner(w, r)
+	if !ok {
+		return
+	}
+
+	params := parameters{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil && !errors.Is(err, io.EOF) {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	expiresIn := shareLinkDefaultExpiry
+	if params.ExpiresInSeconds != 0 {
+		expiresIn = time.Duration(params.ExpiresInSeconds) * time.Second
+	}
+	if expiresIn <= 0 || expiresIn > shareLinkMaxExpiry {
+		respondWithError(w, http.StatusBadRequest, "expires_in_seconds must be positive and at most 90 days", nil)
+		return
+	}
+	if params.MaxViews != nil && *params.MaxViews < 1 {
+		respondWithError(w, http.StatusBadRequest, "max_views must be at least 1", nil)
+		return
+	}
+
+	var passwordHash *string
+	if params.Password != "" {
+		hash, err := auth.HashPassword(params.Password)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't hash password", err)
+			return
+		}
+		passwordHash = &hash
+	}
+
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create share token", err)
+		return
+	}
+	expiresAt := time.Now().UTC().Add(expiresIn)
+
+	link, err := cfg.db.CreateShareLink(database.CreateShareLinkParams{
+		Token:        token,
+		VideoID:      video.ID,
+		ExpiresAt:    &expiresAt,
+		MaxViews:     params.MaxViews,
+		PasswordHash: passwordHash,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create share link", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, newShareLinkResponse(link))
+}
+
+func (cfg *apiConfig) handlerShareLinksList(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.authorizeVideoOwner(w, r)
+	if !ok {
+		return
+	}
+
+	links, err := cfg.db.GetShareLinks(video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get share links", err)
+		return
+	}
+
+	response := make([]shareLinkResponse, 0, len(links))
+	for _, link := range links {
+		response = append(response, newShareLinkResponse(link))
+	}
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (cfg *apiConfig) handlerShareLinkRevoke(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.authorizeVideoOwner(w, r)
+	if !ok {
+		return
+	}
+
+	linkID, err := uuid.Parse(r.PathValue("linkID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid share link ID", err)
+		return
+	}
+	link, err := cfg.db.GetShareLink(linkID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get share link", err)
+		return
+	}
+	if link.VideoID != video.ID {
+		respondWithError(w, http.StatusNotFound, "Share link not found", nil)
+		return
+	}
+
+	if err := cfg.db.RevokeShareLink(link.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke share link", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerShareLinkResolve exchanges a share token, and its password if it
+// has one, for the video with signed playback URLs. Each successful call
+// counts as a view.
+func (cfg *apiConfig) handlerShareLinkResolve(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Password string `json:"password"`
+	}
+
+	params := parameters{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil && !errors.Is(err, io.EOF) {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	link, err := cfg.db.GetShareLinkByToken(r.PathValue("token"))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get share link", err)
+		return
+	}
+	if link.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Share link not found", nil)
+		return
+	}
+
+	// Checked before the password, an expired link says so whatever
+	// password comes with it.
+	if !link.Usable(time.Now()) {
+		respondWithError(w, http.StatusGone, "Share link has expired", nil)
+		return
+	}
+	if link.PasswordHash != nil {
+		match, err := auth.CheckPasswordHash(params.Password, *link.PasswordHash)
+		if err != nil || !match {
+			respondWithError(w, http.StatusUnauthorized, "Incorrect share link password", err)
+			return
+		}
+	}
+
+	used, err := cfg.db.UseShareLink(link.ID, time.Now())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't use share link", err)
+		return
+	}
+	if !used {
+		respondWithError(w, http.StatusGone, "Share link has expired", nil)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(link.VideoID)
+	if err != nil || video.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Video not found", err)
+		return
+	}
+
+	cfg.respondWithVideo(w, r, http.StatusOK, video)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+func createTestShareLink(t *testing.T, cfg *apiConfig, video database.Video, token, body string) shareLinkResponse {
+	t.Helper()
+	rec := serveTestRequest("POST /api/videos/{videoID}/share_links", cfg.handlerShareLinkCreate,
+		http.MethodPost, fmt.Sprintf("/api/videos/%v/share_links", video.ID), "Bearer "+token, strings.NewReader(body))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create share link: status = %d, body %s", rec.Code, rec.Body)
+	}
+	var link shareLinkResponse
+	if err := json.NewDecoder(rec.Body).Decode(&link); err != nil {
+		t.Fatal(err)
+	}
+	return link
+}
+
+func resolveTestShareLink(cfg *apiConfig, token, password string) int {
+	body := fmt.Sprintf(`{"password": %q}`, password)
+	rec := serveTestRequest("POST /api/share/{token}", cfg.handlerShareLinkResolve,
+		http.MethodPost, "/api/share/"+token, "", strings.NewReader(body))
+	return rec.Code
+}
+
+func TestShareLinkResolve(t *testing.T) {
+	cfg := newTestConfig(t)
+	owner, token := newTestUser(t, cfg, "owner@example.com")
+	video := newTestVideo(t, cfg, owner)
+	link := createTestShareLink(t, cfg, video, token, `{"max_views": 1, "password": "hunter2"}`)
+	if !link.HasPassword || link.MaxViews == nil || *link.MaxViews != 1 {
+		t.Fatalf("created link = %+v", link)
+	}
+
+	if code := resolveTestShareLink(cfg, link.Token, "wrong"); code != http.StatusUnauthorized {
+		t.Errorf("wrong password: status = %d, want %d", code, http.StatusUnauthorized)
+	}
+	if code := resolveTestShareLink(cfg, link.Token, "hunter2"); code != http.StatusOK {
+		t.Errorf("right password: status = %d, want %d", code, http.StatusOK)
+	}
+	for _, password := range []string{"hunter2", "wrong"} {
+		if code := resolveTestShareLink(cfg, link.Token, password); code != http.StatusGone {
+			t.Errorf("out of views with %q: status = %d, want %d", password, code, http.StatusGone)
+		}
+	}
+
+	stored, err := cfg.db.GetShareLink(link.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.ViewCount != 1 {
+		t.Errorf("ViewCount = %d, want only the successful view counted", stored.ViewCount)
+	}
+
+	if code := resolveTestShareLink(cfg, "unknown", ""); code != http.StatusNotFound {
+		t.Errorf("unknown token: status = %d, want %d", code, http.StatusNotFound)
+	}
+}
+
+func TestShareLinkResolveExpired(t *testing.T) {
+	cfg := newTestConfig(t)
+	owner, _ := newTestUser(t, cfg, "owner@example.com")
+	video := newTestVideo(t, cfg, owner)
+	hash := "not a bcrypt hash"
+	expiresAt := time.Now().Add(-time.Minute)
+	link, err := cfg.db.CreateShareLink(database.CreateShareLinkParams{
+		Token:        "expired",
+		VideoID:      video.ID,
+		ExpiresAt:    &expiresAt,
+		PasswordHash: &hash,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if code := resolveTestShareLink(cfg, link.Token, "wrong"); code != http.StatusGone {
+		t.Errorf("status = %d, want %d before the password is checked", code, http.StatusGone)
+	}
+}
+
+func TestShareLinkRevoke(t *testing.T) {
+	cfg := newTestConfig(t)
+	owner, token := newTestUser(t, cfg, "owner@example.com")
+	_, otherToken := newTestUser(t, cfg, "other@example.com")
+	video := newTestVideo(t, cfg, owner)
+	link := createTestShareLink(t, cfg, video, token, "")
+
+	revoke := func(authorization string) int {
+		rec := serveTestRequest("DELETE /api/videos/{videoID}/share_links/{linkID}", cfg.handlerShareLinkRevoke,
+			http.MethodDelete, fmt.Sprintf("/api/videos/%v/share_links/%v", video.ID, link.ID), authorization, nil)
+		return rec.Code
+	}
+	if code := revoke("Bearer " + otherToken); code != http.StatusUnauthorized {
+		t.Errorf("other user: status = %d, want %d", code, http.StatusUnauthorized)
+	}
+	if code := resolveTestShareLink(cfg, link.Token, ""); code != http.StatusOK {
+		t.Fatalf("before revoking: status = %d, want %d", code, http.StatusOK)
+	}
+	if code := revoke("Bearer " + token); code != http.StatusNoContent {
+		t.Fatalf("owner: status = %d, want %d", code, http.StatusNoContent)
+	}
+	if code := resolveTestShareLink(cfg, link.Token, ""); code != http.StatusGone {
+		t.Errorf("after revoking: status = %d, want %d", code, http.StatusGone)
+	}
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// Resumable uploads implement the core tus 1.0.0 protocol plus the
+// creation and termination extensions (https://tus.io/protocols/resumable-upload).
+// Each video has at most one upload in progress, addressed by its ID.
+
+const (
+	tusVersion       = "1.0.0"
+	tusMaxSize       = 10 << 30
+	tusOffsetContent = "application/offset+octet-stream"
+)
+
+// uploadLocks stops two requests from creating, appending to or
+// terminating the same upload at once.
+type uploadLocks struct {
+	mu     sync.Mutex
+	active map[uuid.UUID]bool
+}
+
+func newUploadLocks() *uploadLocks {
+	return &uploadLocks{active: map[uuid.UUID]bool{}}
+}
+
+func (l *uploadLocks) tryLock(id uuid.UUID) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.active[id] {
+		return false
+	}
+	l.active[id] = true
+	return true
+}
+
+func (l *uploadLocks) unlock(id uuid.UUID) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.active, id)
+}
+
+func (cfg *apiConfig) handlerTusOptions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.Header().Set("Tus-Version", tusVersion)
+	w.Header().Set("Tus-Extension", "creation,termination")
+	w.Header().Set("Tus-Max-Size", strconv.Itoa(tusMaxSize))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerTusCreate(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.authorizeTusRequest(w, r)
+	if !ok {
+		return
+	}
+
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length <= 0 {
+		respondWithError(w, http.StatusBadRequest, "invalid Upload-Length", err)
+		return
+	}
+	if length > tusMaxSize {
+		respondWithError(w, http.StatusRequestEntityTooLarge, "upload too large", nil)
+		return
+	}
+
+	metadata := parseTusMetadata(r.Header.Get("Upload-Metadata"))
+	mimeType, _, err := mime.ParseMediaType(metadata["filetype"])
+	if _, ok := videoUploadTypes[mimeType]; !ok {
+		respondWithError(w, http.StatusBadRequest, "wrong file format", err)
+		return
+	}
+
+	// Creating replaces the .part file a running PATCH may be writing to.
+	if !cfg.uploadLocks.tryLock(video.ID) {
+		respondWithError(w, http.StatusLocked, "upload is already in progress", nil)
+		return
+	}
+	defer cfg.uploadLocks.unlock(video.ID)
+
+	if previous, err := cfg.db.GetVideoUpload(video.ID); err == nil && previous.FilePath != "" {
+		os.Remove(previous.FilePath)
+	}
+
+	filePath := filepath.Join(cfg.uploadsRoot, video.ID.String()+".part")
+	file, err := os.Create(filePath)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "can't create upload file", err)
+		return
+	}
+	file.Close()
+
+	_, err = cfg.db.CreateVideoUpload(database.CreateVideoUploadParams{
+		VideoID:  video.ID,
+		UserID:   video.UserID,
+		Length:   length,
+		MimeType: mimeType,
+		FilePath: filePath,
+	})
+	if err != nil {
+		os.Remove(filePath)
+		respondWithError(w, http.StatusInternalServerError, "couldn't create upload", err)
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/api/tus/%v", video.ID))
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (cfg *apiConfig) handlerTusHead(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.authorizeTusRequest(w, r)
+	if !ok {
+		return
+	}
+
+	upload, err := cfg.db.GetVideoUpload(video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't get upload", err)
+		return
+	}
+	if upload.VideoID == uuid.Nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	w.WriteHeader(http.StatusOK)
+}
+
+func (cfg *apiConfig) handlerTusPatch(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.authorizeTusRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if r.Header.Get("Content-Type") != tusOffsetContent {
+		respondWithError(w, http.StatusUnsupportedMediaType, "Content-Type must be "+tusOffsetContent, nil)
+		return
+	}
+
+	if !cfg.uploadLocks.tryLock(video.ID) {
+		respondWithError(w, http.StatusLocked, "upload is already in progress", nil)
+		return
+	}
+	defer cfg.uploadLocks.unlock(video.ID)
+
+	upload, err := cfg.db.GetVideoUpload(video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't get upload", err)
+		return
+	}
+	if upload.VideoID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "upload not found", nil)
+		return
+	}
+
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset != upload.Offset {
+		respondWithError(w, http.StatusConflict, "Upload-Offset doesn't match", err)
+		return
+	}
+
+	file, err := os.OpenFile(upload.FilePath, os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "can't open upload file", err)
+		return
+	}
+	defer file.Close()
+
+	// Bytes past the recorded offset may be left over from a request that
+	// was cut off before the offset was saved, so drop them.
+	if err := file.Truncate(upload.Offset); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "can't truncate upload file", err)
+		return
+	}
+	if _, err := file.Seek(upload.Offset, io.SeekStart); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "can't seek upload file", err)
+		return
+	}
+
+	written, copyErr := io.Copy(file, io.LimitReader(r.Body, upload.Length-upload.Offset))
+	if err := file.Sync(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "can't sync upload file", err)
+		return
+	}
+	upload.Offset += written
+	if err := cfg.db.UpdateVideoUploadOffset(video.ID, upload.Offset); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't save upload offset", err)
+		return
+	}
+	if copyErr != nil {
+		respondWithError(w, http.StatusInternalServerError, "upload interrupted", copyErr)
+		return
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+
+	if upload.Offset == upload.Length {
+		// Move the file out of the way so a new upload for the same video
+		// can't overwrite it while it waits in the queue.
+		queuedPath := filepath.Join(cfg.uploadsRoot, fmt.Sprintf("%v-%v.%v", video.ID, uuid.New(), videoUploadTypes[upload.MimeType]))
+		if err := os.Rename(upload.FilePath, queuedPath); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "couldn't finish upload", err)
+			return
+		}
+		if err := cfg.db.DeleteVideoUpload(video.ID); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "couldn't finish upload", err)
+			return
+		}
+		if _, err := validateVideoFile(queuedPath, upload.MimeType); err != nil {
+			os.Remove(queuedPath)
+			if isInvalidMedia(err) {
+				respondWithError(w, http.StatusBadRequest, err.Error(), err)
+				return
+			}
+			respondWithError(w, http.StatusInternalServerError, "couldn't validate video", err)
+			return
+		}
+		_, err := cfg.enqueueVideoProcessing(video.ID, processVideoPayload{
+			FilePath: queuedPath,
+			MimeType: upload.MimeType,
+		})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "couldn't queue video processing", err)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerTusDelete(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.authorizeTusRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if !cfg.uploadLocks.tryLock(video.ID) {
+		respondWithError(w, http.StatusLocked, "upload is already in progress", nil)
+		return
+	}
+	defer cfg.uploadLocks.unlock(video.ID)
+
+	upload, err := cfg.db.GetVideoUpload(video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't get upload", err)
+		return
+	}
+	if upload.VideoID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "upload not found", nil)
+		return
+	}
+
+	if err := cfg.db.DeleteVideoUpload(video.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't delete upload", err)
+		return
+	}
+	os.Remove(upload.FilePath)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// authorizeTusRequest checks the tus version before the usual ownership
+// check, writing the error response itself when either fails.
+func (cfg *apiConfig) authorizeTusRequest(w http.ResponseWriter, r *http.Request) (database.Video, bool) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	if r.Header.Get("Tus-Resumable") != tusVersion {
+		w.Header().Set("Tus-Version", tusVersion)
+		respondWithError(w, http.StatusPreconditionFailed, "unsupported tus version", nil)
+		return database.Video{}, false
+	}
+
+	return cfg.authorizeVideoOwner(w, r)
+}
+
+// parseTusMetadata decodes an Upload-Metadata header, a comma separated
+// list of keys each followed by an optional base64 encoded value.
+func parseTusMetadata(header string) map[string]string {
+	metadata := map[string]string{}
+	for _, pair := range strings.Split(header, ",") {
+		fields := strings.Fields(pair)
+		if len(fields) == 0 {
+			continue
+		}
+		value := ""
+		if len(fields) > 1 {
+			decoded, err := base64.StdEncoding.DecodeString(fields[1])
+			if err != nil {
+				continue
+			}
+			value = string(decoded)
+		}
+		metadata[fields[0]] = value
+	}
+	return metadata
+}
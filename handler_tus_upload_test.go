@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestParseTusMetadata(t *testing.T) {
+	metadata := parseTusMetadata("filename Ym9vdHMubXA0,filetype dmlkZW8vbXA0, is_confidential")
+	if metadata["filename"] != "boots.mp4" {
+		t.Fatalf("want: boots.mp4, got: %v\n", metadata["filename"])
+	}
+	if metadata["filetype"] != "video/mp4" {
+		t.Fatalf("want: video/mp4, got: %v\n", metadata["filetype"])
+	}
+	if _, ok := metadata["is_confidential"]; !ok {
+		t.Fatalf("want key without value to be present")
+	}
+}
+
+func TestUploadLocks(t *testing.T) {
+	locks := newUploadLocks()
+	id := uuid.New()
+	if !locks.tryLock(id) {
+		t.Fatalf("want first lock to succeed")
+	}
+	if locks.tryLock(id) {
+		t.Fatalf("want second lock to fail")
+	}
+	locks.unlock(id)
+	if !locks.tryLock(id) {
+		t.Fatalf("want lock after unlock to succeed")
+	}
+}
@@ -1,16 +1,14 @@
 package main
 
 import (
-	"crypto/rand"
-	b64 "encoding/base64"
+	"bytes"
 	"fmt"
+	"image"
 	"io"
 	"log"
 	"mime"
 	"net/http"
 	"os"
-	"path/filepath"
-	"strings"
 
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
 	"github.com/google/uuid"
@@ -24,84 +22,98 @@ func (cfg *apiConfig) handlerUploadThumbnail(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
-		return
-	}
-
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+	userID, ok := cfg.authenticateUser(w, r, auth.ScopeVideosWrite)
+	if !ok {
 		return
 	}
 
 	fmt.Println("uploading thumbnail for video", videoID, "by user", userID)
 
-	// TODO: implement the upload here
 	const maxMemory = 10 << 20
+	r.Body = http.MaxBytesReader(w, r.Body, maxMemory)
 	if err := r.ParseMultipartForm(maxMemory); err != nil {
-		log.Printf("ParseMultipartForm returned err: %v", err)
+		respondWithError(w, http.StatusBadRequest, "couldn't parse form", err)
+		return
 	}
 
-	data, headers, err := r.FormFile("thumbnail")
+	file, headers, err := r.FormFile("thumbnail")
 	if err != nil {
-		log.Printf("FormFile returned err: %v", err)
+		respondWithError(w, http.StatusBadRequest, "couldn't find thumbnail", err)
+		return
 	}
+	defer file.Close()
 
 	mediaType := headers.Header.Get("Content-Type")
-	mimeType, params, err := mime.ParseMediaType(mediaType)
+	declaredType, _, err := mime.ParseMediaType(mediaType)
 	if err != nil {
-		log.Printf("ParseMediaType returned err: %v", err)
+		respondWithError(w, http.StatusBadRequest, "invalid Content-Type", err)
+		return
 	}
 
-	fmt.Printf("mediaType: %v, mimeType: %v\nparams: %v\n", mediaType, mimeType, params)
-	if mimeType != "image/jpeg" && mimeType != "image/png" {
-		respondWithError(w, http.StatusBadRequest, "unsupported file format", nil)
+	data, err := io.ReadAll(file)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "couldn't read thumbnail", err)
+		return
+	}
+
+	mimeType, err := validateImage(data, declaredType)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
 		return
 	}
 
 	video, err := cfg.db.GetVideo(videoID)
 	if err != nil {
-		log.Printf("GetVideo returned err: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "couldn't get video", err)
+		return
 	}
 
 	if userID != video.UserID {
 		respondWithError(w, http.StatusUnauthorized, "unauthorized", nil)
-		fmt.Printf("expected: %v\ngot: %v\n", userID, video.UserID)
 		return
 	}
 
-	splitString := strings.Split(mediaType, "/")
-	fileExtension := splitString[1]
-
-	key := make([]byte, 32)
-	randByte, _ := rand.Read(key)
-	fmt.Printf("Read returned v% bytes", randByte)
-	randString := b64.RawURLEncoding.EncodeToString(key)
-
-	filePath := fmt.Sprintf("%v.%v", randString, fileExtension)
-	assetsRoot := cfg.assetsRoot
-	completePath := filepath.Join(assetsRoot, filePath)
-
-	newFile, err := os.Create(completePath)
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
 	if err != nil {
-		log.Printf("os.Create returned err: %v", err)
+		respondWithError(w, http.StatusBadRequest, "couldn't decode image", err)
+		return
 	}
 
-	bytesWritten, err := io.Copy(newFile, data)
+	sourceFile, err := os.CreateTemp("", "tubely-thumbnail-*."+thumbnailExtensions[mimeType])
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "can't make temp file", err)
+		return
+	}
+	defer os.Remove(sourceFile.Name())
+	_, err = sourceFile.Write(data)
+	sourceFile.Close()
 	if err != nil {
-		log.Printf("io.Copy returned err: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "can't write temp file", err)
+		return
 	}
-	fmt.Printf("copied %d bytes\n", bytesWritten)
 
-	thumbnailURL := fmt.Sprintf("http://localhost:%v/assets/%v", cfg.port, filePath)
-	fmt.Printf("thumbnailURL: %v", thumbnailURL)
+	thumbnailKey, variants, err := cfg.storeThumbnailVariants(r.Context(), videoID, sourceFile.Name(), config.Width, config.Height)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't store thumbnail", err)
+		return
+	}
 
-	video.ThumbnailURL = &thumbnailURL
-	if err := cfg.db.UpdateVideo(video); err != nil {
-		fmt.Printf("UpdateVideo returned err: %v", err)
+	video.ThumbnailURL = &thumbnailKey
+	video.Thumbnails = variants
+	setThumbnailPlaceholders(&video, sourceFile.Name())
+	if err := cfg.db.SetVideoThumbnail(video); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't update video", err)
+		return
+	}
+	if err := cfg.deleteOtherThumbnails(r.Context(), videoID, thumbnailKey); err != nil {
+		log.Printf("couldn't delete old thumbnails of %v: %v", videoID, err)
 	}
 
-	respondWithJSON(w, http.StatusOK, video)
+	// Other columns may have changed while the variants were encoded.
+	video, err = cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't get video", err)
+		return
+	}
+	cfg.respondWithVideo(w, r, http.StatusOK, video)
 }
@@ -2,8 +2,7 @@ package main
 
 import (
 	"bytes"
-	"crypto/rand"
-	"encoding/hex"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -12,8 +11,8 @@ import (
 	"net/http"
 	"os"
 	"os/exec"
+	"strings"
 
-	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
 	"github.com/google/uuid"
 )
@@ -29,15 +28,8 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "couldn't find JWT", err)
-		return
-	}
-
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "couldn't validate JWT", err)
+	userID, ok := cfg.authenticateUser(w, r, auth.ScopeVideosWrite)
+	if !ok {
 		return
 	}
 
@@ -61,92 +53,84 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 
 	mediaType := headers.Header.Get("Content-Type")
 	mimeType, _, err := mime.ParseMediaType(mediaType)
-	if mimeType != "video/mp4" {
+	extension, ok := videoUploadTypes[mimeType]
+	if !ok {
 		respondWithError(w, http.StatusBadRequest, "wrong file format", err)
 		return
 	}
 
-	tempName := "tubely-upload.mp4"
-	file, err := os.CreateTemp("", tempName)
+	// The upload is kept in uploadsRoot rather than the system temp dir so
+	// the queued job can still find it after a restart.
+	file, err := os.CreateTemp(cfg.uploadsRoot, "tubely-upload-*."+extension)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "can't make temp file", err)
 		return
 	}
-	defer os.Remove(file.Name())
 	defer file.Close()
 
 	bytesCopied, err := io.Copy(file, data)
 	if err != nil {
+		os.Remove(file.Name())
 		respondWithError(w, http.StatusInternalServerError, "io.Copy returned err:", err)
 		return
 	}
 	fmt.Printf("copied %d bytes\n", bytesCopied)
 
-	processedFilePath, err := processVideoForFastStart(file.Name())
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "can't process video", err)
+	if _, err := validateVideoFile(file.Name(), mimeType); err != nil {
+		os.Remove(file.Name())
+		if isInvalidMedia(err) {
+			respondWithError(w, http.StatusBadRequest, err.Error(), err)
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "couldn't validate video", err)
 		return
 	}
 
-	prefix, err := getVideoAspectRatio(file.Name())
-	if err != nil {
-		fmt.Printf("aspectRatio: %v", prefix)
-		respondWithError(w, http.StatusInternalServerError, "couldn't get aspectRatio", err)
-	}
-
-	processedFile, err := os.Open(processedFilePath)
+	queuedVideo, err := cfg.enqueueVideoProcessing(videoID, processVideoPayload{
+		FilePath: file.Name(),
+		MimeType: mimeType,
+	})
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "can't open processed file", err)
+		os.Remove(file.Name())
+		respondWithError(w, http.StatusInternalServerError, "couldn't queue video processing", err)
 		return
 	}
-	defer os.Remove(processedFilePath)
-	defer processedFile.Close()
 
-	if _, err := file.Seek(0, io.SeekStart); err != nil {
-		respondWithError(w, http.StatusInternalServerError, "couldn't reset file pointer", err)
-		return
-	}
+	cfg.respondWithVideo(w, r, http.StatusAccepted, queuedVideo)
+}
 
-	key := make([]byte, 32)
-	rand.Read(key)
-	strKey := hex.EncodeToString(key)
-	fileKey := fmt.Sprintf("%s/%s.mp4", prefix, strKey)
+// publishedVideoKey is where the MP4 produced by jobID is stored. Retries of
+// the job write the same key instead of leaving copies behind.
+func publishedVideoKey(videoID, jobID uuid.UUID, aspectRatio string) string {
+	return fmt.Sprintf("%vvideo/%v/%v.mp4", videoPrefix(videoID), aspectRatio, strings.ReplaceAll(jobID.String(), "-", ""))
+}
 
-	objectParams := &s3.PutObjectInput{
-		Bucket:      &cfg.s3Bucket,
-		Key:         &fileKey,
-		Body:        processedFile,
-		ContentType: &mimeType,
+// publishVideo runs an uploaded file through the faststart and aspect ratio
+// pipeline and stores the result for the job, returning its key.
+func (cfg *apiConfig) publishVideo(ctx context.Context, videoID, jobID uuid.UUID, filePath, mimeType string) (string, error) {
+	processedFilePath, err := processVideoForFastStart(filePath)
+	if err != nil {
+		return "", fmt.Errorf("can't process video: %w", err)
 	}
+	defer os.Remove(processedFilePath)
 
-	if _, err := cfg.s3Client.PutObject(r.Context(), objectParams); err != nil {
-		respondWithError(w, http.StatusInternalServerError, "writesomethinghere", err)
-		return
+	prefix, err := getVideoAspectRatio(filePath)
+	if err != nil {
+		return "", fmt.Errorf("couldn't get aspectRatio: %w", err)
 	}
 
-	dbVideo, err := cfg.db.GetVideo(videoID)
+	processedFile, err := os.Open(processedFilePath)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "somethingelse", err)
-		return
+		return "", fmt.Errorf("can't open processed file: %w", err)
 	}
+	defer processedFile.Close()
 
-	// e videoURL := fmt.Sprintf("https://%v.s3.%v.amazonaws.com/%v", cfg.s3Bucket, cfg.s3Region, fileKey)
-
-	// HACK: Is this correct?
-	videoURL := fmt.Sprintf("%v/%v", cfg.s3CfDistribution, fileKey)
-	fmt.Println(videoURL)
-
-	dbVideo.VideoURL = &videoURL
-
-	// signedVideo, err := cfg.dbVideoToSignedVideo(dbVideo)
-	// if err != nil {
-	// }
+	fileKey := publishedVideoKey(videoID, jobID, prefix)
 
-	// if err := cfg.db.UpdateVideo(dbVideo); err != nil {
-	if err := cfg.db.UpdateVideo(dbVideo); err != nil {
-		respondWithError(w, http.StatusInternalServerError, "couldn't update videoURL", err)
-		return
+	if err := cfg.store.Put(ctx, fileKey, processedFile, mimeType); err != nil {
+		return "", fmt.Errorf("couldn't store video: %w", err)
 	}
+	return fileKey, nil
 }
 
 func getVideoAspectRatio(filePath string) (string, error) {
@@ -196,53 +180,3 @@ func processVideoForFastStart(filePath string) (string, error) {
 	}
 	return outputFilePath, nil
 }
-
-// func generatePresignedURL(s3Client *s3.Client, bucket, key string, expireTime time.Duration) (string, error) {
-// 	client := s3.NewPresignClient(s3Client)
-//
-// 	getObjectArgs := s3.GetObjectInput{
-// 		Bucket: &bucket,
-// 		Key:    &key,
-// 	}
-//
-// 	res, err := client.PresignGetObject(context.Background(), &getObjectArgs, s3.WithPresignExpires(expireTime))
-// 	if err != nil {
-// 		return "", fmt.Errorf("PresignGetObject err: %v", err)
-// 	}
-//
-// 	fmt.Printf("request: %v", res.URL)
-// 	return res.URL, nil
-// }
-//
-// func (cfg *apiConfig) dbVideoToSignedVideo(video database.Video) (database.Video, error) {
-// 	fmt.Printf("before VideoURL: %v", video.VideoURL)
-//
-// 	videoURL := video.VideoURL
-//
-// 	if videoURL == nil {
-// 		fmt.Println("empty video address")
-// 		return video, nil
-// 	}
-// 	if len(*videoURL) == 0 {
-// 		fmt.Println("empty videoURL")
-// 		return video, nil
-// 	}
-// 	if ok := strings.Contains(*videoURL, ","); !ok {
-// 		fmt.Println("no comma")
-// 		return video, nil
-// 	}
-//
-// 	bucketKey := strings.Split(*videoURL, ",")
-// 	bucket := bucketKey[0]
-// 	key := bucketKey[1]
-//
-// 	presignedURL, err := generatePresignedURL(cfg.s3Client, bucket, key, time.Hour) // HACK:time.Duration?
-// 	if err != nil {
-// 		return database.Video{}, fmt.Errorf("generatePresignedURL err: %v", err)
-// 	}
-//
-// 	video.VideoURL = &presignedURL
-// 	fmt.Printf("after VideoURL: %v", video.VideoURL)
-//
-// 	return video, nil
-// }
@@ -1,7 +1,13 @@
 package main
 
 import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+
+	"github.com/google/uuid"
 )
 
 func TestGetVideoAspectRatio_horizontal(t *testing.T) {
@@ -46,3 +52,38 @@ func TestGetVideoAspectRatio_other(t *testing.T) {
 // 		t.Fatalf("want: 16:9, got %v\n", aspectRatio)
 // 	}
 // }
+
+func TestPublishVideo(t *testing.T) {
+	fakeTool(t, "ffprobe", `echo '{"streams":[{"codec_type":"video","width":1280,"height":720}]}'`)
+	fakeTool(t, "ffmpeg", `for arg; do out="$arg"; done; cp "$2" "$out"`)
+	cfg := newTestConfig(t)
+	videoID, jobID := uuid.New(), uuid.New()
+	filePath := filepath.Join(t.TempDir(), "upload.mp4")
+	if err := os.WriteFile(filePath, []byte("video"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := cfg.publishVideo(context.Background(), videoID, jobID, filePath, "video/mp4")
+	if err != nil {
+		t.Fatalf("publishVideo() err = %v", err)
+	}
+	if !strings.HasPrefix(key, videoPrefix(videoID)+"video/landscape/") || !strings.HasSuffix(key, ".mp4") {
+		t.Errorf("key = %q, want a landscape MP4 under the video's prefix", key)
+	}
+	if _, err := cfg.store.Stat(context.Background(), key); err != nil {
+		t.Errorf("published video not stored: %v", err)
+	}
+
+	// A retry of the same job overwrites its own output.
+	retried, err := cfg.publishVideo(context.Background(), videoID, jobID, filePath, "video/mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	objects, err := cfg.store.List(context.Background(), videoPrefix(videoID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retried != key || len(objects) != 1 {
+		t.Errorf("retry stored %q with %d objects, want %q only", retried, len(objects), key)
+	}
+}
@@ -1,8 +1,11 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"log"
 	"net/http"
+	"time"
 
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
@@ -42,5 +45,15 @@ func (cfg *apiConfig) handlerUsersCreate(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// The account works without verification, a failed email can be
+	// requested again, so signing up doesn't wait for the mail server.
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		if err := cfg.mailUserToken(ctx, *user, emailVerificationEmail); err != nil {
+			log.Printf("couldn't send verification email to user %v: %v", user.ID, err)
+		}
+	}()
+
 	respondWithJSON(w, http.StatusCreated, user)
 }
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	videoEventsPollInterval = time.Second
+	videoEventsMaxDuration  = 30 * time.Minute
+)
+
+// handlerVideoEvents streams the video as server-sent events each time its
+// processing status changes, closing once it is ready or has failed, or
+// right away when nothing is uploading or processing. Clients reconnect
+// after videoEventsMaxDuration.
+func (cfg *apiConfig) handlerVideoEvents(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.authorizeVideoViewer(w, r)
+	if !ok {
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		respondWithError(w, http.StatusInternalServerError, "Streaming unsupported", nil)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+
+	ctx, cancel := context.WithTimeout(r.Context(), videoEventsMaxDuration)
+	defer cancel()
+	ticker := time.NewTicker(videoEventsPollInterval)
+	defer ticker.Stop()
+
+	var lastStatus database.VideoStatus = "-"
+	for {
+		if video.Status != lastStatus {
+			signed, err := cfg.signedVideo(ctx, video)
+			if err != nil {
+				return
+			}
+			dat, err := json.Marshal(signed)
+			if err != nil {
+				return
+			}
+			fmt.Fprintf(w, "event: status\ndata: %s\n\n", dat)
+			flusher.Flush()
+			lastStatus = video.Status
+		}
+		if video.Status == database.VideoStatusReady || video.Status == database.VideoStatusFailed {
+			return
+		}
+		if video.Status == "" {
+			uploading, err := cfg.uploadInProgress(video.ID)
+			if err != nil || !uploading {
+				return
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		reloaded, err := cfg.db.GetVideo(video.ID)
+		if err != nil || reloaded.ID == uuid.Nil || !cfg.canViewVideo(r, reloaded) {
+			return
+		}
+		video = reloaded
+	}
+}
+
+// uploadInProgress reports whether a resumable or direct upload of the
+// video has been started and not finished.
+func (cfg *apiConfig) uploadInProgress(videoID uuid.UUID) (bool, error) {
+	tusUpload, err := cfg.db.GetVideoUpload(videoID)
+	if err != nil {
+		return false, err
+	}
+	if tusUpload.FilePath != "" {
+		return true, nil
+	}
+	directUpload, err := cfg.db.GetDirectUpload(videoID)
+	if err != nil {
+		return false, err
+	}
+	return directUpload.UploadID != "", nil
+}
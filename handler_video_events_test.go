@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+func TestVideoEventsStreamsStatusChanges(t *testing.T) {
+	cfg := newTestConfig(t)
+	user, token := newTestUser(t, cfg, "owner@example.com")
+	video := newTestVideo(t, cfg, user)
+	if err := cfg.db.SetVideoStatus(video.ID, database.VideoStatusProcessing, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		time.Sleep(videoEventsPollInterval / 2)
+		cfg.db.SetVideoStatus(video.ID, database.VideoStatusReady, nil)
+	}()
+
+	rec := serveTestRequest("GET /api/videos/{videoID}/events", cfg.handlerVideoEvents,
+		http.MethodGet, fmt.Sprintf("/api/videos/%v/events", video.ID), "Bearer "+token, nil)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("status = %d, content type %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	events := strings.Split(strings.TrimSpace(rec.Body.String()), "\n\n")
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want processing and ready:\n%s", len(events), rec.Body)
+	}
+	for i, status := range []database.VideoStatus{database.VideoStatusProcessing, database.VideoStatusReady} {
+		if !strings.HasPrefix(events[i], "event: status\ndata: ") || !strings.Contains(events[i], fmt.Sprintf(`"status":"%v"`, status)) {
+			t.Errorf("event %d = %q, want status %v", i, events[i], status)
+		}
+	}
+}
+
+func TestVideoEventsHidesPrivateVideos(t *testing.T) {
+	cfg := newTestConfig(t)
+	owner, _ := newTestUser(t, cfg, "owner@example.com")
+	_, otherToken := newTestUser(t, cfg, "other@example.com")
+	video := newTestVideo(t, cfg, owner)
+	if err := cfg.db.SetVideoStatus(video.ID, database.VideoStatusReady, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, authorization := range map[string]string{"anonymous": "", "other user": "Bearer " + otherToken} {
+		rec := serveTestRequest("GET /api/videos/{videoID}/events", cfg.handlerVideoEvents,
+			http.MethodGet, fmt.Sprintf("/api/videos/%v/events", video.ID), authorization, nil)
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("%v: status = %d, want %d", name, rec.Code, http.StatusNotFound)
+		}
+	}
+}
+
+func TestVideoEventsAllowsAnyoneOnPublicVideos(t *testing.T) {
+	cfg := newTestConfig(t)
+	owner, _ := newTestUser(t, cfg, "owner@example.com")
+	video := newTestVideoWith(t, cfg, owner, database.VisibilityPublic, database.VideoStatusReady)
+
+	rec := serveTestRequest("GET /api/videos/{videoID}/events", cfg.handlerVideoEvents,
+		http.MethodGet, fmt.Sprintf("/api/videos/%v/events", video.ID), "", nil)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"status":"ready"`) {
+		t.Errorf("status = %d, body %q", rec.Code, rec.Body)
+	}
+}
+
+func TestVideoEventsEndsWhenNothingIsPending(t *testing.T) {
+	cfg := newTestConfig(t)
+	user, token := newTestUser(t, cfg, "owner@example.com")
+	video := newTestVideo(t, cfg, user)
+
+	rec := serveTestRequest("GET /api/videos/{videoID}/events", cfg.handlerVideoEvents,
+		http.MethodGet, fmt.Sprintf("/api/videos/%v/events", video.ID), "Bearer "+token, nil)
+	events := strings.Split(strings.TrimSpace(rec.Body.String()), "\n\n")
+	if rec.Code != http.StatusOK || len(events) != 1 || strings.Contains(events[0], `"status"`) {
+		t.Errorf("status = %d, events %q, want a single event without a status", rec.Code, events)
+	}
+}
+
+func TestVideoEventsWaitsForUploadInProgress(t *testing.T) {
+	cfg := newTestConfig(t)
+	user, token := newTestUser(t, cfg, "owner@example.com")
+	video := newTestVideo(t, cfg, user)
+	_, err := cfg.db.CreateVideoUpload(database.CreateVideoUploadParams{
+		VideoID:  video.ID,
+		UserID:   user.ID,
+		Length:   10,
+		MimeType: "video/mp4",
+		FilePath: "upload.part",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		time.Sleep(videoEventsPollInterval / 2)
+		cfg.db.SetVideoStatus(video.ID, database.VideoStatusReady, nil)
+	}()
+
+	rec := serveTestRequest("GET /api/videos/{videoID}/events", cfg.handlerVideoEvents,
+		http.MethodGet, fmt.Sprintf("/api/videos/%v/events", video.ID), "Bearer "+token, nil)
+	events := strings.Split(strings.TrimSpace(rec.Body.String()), "\n\n")
+	if len(events) != 2 || !strings.Contains(events[1], `"status":"ready"`) {
+		t.Errorf("events = %q, want the upload followed by ready", events)
+	}
+}
@@ -2,7 +2,12 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
@@ -14,25 +19,32 @@ func (cfg *apiConfig) handlerVideoMetaCreate(w http.ResponseWriter, r *http.Requ
 		database.CreateVideoParams
 	}
 
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
-		return
-	}
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+	userID, ok := cfg.authenticateUser(w, r, auth.ScopeVideosWrite)
+	if !ok {
 		return
 	}
 
 	decoder := json.NewDecoder(r.Body)
 	params := parameters{}
-	err = decoder.Decode(&params)
+	err := decoder.Decode(&params)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters", err)
 		return
 	}
 	params.UserID = userID
+	if params.Visibility != "" && !params.Visibility.Valid() {
+		respondWithError(w, http.StatusBadRequest, "visibility must be private, unlisted or public", nil)
+		return
+	}
+	params.Title = strings.TrimSpace(params.Title)
+	if err := validateVideoTitle(params.Title); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	if err := validateVideoDescription(params.Description); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
 
 	video, err := cfg.db.CreateVideo(params.CreateVideoParams)
 	if err != nil {
@@ -40,7 +52,77 @@ func (cfg *apiConfig) handlerVideoMetaCreate(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	respondWithJSON(w, http.StatusCreated, video)
+	cfg.respondWithVideo(w, r, http.StatusCreated, video)
+}
+
+const (
+	maxVideoTitleLength       = 100
+	maxVideoDescriptionLength = 5000
+)
+
+func validateVideoTitle(title string) error {
+	if title == "" {
+		return errors.New("title is required")
+	}
+	if utf8.RuneCountInString(title) > maxVideoTitleLength {
+		return fmt.Errorf("title must be at most %d characters", maxVideoTitleLength)
+	}
+	return nil
+}
+
+func validateVideoDescription(description string) error {
+	if utf8.RuneCountInString(description) > maxVideoDescriptionLength {
+		return fmt.Errorf("description must be at most %d characters", maxVideoDescriptionLength)
+	}
+	return nil
+}
+
+// handlerVideoMetaUpdate applies the fields present in the request body,
+// leaving the others as they are.
+func (cfg *apiConfig) handlerVideoMetaUpdate(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.authorizeVideoOwner(w, r)
+	if !ok {
+		return
+	}
+
+	params := database.UpdateVideoDetailsParams{}
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if params.Title == nil && params.Description == nil && params.Visibility == nil {
+		respondWithError(w, http.StatusBadRequest, "No fields to update", nil)
+		return
+	}
+	if params.Visibility != nil && !params.Visibility.Valid() {
+		respondWithError(w, http.StatusBadRequest, "visibility must be private, unlisted or public", nil)
+		return
+	}
+
+	if params.Title != nil {
+		title := strings.TrimSpace(*params.Title)
+		if err := validateVideoTitle(title); err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error(), err)
+			return
+		}
+		params.Title = &title
+	}
+	if params.Description != nil {
+		if err := validateVideoDescription(*params.Description); err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error(), err)
+			return
+		}
+	}
+
+	updated, err := cfg.db.UpdateVideoDetails(video.ID, params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update video", err)
+		return
+	}
+
+	cfg.respondWithVideo(w, r, http.StatusOK, updated)
 }
 
 func (cfg *apiConfig) handlerVideoMetaDelete(w http.ResponseWriter, r *http.Request) {
@@ -51,14 +133,8 @@ func (cfg *apiConfig) handlerVideoMetaDelete(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
-		return
-	}
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+	userID, ok := cfg.authenticateUser(w, r, auth.ScopeVideosWrite)
+	if !ok {
 		return
 	}
 
@@ -72,62 +148,112 @@ func (cfg *apiConfig) handlerVideoMetaDelete(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	err = cfg.db.DeleteVideo(videoID)
+	blobs, err := cfg.videoBlobs(video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete video", err)
+		return
+	}
+	err = cfg.db.DeleteVideoWithBlobs(videoID, blobs)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't delete video", err)
 		return
 	}
+	cfg.wakeBlobDeletions()
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
 func (cfg *apiConfig) handlerVideoGet(w http.ResponseWriter, r *http.Request) {
-	videoIDString := r.PathValue("videoID")
-	videoID, err := uuid.Parse(videoIDString)
-	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+	video, ok := cfg.authorizeVideoViewer(w, r)
+	if !ok {
 		return
 	}
 
-	video, err := cfg.db.GetVideo(videoID)
+	cfg.respondWithVideo(w, r, http.StatusOK, video)
+}
+
+func (cfg *apiConfig) handlerVideosRetrieve(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticateUser(w, r, auth.ScopeVideosRead)
+	if !ok {
+		return
+	}
+
+	filter := database.VideoFilter{UserID: userID}
+	for param, dest := range map[string]*int{
+		"min_height": &filter.MinHeight,
+		"max_height": &filter.MaxHeight,
+	} {
+		value := r.URL.Query().Get(param)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			respondWithError(w, http.StatusBadRequest, "Invalid "+param, err)
+			return
+		}
+		*dest = n
+	}
+
+	videos, err := cfg.db.FilterVideos(filter)
 	if err != nil {
-		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve videos", err)
 		return
 	}
 
-	// signedVideo, err := cfg.dbVideoToSignedVideo(video)
-	// if err != nil {
-	// 	respondWithError(w, http.StatusInternalServerError, "can't sign video", err)
-	// }
+	signedVideos, err := cfg.signedVideos(r.Context(), videos)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't sign video URLs", err)
+		return
+	}
 
-	respondWithJSON(w, http.StatusOK, video)
+	respondWithJSON(w, http.StatusOK, signedVideos)
 }
 
-func (cfg *apiConfig) handlerVideosRetrieve(w http.ResponseWriter, r *http.Request) {
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+const (
+	publicVideosDefaultLimit = 20
+	publicVideosMaxLimit     = 100
+)
+
+// handlerVideosPublic lists ready public videos of every user, newest
+// first, without requiring authentication.
+func (cfg *apiConfig) handlerVideosPublic(w http.ResponseWriter, r *http.Request) {
+	filter := database.VideoFilter{
+		Visibility: database.VisibilityPublic,
+		Status:     database.VideoStatusReady,
+		Limit:      publicVideosDefaultLimit,
+	}
+	for param, dest := range map[string]*int{
+		"limit":  &filter.Limit,
+		"offset": &filter.Offset,
+	} {
+		value := r.URL.Query().Get(param)
+		if value == "" {
+			continue
+		}
+		var err error
+		*dest, err = strconv.Atoi(value)
+		if err != nil || *dest < 0 {
+			respondWithError(w, http.StatusBadRequest, "Invalid "+param, err)
+			return
+		}
+	}
+	if filter.Limit < 1 || filter.Limit > publicVideosMaxLimit {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", publicVideosMaxLimit), nil)
 		return
 	}
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+
+	videos, err := cfg.db.FilterVideos(filter)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve videos", err)
 		return
 	}
 
-	videos, err := cfg.db.GetVideos(userID)
-	// var signedVideos []database.Video
-	// for _, video := range videos {
-	// 	signedVideo, err := cfg.dbVideoToSignedVideo(video)
-	// 	if err != nil {
-	// 		respondWithError(w, http.StatusInternalServerError, "can't sign video", err)
-	// 	}
-	// 	signedVideos = append(signedVideos, signedVideo)
-	// }
+	signedVideos, err := cfg.signedVideos(r.Context(), videos)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve videos", err)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't sign video URLs", err)
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, videos)
+	respondWithJSON(w, http.StatusOK, signedVideos)
 }
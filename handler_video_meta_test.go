@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// newTestVideoWith creates a video of user and moves it to visibility and
+// status.
+func newTestVideoWith(t *testing.T, cfg *apiConfig, user database.User, visibility database.Visibility, status database.VideoStatus) database.Video {
+	t.Helper()
+	video := newTestVideo(t, cfg, user)
+	video, err := cfg.db.UpdateVideoDetails(video.ID, database.UpdateVideoDetailsParams{Visibility: &visibility})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.db.SetVideoStatus(video.ID, status, nil); err != nil {
+		t.Fatal(err)
+	}
+	return video
+}
+
+func TestVideosPublic(t *testing.T) {
+	cfg := newTestConfig(t)
+	alice, _ := newTestUser(t, cfg, "alice@example.com")
+	bob, _ := newTestUser(t, cfg, "bob@example.com")
+
+	want := map[uuid.UUID]bool{
+		newTestVideoWith(t, cfg, alice, database.VisibilityPublic, database.VideoStatusReady).ID: true,
+		newTestVideoWith(t, cfg, bob, database.VisibilityPublic, database.VideoStatusReady).ID:   true,
+	}
+	newTestVideoWith(t, cfg, alice, database.VisibilityPublic, database.VideoStatusProcessing)
+	newTestVideoWith(t, cfg, alice, database.VisibilityUnlisted, database.VideoStatusReady)
+	newTestVideoWith(t, cfg, bob, database.VisibilityPrivate, database.VideoStatusReady)
+
+	list := func(target string) []database.Video {
+		t.Helper()
+		rec := serveTestRequest("GET /api/videos/public", cfg.handlerVideosPublic, http.MethodGet, target, "", nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET %v: status = %d, body %s", target, rec.Code, rec.Body)
+		}
+		var videos []database.Video
+		if err := json.NewDecoder(rec.Body).Decode(&videos); err != nil {
+			t.Fatal(err)
+		}
+		return videos
+	}
+
+	videos := list("/api/videos/public")
+	if len(videos) != len(want) {
+		t.Fatalf("got %d videos, want %d", len(videos), len(want))
+	}
+	for _, video := range videos {
+		if !want[video.ID] {
+			t.Errorf("unexpected video %v (%v, %v)", video.ID, video.Visibility, video.Status)
+		}
+	}
+
+	first, second := list("/api/videos/public?limit=1"), list("/api/videos/public?limit=1&offset=1")
+	if len(first) != 1 || len(second) != 1 || first[0].ID == second[0].ID {
+		t.Errorf("pages = %v, %v, want one distinct video each", first, second)
+	}
+	if videos := list("/api/videos/public?offset=2"); len(videos) != 0 {
+		t.Errorf("offset past the end returned %d videos", len(videos))
+	}
+}
+
+func TestVideosPublicRejectsInvalidPaging(t *testing.T) {
+	cfg := newTestConfig(t)
+	for _, query := range []string{"limit=0", "limit=101", "limit=abc", "offset=-1"} {
+		rec := serveTestRequest("GET /api/videos/public", cfg.handlerVideosPublic, http.MethodGet, "/api/videos/public?"+query, "", nil)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%v: status = %d, want %d", query, rec.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func patchTestVideo(cfg *apiConfig, video database.Video, authorization, body string) *httptest.ResponseRecorder {
+	return serveTestRequest("PATCH /api/videos/{videoID}", cfg.handlerVideoMetaUpdate,
+		http.MethodPatch, fmt.Sprintf("/api/videos/%v", video.ID), authorization, strings.NewReader(body))
+}
+
+func TestVideoMetaUpdatePartial(t *testing.T) {
+	cfg := newTestConfig(t)
+	owner, token := newTestUser(t, cfg, "owner@example.com")
+	video := newTestVideo(t, cfg, owner)
+
+	rec := patchTestVideo(cfg, video, "Bearer "+token, `{"title": "  New title  "}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	var updated database.Video
+	if err := json.NewDecoder(rec.Body).Decode(&updated); err != nil {
+		t.Fatal(err)
+	}
+	if updated.Title != "New title" || updated.Description != video.Description || updated.Visibility != video.Visibility {
+		t.Errorf("updated = %q, %q, %v, want only the trimmed title changed", updated.Title, updated.Description, updated.Visibility)
+	}
+
+	rec = patchTestVideo(cfg, video, "Bearer "+token, `{"description": "", "visibility": "unlisted"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	stored, err := cfg.db.GetVideo(video.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Title != "New title" || stored.Description != "" || stored.Visibility != database.VisibilityUnlisted {
+		t.Errorf("stored = %q, %q, %v, want the earlier title kept", stored.Title, stored.Description, stored.Visibility)
+	}
+}
+
+func TestVideoMetaUpdateRejectsInvalidInput(t *testing.T) {
+	cfg := newTestConfig(t)
+	owner, token := newTestUser(t, cfg, "owner@example.com")
+	video := newTestVideo(t, cfg, owner)
+
+	for name, body := range map[string]string{
+		"unknown field":      `{"title": "New title", "user_id": "00000000-0000-0000-0000-000000000000"}`,
+		"no fields":          `{}`,
+		"blank title":        `{"title": "   "}`,
+		"long title":         fmt.Sprintf(`{"title": %q}`, strings.Repeat("é", maxVideoTitleLength+1)),
+		"long description":   fmt.Sprintf(`{"description": %q}`, strings.Repeat("a", maxVideoDescriptionLength+1)),
+		"invalid visibility": `{"visibility": "friends"}`,
+		"malformed":          `{"title":`,
+	} {
+		if rec := patchTestVideo(cfg, video, "Bearer "+token, body); rec.Code != http.StatusBadRequest {
+			t.Errorf("%v: status = %d, want %d", name, rec.Code, http.StatusBadRequest)
+		}
+	}
+
+	if rec := patchTestVideo(cfg, video, "Bearer "+token, fmt.Sprintf(`{"title": %q}`, strings.Repeat("é", maxVideoTitleLength))); rec.Code != http.StatusOK {
+		t.Errorf("title at the limit: status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	stored, err := cfg.db.GetVideo(video.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Description != video.Description || stored.Visibility != video.Visibility {
+		t.Errorf("a rejected update changed the video: %q, %v", stored.Description, stored.Visibility)
+	}
+}
+
+func TestVideoMetaUpdateRequiresOwner(t *testing.T) {
+	cfg := newTestConfig(t)
+	owner, _ := newTestUser(t, cfg, "owner@example.com")
+	_, otherToken := newTestUser(t, cfg, "other@example.com")
+	video := newTestVideo(t, cfg, owner)
+
+	for name, authorization := range map[string]string{"anonymous": "", "other user": "Bearer " + otherToken} {
+		if rec := patchTestVideo(cfg, video, authorization, `{"title": "Mine now"}`); rec.Code != http.StatusUnauthorized {
+			t.Errorf("%v: status = %d, want %d", name, rec.Code, http.StatusUnauthorized)
+		}
+	}
+
+	stored, err := cfg.db.GetVideo(video.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Title != video.Title {
+		t.Errorf("Title = %q, want it unchanged", stored.Title)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+	"github.com/google/uuid"
+)
+
+// handlerVideoStream serves the HLS and DASH manifests and the trickplay
+// VTT of a video with every URI in them signed, and redirects any other file to its signed
+// URL. The token query parameter is a playback token for the video, handed
+// out in the manifest URLs of the video response.
+func (cfg *apiConfig) handlerVideoStream(w http.ResponseWriter, r *http.Request) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return
+	}
+
+	token := r.URL.Query().Get("token")
+	tokenVideoID, err := auth.ValidatePlaybackToken(token, cfg.jwtKeys)
+	if err != nil || tokenVideoID != videoID {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate playback token", err)
+		return
+	}
+
+	rel := r.PathValue("path")
+	if !fs.ValidPath(rel) {
+		respondWithError(w, http.StatusNotFound, "Not found", nil)
+		return
+	}
+	key := videoPrefix(videoID) + rel
+
+	if !isManifestKey(key) {
+		signed, err := cfg.urlSigner.SignURL(r.Context(), key, cfg.playbackURLTTL)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't sign URL", err)
+			return
+		}
+		http.Redirect(w, r, signed, http.StatusFound)
+		return
+	}
+
+	body, _, err := cfg.store.Get(r.Context(), key)
+	if errors.Is(err, storage.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Not found", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get manifest", err)
+		return
+	}
+	manifest, err := io.ReadAll(body)
+	body.Close()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't read manifest", err)
+		return
+	}
+
+	rewrite, err := cfg.manifestURIRewriter(r.Context(), videoID, token, key)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't sign manifest", err)
+		return
+	}
+	var signed string
+	switch path.Ext(key) {
+	case ".mpd":
+		signed, err = rewriteDASHManifest(string(manifest), rewrite)
+	case ".vtt":
+		signed, err = rewriteTrickplayVTT(string(manifest), rewrite)
+	default:
+		signed, err = rewriteHLSPlaylist(string(manifest), rewrite)
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't sign manifest", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentTypeForKey(key))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, signed)
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+type hlsRendition struct {
+	Name         string
+	Height       int
+	VideoBitrate int // kbit/s
+	AudioBitrate int // kbit/s
+}
+
+// hlsLadder is ordered from highest to lowest quality. Heights refer to
+// the short side of the frame so portrait videos get the same ladder.
+var hlsLadder = []hlsRendition{
+	{Name: "1080p", Height: 1080, VideoBitrate: 5000, AudioBitrate: 192},
+	{Name: "720p", Height: 720, VideoBitrate: 2800, AudioBitrate: 128},
+	{Name: "480p", Height: 480, VideoBitrate: 1400, AudioBitrate: 128},
+	{Name: "360p", Height: 360, VideoBitrate: 800, AudioBitrate: 96},
+}
+
+const hlsSegmentSeconds = 6
+
+func hlsPrefix(videoID uuid.UUID) string {
+	return videoPrefix(videoID) + "hls/"
+}
+
+// hlsRenditionsFor caps the ladder at the source resolution, falling back
+// to a single rendition at the source size for very small videos.
+func hlsRenditionsFor(shortSide int) []hlsRendition {
+	renditions := []hlsRendition{}
+	for _, rendition := range hlsLadder {
+		if rendition.Height <= shortSide {
+			renditions = append(renditions, rendition)
+		}
+	}
+	if len(renditions) == 0 {
+		lowest := hlsLadder[len(hlsLadder)-1]
+		lowest.Name = fmt.Sprintf("%dp", shortSide)
+		lowest.Height = shortSide - shortSide%2
+		renditions = append(renditions, lowest)
+	}
+	return renditions
+}
+
+// packageHLS transcodes filePath into the HLS ladder, uploads the segments
+// and playlists under hlsPrefix and returns the master playlist key.
+func (cfg *apiConfig) packageHLS(ctx context.Context, videoID uuid.UUID, filePath string) (string, error) {
+	width, height, err := getVideoDimensions(filePath)
+	if err != nil {
+		return "", err
+	}
+
+	outputDir, err := os.MkdirTemp("", "tubely-hls-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(outputDir)
+
+	var master strings.Builder
+	master.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n")
+
+	for _, rendition := range hlsRenditionsFor(min(width, height)) {
+		renditionDir := filepath.Join(outputDir, rendition.Name)
+		if err := os.MkdirAll(renditionDir, 0755); err != nil {
+			return "", err
+		}
+
+		scale, outWidth, outHeight := renditionScale(width, height, rendition)
+
+		cmd := exec.CommandContext(ctx, "ffmpeg",
+			"-i", filePath,
+			"-vf", scale,
+			"-c:v", "libx264", "-preset", "veryfast", "-profile:v", "main",
+			"-b:v", fmt.Sprintf("%dk", rendition.VideoBitrate),
+			"-maxrate", fmt.Sprintf("%dk", rendition.VideoBitrate*107/100),
+			"-bufsize", fmt.Sprintf("%dk", rendition.VideoBitrate*3/2),
+			segmentKeyframes[0], segmentKeyframes[1], "-sc_threshold", "0",
+			"-c:a", "aac", "-ac", "2", "-b:a", fmt.Sprintf("%dk", rendition.AudioBitrate),
+			"-f", "hls",
+			"-hls_time", fmt.Sprintf("%d", hlsSegmentSeconds),
+			"-hls_playlist_type", "vod",
+			"-hls_segment_filename", filepath.Join(renditionDir, "segment_%04d.ts"),
+			filepath.Join(renditionDir, "index.m3u8"),
+		)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			return "", fmt.Errorf("ffmpeg %v rendition err: %w: %s", rendition.Name, err, lastLine(stderr.String()))
+		}
+
+		bandwidth := (rendition.VideoBitrate + rendition.AudioBitrate) * 1000
+		fmt.Fprintf(&master, "#EXT-X-STREAM-INF:BANDWIDTH=%d,RESOLUTION=%dx%d\n%v/index.m3u8\n", bandwidth, outWidth, outHeight, rendition.Name)
+	}
+
+	if err := os.WriteFile(filepath.Join(outputDir, "master.m3u8"), []byte(master.String()), 0644); err != nil {
+		return "", err
+	}
+
+	prefix := hlsPrefix(videoID)
+	if err := cfg.putDir(ctx, outputDir, prefix); err != nil {
+		return "", fmt.Errorf("couldn't store HLS output: %w", err)
+	}
+	return prefix + "master.m3u8", nil
+}
+
+// segmentKeyframes forces a keyframe at every segment boundary, whatever
+// the source frame rate, so segments of all renditions line up.
+var segmentKeyframes = [2]string{"-force_key_frames", fmt.Sprintf("expr:gte(t,n_forced*%d)", hlsSegmentSeconds)}
+
+// renditionScale returns the ffmpeg scale filter for rendition along with
+// the resulting frame size.
+func renditionScale(width, height int, rendition hlsRendition) (string, int, int) {
+	if width >= height {
+		return fmt.Sprintf("scale=-2:%d", rendition.Height), evenScale(width, height, rendition.Height), rendition.Height
+	}
+	return fmt.Sprintf("scale=%d:-2", rendition.Height), rendition.Height, evenScale(height, width, rendition.Height)
+}
+
+// evenScale scales long to match short being resized to target, rounded to
+// an even number the way ffmpeg's -2 does.
+func evenScale(long, short, target int) int {
+	return (long*target + short) / (2 * short) * 2
+}
+
+func lastLine(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.LastIndex(s, "\n"); i >= 0 {
+		return s[i+1:]
+	}
+	return s
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestHLSRenditionsFor_capsAtSource(t *testing.T) {
+	renditions := hlsRenditionsFor(720)
+	if len(renditions) != 3 || renditions[0].Name != "720p" {
+		t.Fatalf("want: 720p/480p/360p, got: %+v\n", renditions)
+	}
+}
+
+func TestHLSRenditionsFor_smallSource(t *testing.T) {
+	renditions := hlsRenditionsFor(241)
+	if len(renditions) != 1 || renditions[0].Height != 240 {
+		t.Fatalf("want: single 240 rendition, got: %+v\n", renditions)
+	}
+}
+
+func TestEvenScale(t *testing.T) {
+	if got := evenScale(1920, 1080, 720); got != 1280 {
+		t.Fatalf("want: 1280, got: %v\n", got)
+	}
+	if got := evenScale(1080, 608, 360); got != 640 {
+		t.Fatalf("want: 640, got: %v\n", got)
+	}
+}
+
+func TestSegmentKeyframesIndependentOfFrameRate(t *testing.T) {
+	if segmentKeyframes[0] != "-force_key_frames" || segmentKeyframes[1] != fmt.Sprintf("expr:gte(t,n_forced*%d)", hlsSegmentSeconds) {
+		t.Fatalf("want: keyframes forced every %ds, got: %v\n", hlsSegmentSeconds, segmentKeyframes)
+	}
+}
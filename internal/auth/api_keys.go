@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+// Scope limits what an API key may do. Access tokens carry every scope.
+type Scope string
+
+const (
+	ScopeVideosRead  Scope = "videos:read"
+	ScopeVideosWrite Scope = "videos:write"
+	// ScopeAccount covers the user's sessions. API keys themselves can
+	// only be managed with an access token.
+	ScopeAccount Scope = "account"
+)
+
+// AllScopes is every scope there is, which an API key created without
+// scopes is given.
+var AllScopes = []Scope{ScopeVideosRead, ScopeVideosWrite, ScopeAccount}
+
+func (s Scope) Valid() bool {
+	return s == ScopeVideosRead || s == ScopeVideosWrite || s == ScopeAccount
+}
+
+const apiKeyPrefix = "tubely_"
+
+var ErrMalformedAPIKey = errors.New("malformed API key")
+
+// MakeAPIKey returns a new key of the form tubely_<prefix>_<secret>. The
+// prefix is stored in the clear to find the key, the rest only as a hash.
+func MakeAPIKey() (key, prefix string, err error) {
+	prefixBytes := make([]byte, 6)
+	if _, err := rand.Read(prefixBytes); err != nil {
+		return "", "", err
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", err
+	}
+	prefix = hex.EncodeToString(prefixBytes)
+	return apiKeyPrefix + prefix + "_" + hex.EncodeToString(secret), prefix, nil
+}
+
+// ParseAPIKey returns the lookup prefix of key.
+func ParseAPIKey(key string) (string, error) {
+	prefix, secret, ok := strings.Cut(strings.TrimPrefix(key, apiKeyPrefix), "_")
+	if !strings.HasPrefix(key, apiKeyPrefix) || !ok || prefix == "" || secret == "" {
+		return "", ErrMalformedAPIKey
+	}
+	return prefix, nil
+}
+
+// HashAPIKey hashes key for storage.
+func HashAPIKey(key string) string {
+	return HashToken(key)
+}
+
+func CheckAPIKeyHash(key, hash string) bool {
+	return subtle.ConstantTimeCompare([]byte(HashAPIKey(key)), []byte(hash)) == 1
+}
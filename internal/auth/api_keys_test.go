@@ -0,0 +1,29 @@
+package auth
+
+import "testing"
+
+func TestAPIKeyRoundTrip(t *testing.T) {
+	key, prefix, err := MakeAPIKey()
+	if err != nil {
+		t.Fatalf("MakeAPIKey() err = %v", err)
+	}
+	parsed, err := ParseAPIKey(key)
+	if err != nil || parsed != prefix {
+		t.Fatalf("ParseAPIKey(%q) = %q, %v, want %q", key, parsed, err, prefix)
+	}
+	hash := HashAPIKey(key)
+	if !CheckAPIKeyHash(key, hash) {
+		t.Error("CheckAPIKeyHash() rejected the key")
+	}
+	if CheckAPIKeyHash(key+"0", hash) {
+		t.Error("CheckAPIKeyHash() accepted a different key")
+	}
+}
+
+func TestParseAPIKeyRejectsMalformed(t *testing.T) {
+	for _, key := range []string{"", "tubely_", "tubely_abc", "tubely__secret", "other_abc_secret"} {
+		if _, err := ParseAPIKey(key); err == nil {
+			t.Errorf("ParseAPIKey(%q) succeeded", key)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -18,6 +19,9 @@ type TokenType string
 
 const (
 	TokenTypeAccess TokenType = "tubely-access"
+	// TokenTypePlayback tokens let players, which can't send headers, fetch
+	// a single video's streams. The subject is the video ID.
+	TokenTypePlayback TokenType = "tubely-playback"
 )
 
 var ErrNoAuthHeaderIncluded = errors.New("no auth header included in request")
@@ -40,48 +44,82 @@ func CheckPasswordHash(password, hash string) (bool, error) {
 
 func MakeJWT(
 	userID uuid.UUID,
-	tokenSecret string,
+	keys *KeySet,
 	expiresIn time.Duration,
 ) (string, error) {
-	signingKey := []byte(tokenSecret)
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
-		Issuer:    string(TokenTypeAccess),
+	return makeToken(TokenTypeAccess, userID, keys, expiresIn)
+}
+
+func ValidateJWT(tokenString string, keys *KeySet) (uuid.UUID, error) {
+	userID, _, err := validateToken(TokenTypeAccess, tokenString, keys)
+	return userID, err
+}
+
+// ValidateJWTIssuedAt is ValidateJWT that also returns when the token was
+// issued, so callers can reject tokens minted before a password change.
+func ValidateJWTIssuedAt(tokenString string, keys *KeySet) (uuid.UUID, time.Time, error) {
+	return validateToken(TokenTypeAccess, tokenString, keys)
+}
+
+func MakePlaybackToken(videoID uuid.UUID, keys *KeySet, expiresIn time.Duration) (string, error) {
+	return makeToken(TokenTypePlayback, videoID, keys, expiresIn)
+}
+
+// ValidatePlaybackToken returns the ID of the video the token was issued
+// for.
+func ValidatePlaybackToken(tokenString string, keys *KeySet) (uuid.UUID, error) {
+	videoID, _, err := validateToken(TokenTypePlayback, tokenString, keys)
+	return videoID, err
+}
+
+func makeToken(tokenType TokenType, subject uuid.UUID, keys *KeySet, expiresIn time.Duration) (string, error) {
+	return keys.sign(jwt.RegisteredClaims{
+		Issuer:    string(tokenType),
 		IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
 		ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
-		Subject:   userID.String(),
+		Subject:   subject.String(),
 	})
-	return token.SignedString(signingKey)
 }
 
-func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
+func validateToken(tokenType TokenType, tokenString string, keys *KeySet) (uuid.UUID, time.Time, error) {
 	claimsStruct := jwt.RegisteredClaims{}
 	token, err := jwt.ParseWithClaims(
 		tokenString,
 		&claimsStruct,
-		func(token *jwt.Token) (interface{}, error) { return []byte(tokenSecret), nil },
+		keys.verificationKey,
+		jwt.WithValidMethods([]string{
+			jwt.SigningMethodEdDSA.Alg(),
+			jwt.SigningMethodRS256.Alg(),
+			jwt.SigningMethodHS256.Alg(),
+		}),
 	)
 	if err != nil {
-		return uuid.Nil, err
+		return uuid.Nil, time.Time{}, err
 	}
 
-	userIDString, err := token.Claims.GetSubject()
+	subject, err := token.Claims.GetSubject()
 	if err != nil {
-		return uuid.Nil, err
+		return uuid.Nil, time.Time{}, err
 	}
 
 	issuer, err := token.Claims.GetIssuer()
 	if err != nil {
-		return uuid.Nil, err
+		return uuid.Nil, time.Time{}, err
 	}
-	if issuer != string(TokenTypeAccess) {
-		return uuid.Nil, errors.New("invalid issuer")
+	if issuer != string(tokenType) {
+		return uuid.Nil, time.Time{}, errors.New("invalid issuer")
 	}
 
-	id, err := uuid.Parse(userIDString)
+	id, err := uuid.Parse(subject)
 	if err != nil {
-		return uuid.Nil, fmt.Errorf("invalid user ID: %w", err)
+		return uuid.Nil, time.Time{}, fmt.Errorf("invalid subject: %w", err)
 	}
-	return id, nil
+
+	var issuedAt time.Time
+	if claimsStruct.IssuedAt != nil {
+		issuedAt = claimsStruct.IssuedAt.Time
+	}
+	return id, issuedAt, nil
 }
 
 func GetBearerToken(headers http.Header) (string, error) {
@@ -106,6 +144,13 @@ func MakeRefreshToken() (string, error) {
 	return hex.EncodeToString(token), nil
 }
 
+// HashToken hashes a random token for storage. Tokens have enough entropy
+// that a fast hash is enough to make a leaked table useless.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
 func GetAPIKey(headers http.Header) (string, error) {
 	authHeader := headers.Get("Authorization")
 	if authHeader == "" {
@@ -0,0 +1,40 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestPlaybackToken(t *testing.T) {
+	keys := NewHMACKeySet("secret")
+	videoID := uuid.New()
+
+	token, err := MakePlaybackToken(videoID, keys, time.Minute)
+	if err != nil {
+		t.Fatalf("MakePlaybackToken() err = %v", err)
+	}
+	if got, err := ValidatePlaybackToken(token, keys); err != nil || got != videoID {
+		t.Errorf("ValidatePlaybackToken() = %v, %v, want %v", got, err, videoID)
+	}
+	if _, err := ValidateJWT(token, keys); err == nil {
+		t.Error("ValidateJWT() accepted a playback token")
+	}
+
+	access, err := MakeJWT(videoID, keys, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ValidatePlaybackToken(access, keys); err == nil {
+		t.Error("ValidatePlaybackToken() accepted an access token")
+	}
+
+	expired, err := MakePlaybackToken(videoID, keys, -time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ValidatePlaybackToken(expired, keys); err == nil {
+		t.Error("ValidatePlaybackToken() accepted an expired token")
+	}
+}
@@ -0,0 +1,215 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const minRSAKeyBits = 2048
+
+// KeySet holds the key access tokens are signed with and every key they
+// are verified against. Asymmetric keys are identified by the token's kid
+// header, so retired keys can keep verifying tokens until they expire.
+type KeySet struct {
+	signingKID    string
+	signingMethod jwt.SigningMethod
+	signingKey    crypto.PrivateKey
+	// hmacSecret signs when there are no asymmetric keys, and otherwise
+	// verifies tokens issued before they were introduced.
+	hmacSecret []byte
+	public     map[string]publicKey
+}
+
+type publicKey struct {
+	method jwt.SigningMethod
+	key    crypto.PublicKey
+}
+
+// NewHMACKeySet signs and verifies with a shared secret only.
+func NewHMACKeySet(secret string) *KeySet {
+	return &KeySet{
+		signingMethod: jwt.SigningMethodHS256,
+		hmacSecret:    []byte(secret),
+		public:        map[string]publicKey{},
+	}
+}
+
+// LoadKeySet reads every .pem file in dir, using the file name without the
+// extension as its kid. Files may hold Ed25519 or RSA private keys, or
+// public keys that are only used for verification. Tokens are signed with
+// the private key signingKID, or with the one whose kid sorts last when
+// signingKID is empty, so keys named by date rotate on their own. A
+// non-empty hmacSecret keeps older HS256 tokens valid.
+func LoadKeySet(dir, signingKID, hmacSecret string) (*KeySet, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	keys := &KeySet{public: map[string]publicKey{}}
+	if hmacSecret != "" {
+		keys.hmacSecret = []byte(hmacSecret)
+	}
+	privateKeys := map[string]crypto.PrivateKey{}
+	for _, path := range paths {
+		kid := strings.TrimSuffix(filepath.Base(path), ".pem")
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		private, public, err := parseKeyPEM(data)
+		if err != nil {
+			return nil, fmt.Errorf("key %v: %w", kid, err)
+		}
+		method, err := signingMethodFor(public)
+		if err != nil {
+			return nil, fmt.Errorf("key %v: %w", kid, err)
+		}
+		keys.public[kid] = publicKey{method: method, key: public}
+		if private != nil {
+			privateKeys[kid] = private
+			if signingKID == "" || kid == signingKID {
+				keys.signingKID = kid
+			}
+		}
+	}
+
+	if signingKID != "" && keys.signingKID != signingKID {
+		return nil, fmt.Errorf("no private key %q in %v", signingKID, dir)
+	}
+	if keys.signingKID == "" {
+		return nil, fmt.Errorf("no private keys in %v", dir)
+	}
+	keys.signingKey = privateKeys[keys.signingKID]
+	keys.signingMethod = keys.public[keys.signingKID].method
+	return keys, nil
+}
+
+func parseKeyPEM(data []byte) (crypto.PrivateKey, crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, nil, errors.New("no PEM block found")
+	}
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, nil, fmt.Errorf("unsupported private key type %T", key)
+		}
+		return key, signer.Public(), nil
+	case "RSA PRIVATE KEY":
+		key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		return key, key.Public(), nil
+	case "PUBLIC KEY":
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		return nil, key, err
+	default:
+		return nil, nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+}
+
+func signingMethodFor(key crypto.PublicKey) (jwt.SigningMethod, error) {
+	switch key := key.(type) {
+	case ed25519.PublicKey:
+		return jwt.SigningMethodEdDSA, nil
+	case *rsa.PublicKey:
+		if key.N.BitLen() < minRSAKeyBits {
+			return nil, fmt.Errorf("RSA keys must have at least %d bits", minRSAKeyBits)
+		}
+		return jwt.SigningMethodRS256, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %T, use Ed25519 or RSA", key)
+	}
+}
+
+func (k *KeySet) sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(k.signingMethod, claims)
+	if k.signingKID == "" {
+		return token.SignedString(k.hmacSecret)
+	}
+	token.Header["kid"] = k.signingKID
+	return token.SignedString(k.signingKey)
+}
+
+func (k *KeySet) verificationKey(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		if k.hmacSecret == nil || token.Method != jwt.SigningMethodHS256 {
+			return nil, errors.New("token has no kid")
+		}
+		return k.hmacSecret, nil
+	}
+	key, ok := k.public[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown kid %q", kid)
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("kid %q doesn't sign with %v", kid, token.Method.Alg())
+	}
+	return key.key, nil
+}
+
+// JWK is a public key in JSON Web Key format.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS lists the public keys, sorted by kid. The shared secret, if any,
+// is never included.
+func (k *KeySet) JWKS() JWKS {
+	kids := make([]string, 0, len(k.public))
+	for kid := range k.public {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+
+	jwks := JWKS{Keys: []JWK{}}
+	for _, kid := range kids {
+		key := k.public[kid]
+		jwk := JWK{KeyID: kid, Use: "sig", Algorithm: key.method.Alg()}
+		switch public := key.key.(type) {
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		}
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+	return jwks
+}
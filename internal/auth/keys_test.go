@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func writeKey(t *testing.T, dir, kid string, key any) {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, kid+".pem"), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestKeySetRotation(t *testing.T) {
+	dir := t.TempDir()
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeKey(t, dir, "2026-01", edKey)
+
+	oldKeys, err := LoadKeySet(dir, "", "legacy-secret")
+	if err != nil {
+		t.Fatalf("LoadKeySet() err = %v", err)
+	}
+	userID := uuid.New()
+	oldToken, err := MakeJWT(userID, oldKeys, time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT() err = %v", err)
+	}
+	legacyToken, err := MakeJWT(userID, NewHMACKeySet("legacy-secret"), time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT() err = %v", err)
+	}
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeKey(t, dir, "2026-02", rsaKey)
+	keys, err := LoadKeySet(dir, "", "legacy-secret")
+	if err != nil {
+		t.Fatalf("LoadKeySet() err = %v", err)
+	}
+	newToken, err := MakeJWT(userID, keys, time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT() err = %v", err)
+	}
+	parsed, _, err := jwt.NewParser().ParseUnverified(newToken, &jwt.RegisteredClaims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Header["kid"] != "2026-02" || parsed.Method.Alg() != "RS256" {
+		t.Errorf("new token header = %v, want kid 2026-02 signed RS256", parsed.Header)
+	}
+
+	for name, token := range map[string]string{"old": oldToken, "new": newToken, "legacy": legacyToken} {
+		if got, err := ValidateJWT(token, keys); err != nil || got != userID {
+			t.Errorf("ValidateJWT(%v token) = %v, %v, want %v", name, got, err, userID)
+		}
+	}
+
+	withoutSecret, err := LoadKeySet(dir, "2026-01", "")
+	if err != nil {
+		t.Fatalf("LoadKeySet() err = %v", err)
+	}
+	if _, err := ValidateJWT(legacyToken, withoutSecret); err == nil {
+		t.Error("ValidateJWT() accepted an HS256 token without a shared secret")
+	}
+
+	jwks := keys.JWKS()
+	if len(jwks.Keys) != 2 || jwks.Keys[0].KeyType != "OKP" || jwks.Keys[1].KeyType != "RSA" || jwks.Keys[1].E != "AQAB" {
+		t.Errorf("JWKS() = %+v", jwks)
+	}
+}
+
+func TestValidateJWTRejectsAlgorithmConfusion(t *testing.T) {
+	dir := t.TempDir()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeKey(t, dir, "rsa", rsaKey)
+	keys, err := LoadKeySet(dir, "", "")
+	if err != nil {
+		t.Fatalf("LoadKeySet() err = %v", err)
+	}
+
+	publicDER, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Issuer:    string(TokenTypeAccess),
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		Subject:   uuid.NewString(),
+	})
+	token.Header["kid"] = "rsa"
+	forged, err := token.SignedString(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ValidateJWT(forged, keys); err == nil {
+		t.Error("ValidateJWT() accepted an HS256 token signed with an RSA public key")
+	}
+}
@@ -0,0 +1,53 @@
+package blurhash
+
+import (
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+func TestEncodeSolidColor(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 8, 6))
+	for y := 0; y < 6; y++ {
+		for x := 0; x < 8; x++ {
+			img.Set(x, y, color.Black)
+		}
+	}
+
+	hash, err := Encode(img, 4, 3)
+	if err != nil {
+		t.Fatalf("Encode() err = %v", err)
+	}
+	want := "L00000" + strings.Repeat("fQ", 11)
+	if hash != want {
+		t.Errorf("Encode() = %q, want %q", hash, want)
+	}
+}
+
+func TestEncodeLength(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 10, 10))
+	for y := 0; y < 10; y++ {
+		for x := 0; x < 10; x++ {
+			img.Set(x, y, color.RGBA{uint8(x * 25), uint8(y * 25), 128, 255})
+		}
+	}
+
+	hash, err := Encode(img, 3, 4)
+	if err != nil {
+		t.Fatalf("Encode() err = %v", err)
+	}
+	if want := 4 + 2*3*4; len(hash) != want {
+		t.Errorf("len(Encode()) = %d, want %d", len(hash), want)
+	}
+}
+
+func TestEncodeInvalidComponents(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 1, 1))
+	if _, err := Encode(img, 0, 3); err == nil {
+		t.Error("expected an error for 0 components")
+	}
+	if _, err := Encode(img, 4, 10); err == nil {
+		t.Error("expected an error for 10 components")
+	}
+}
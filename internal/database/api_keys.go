@@ -0,0 +1,170 @@
+package database
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// APIKey lets automation act as its user without a password login. Only
+// a hash of the key is stored; Prefix identifies it for lookup and display.
+type APIKey struct {
+	ID         uuid.UUID  `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreateAPIKeyParams
+}
+
+type CreateAPIKeyParams struct {
+	UserID  uuid.UUID    `json:"user_id"`
+	Name    string       `json:"name"`
+	Prefix  string       `json:"prefix"`
+	KeyHash string       `json:"-"`
+	Scopes  APIKeyScopes `json:"scopes"`
+}
+
+// APIKeyScopes is stored as a JSON array.
+type APIKeyScopes []string
+
+func (s *APIKeyScopes) Scan(src any) error {
+	return scanJSON(src, s)
+}
+
+func (s APIKeyScopes) Value() (driver.Value, error) {
+	if s == nil {
+		s = APIKeyScopes{}
+	}
+	return valueJSON(s)
+}
+
+const apiKeyColumns = `
+		id,
+		created_at,
+		user_id,
+		name,
+		prefix,
+		key_hash,
+		scopes,
+		last_used_at,
+		revoked_at`
+
+func scanAPIKey(row scanner) (APIKey, error) {
+	var key APIKey
+	err := row.Scan(
+		&key.ID,
+		&key.CreatedAt,
+		&key.UserID,
+		&key.Name,
+		&key.Prefix,
+		&key.KeyHash,
+		&key.Scopes,
+		&key.LastUsedAt,
+		&key.RevokedAt,
+	)
+	return key, err
+}
+
+func (c Client) CreateAPIKey(params CreateAPIKeyParams) (APIKey, error) {
+	id := uuid.New()
+	query := `
+	INSERT INTO api_keys (
+		id,
+		created_at,
+		user_id,
+		name,
+		prefix,
+		key_hash,
+		scopes
+	) VALUES (?, CURRENT_TIMESTAMP, ?, ?, ?, ?, ?)
+	`
+	_, err := c.db.Exec(query, id, params.UserID, params.Name, params.Prefix, params.KeyHash, params.Scopes)
+	if err != nil {
+		return APIKey{}, err
+	}
+
+	return c.getAPIKey("id", id)
+}
+
+func (c Client) GetAPIKey(id uuid.UUID) (APIKey, error) {
+	return c.getAPIKey("id", id)
+}
+
+func (c Client) GetAPIKeyByPrefix(prefix string) (APIKey, error) {
+	return c.getAPIKey("prefix", prefix)
+}
+
+func (c Client) getAPIKey(column string, value any) (APIKey, error) {
+	query := `
+	SELECT` + apiKeyColumns + `
+	FROM api_keys
+	WHERE ` + column + ` = ?
+	`
+	key, err := scanAPIKey(c.db.QueryRow(query, value))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return APIKey{}, nil
+		}
+		return APIKey{}, err
+	}
+	return key, nil
+}
+
+// GetAPIKeys lists a user's keys, newest first, including revoked ones.
+func (c Client) GetAPIKeys(userID uuid.UUID) ([]APIKey, error) {
+	query := `
+	SELECT` + apiKeyColumns + `
+	FROM api_keys
+	WHERE user_id = ?
+	ORDER BY created_at DESC
+	`
+	rows, err := c.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func (c Client) TouchAPIKey(id uuid.UUID, now time.Time) error {
+	query := `
+	UPDATE api_keys
+	SET last_used_at = ?
+	WHERE id = ?
+	`
+	_, err := c.db.Exec(query, now.UTC(), id)
+	return err
+}
+
+func (c Client) RevokeAPIKey(id uuid.UUID) error {
+	query := `
+	UPDATE api_keys
+	SET revoked_at = CURRENT_TIMESTAMP
+	WHERE id = ? AND revoked_at IS NULL
+	`
+	_, err := c.db.Exec(query, id)
+	return err
+}
+
+// RevokeUserAPIKeys revokes every key of the user that is still active.
+func (c Client) RevokeUserAPIKeys(userID uuid.UUID) error {
+	query := `
+	UPDATE api_keys
+	SET revoked_at = CURRENT_TIMESTAMP
+	WHERE user_id = ? AND revoked_at IS NULL
+	`
+	_, err := c.db.Exec(query, userID)
+	return err
+}
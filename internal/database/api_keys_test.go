@@ -0,0 +1,30 @@
+package database
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestMigrateUnscopedAPIKeys(t *testing.T) {
+	c := newTestClient(t)
+	user := newTestUser(t, c, "user@example.com")
+	unscoped, err := c.CreateAPIKey(CreateAPIKeyParams{UserID: user.ID, Name: "legacy", Prefix: "legacy", KeyHash: "hash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	scoped, err := c.CreateAPIKey(CreateAPIKeyParams{UserID: user.ID, Name: "read", Prefix: "read", KeyHash: "hash", Scopes: APIKeyScopes{"videos:read"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.autoMigrate(); err != nil {
+		t.Fatalf("autoMigrate() err = %v", err)
+	}
+
+	if unscoped, _ = c.GetAPIKey(unscoped.ID); !slices.Equal(unscoped.Scopes, APIKeyScopes{"videos:read", "videos:write", "account"}) {
+		t.Errorf("unscoped key migrated to %v, want every scope", unscoped.Scopes)
+	}
+	if scoped, _ = c.GetAPIKey(scoped.ID); !slices.Equal(scoped.Scopes, APIKeyScopes{"videos:read"}) {
+		t.Errorf("scoped key migrated to %v, want it unchanged", scoped.Scopes)
+	}
+}
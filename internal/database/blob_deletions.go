@@ -0,0 +1,169 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// BlobDeletion is an outbox entry for a storage object (or, when IsPrefix
+// is set, every object under a key prefix) that still has to be removed.
+// With IsFile set, Key is a path on the local filesystem instead, and with
+// UploadID set it names an unfinished multipart upload to abort.
+type BlobDeletion struct {
+	ID            uuid.UUID `json:"id"`
+	CreatedAt     time.Time `json:"created_at"`
+	Key           string    `json:"key"`
+	IsPrefix      bool      `json:"is_prefix"`
+	IsFile        bool      `json:"is_file"`
+	UploadID      *string   `json:"upload_id"`
+	Attempts      int       `json:"attempts"`
+	LastError     *string   `json:"last_error"`
+	NextAttemptAt time.Time `json:"next_attempt_at"`
+}
+
+type CreateBlobDeletionParams struct {
+	Key      string  `json:"key"`
+	IsPrefix bool    `json:"is_prefix"`
+	IsFile   bool    `json:"is_file"`
+	UploadID *string `json:"upload_id"`
+}
+
+// DeleteVideoWithBlobs deletes the video row, along with any upload still
+// in progress for it, and enqueues its storage objects for deletion in a
+// single transaction, so a crash can never leave orphaned objects without
+// an outbox entry.
+func (c Client) DeleteVideoWithBlobs(id uuid.UUID, blobs []CreateBlobDeletionParams) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := insertBlobDeletions(tx, blobs); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM video_uploads WHERE video_id = ?`, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM direct_uploads WHERE video_id = ?`, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM share_links WHERE video_id = ?`, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM caption_tracks WHERE video_id = ?`, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM videos WHERE id = ?`, id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// CreateBlobDeletions enqueues storage objects that are no longer
+// referenced by any row.
+func (c Client) CreateBlobDeletions(blobs []CreateBlobDeletionParams) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := insertBlobDeletions(tx, blobs); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func insertBlobDeletions(tx *sql.Tx, blobs []CreateBlobDeletionParams) error {
+	query := `
+	INSERT INTO blob_deletions (
+		id,
+		created_at,
+		key,
+		is_prefix,
+		is_file,
+		upload_id,
+		attempts,
+		next_attempt_at
+	) VALUES (?, CURRENT_TIMESTAMP, ?, ?, ?, ?, 0, ?)
+	`
+	now := time.Now().UTC()
+	for _, blob := range blobs {
+		if _, err := tx.Exec(query, uuid.New(), blob.Key, blob.IsPrefix, blob.IsFile, blob.UploadID, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c Client) GetDueBlobDeletions(now time.Time, limit int) ([]BlobDeletion, error) {
+	query := `
+	SELECT
+		id,
+		created_at,
+		key,
+		is_prefix,
+		is_file,
+		upload_id,
+		attempts,
+		last_error,
+		next_attempt_at
+	FROM blob_deletions
+	WHERE next_attempt_at <= ?
+	ORDER BY next_attempt_at
+	LIMIT ?
+	`
+
+	rows, err := c.db.Query(query, now.UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deletions := []BlobDeletion{}
+	for rows.Next() {
+		var deletion BlobDeletion
+		if err := rows.Scan(
+			&deletion.ID,
+			&deletion.CreatedAt,
+			&deletion.Key,
+			&deletion.IsPrefix,
+			&deletion.IsFile,
+			&deletion.UploadID,
+			&deletion.Attempts,
+			&deletion.LastError,
+			&deletion.NextAttemptAt,
+		); err != nil {
+			return nil, err
+		}
+		deletions = append(deletions, deletion)
+	}
+
+	return deletions, rows.Err()
+}
+
+func (c Client) CompleteBlobDeletion(id uuid.UUID) error {
+	query := `
+	DELETE FROM blob_deletions
+	WHERE id = ?
+	`
+	_, err := c.db.Exec(query, id)
+	return err
+}
+
+func (c Client) RetryBlobDeletion(id uuid.UUID, lastError string, nextAttemptAt time.Time) error {
+	query := `
+	UPDATE blob_deletions
+	SET
+		attempts = attempts + 1,
+		last_error = ?,
+		next_attempt_at = ?
+	WHERE id = ?
+	`
+	_, err := c.db.Exec(query, lastError, nextAttemptAt.UTC(), id)
+	return err
+}
@@ -0,0 +1,96 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDeleteVideoWithBlobs(t *testing.T) {
+	c := newTestClient(t)
+	user := newTestUser(t, c, "owner@example.com")
+	video := newTestVideo(t, c, user)
+
+	if _, err := c.CreateVideoUpload(CreateVideoUploadParams{VideoID: video.ID, UserID: user.ID, Length: 10, MimeType: "video/mp4", FilePath: "uploads/a.part"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.CreateDirectUpload(CreateDirectUploadParams{VideoID: video.ID, UserID: user.ID, UploadID: "upload-1", Key: "videos/incoming/a.mp4", MimeType: "video/mp4"}); err != nil {
+		t.Fatal(err)
+	}
+
+	uploadID := "upload-1"
+	blobs := []CreateBlobDeletionParams{
+		{Key: "videos/a/", IsPrefix: true},
+		{Key: "uploads/a.part", IsFile: true},
+		{Key: "videos/incoming/a.mp4", UploadID: &uploadID},
+	}
+	if err := c.DeleteVideoWithBlobs(video.ID, blobs); err != nil {
+		t.Fatalf("DeleteVideoWithBlobs() err = %v", err)
+	}
+
+	if got, err := c.GetVideo(video.ID); err != nil || got.ID == video.ID {
+		t.Errorf("video still present, err = %v", err)
+	}
+	if got, err := c.GetVideoUpload(video.ID); err != nil || got.FilePath != "" {
+		t.Errorf("video upload still present, err = %v", err)
+	}
+	if got, err := c.GetDirectUpload(video.ID); err != nil || got.UploadID != "" {
+		t.Errorf("direct upload still present, err = %v", err)
+	}
+
+	deletions, err := c.GetDueBlobDeletions(time.Now(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deletions) != len(blobs) {
+		t.Fatalf("got %d deletions, want %d", len(deletions), len(blobs))
+	}
+	byKey := map[string]BlobDeletion{}
+	for _, deletion := range deletions {
+		byKey[deletion.Key] = deletion
+	}
+	if !byKey["videos/a/"].IsPrefix {
+		t.Error("prefix deletion lost IsPrefix")
+	}
+	if !byKey["uploads/a.part"].IsFile {
+		t.Error("file deletion lost IsFile")
+	}
+	if got := byKey["videos/incoming/a.mp4"].UploadID; got == nil || *got != uploadID {
+		t.Errorf("UploadID = %v, want %q", got, uploadID)
+	}
+}
+
+func TestRetryBlobDeletion(t *testing.T) {
+	c := newTestClient(t)
+	video := newTestVideo(t, c, newTestUser(t, c, "owner@example.com"))
+	if err := c.DeleteVideoWithBlobs(video.ID, []CreateBlobDeletionParams{{Key: "videos/a.mp4"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	deletions, err := c.GetDueBlobDeletions(now, 10)
+	if err != nil || len(deletions) != 1 {
+		t.Fatalf("GetDueBlobDeletions() = %v, %v", deletions, err)
+	}
+	deletion := deletions[0]
+
+	if err := c.RetryBlobDeletion(deletion.ID, "boom", now.Add(time.Minute)); err != nil {
+		t.Fatalf("RetryBlobDeletion() err = %v", err)
+	}
+	if due, _ := c.GetDueBlobDeletions(now, 10); len(due) != 0 {
+		t.Errorf("deletion due before its next attempt: %v", due)
+	}
+	due, err := c.GetDueBlobDeletions(now.Add(2*time.Minute), 10)
+	if err != nil || len(due) != 1 {
+		t.Fatalf("GetDueBlobDeletions() = %v, %v", due, err)
+	}
+	if due[0].Attempts != 1 || due[0].LastError == nil || *due[0].LastError != "boom" {
+		t.Errorf("attempts = %d, last error = %v", due[0].Attempts, due[0].LastError)
+	}
+
+	if err := c.CompleteBlobDeletion(deletion.ID); err != nil {
+		t.Fatalf("CompleteBlobDeletion() err = %v", err)
+	}
+	if due, _ := c.GetDueBlobDeletions(now.Add(time.Hour), 10); len(due) != 0 {
+		t.Errorf("completed deletion still queued: %v", due)
+	}
+}
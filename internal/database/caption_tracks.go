@@ -0,0 +1,139 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CaptionTrack is a WebVTT subtitle track of a video. A video has at most
+// one track per language.
+type CaptionTrack struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	CreateCaptionTrackParams
+}
+
+type CreateCaptionTrackParams struct {
+	VideoID  uuid.UUID `json:"video_id"`
+	Language string    `json:"language"`
+	Label    string    `json:"label"`
+	URL      string    `json:"url"`
+}
+
+// CreateCaptionTrack stores a track, replacing the video's existing track
+// in the same language. The replaced track is returned so its file can be
+// removed, or a zero CaptionTrack if there was none.
+func (c Client) CreateCaptionTrack(params CreateCaptionTrackParams) (CaptionTrack, CaptionTrack, error) {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return CaptionTrack{}, CaptionTrack{}, err
+	}
+	defer tx.Rollback()
+
+	replaced, err := scanCaptionTrack(tx.QueryRow(`
+	SELECT`+captionTrackColumns+`
+	FROM caption_tracks
+	WHERE video_id = ? AND language = ?
+	`, params.VideoID, params.Language))
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return CaptionTrack{}, CaptionTrack{}, err
+	}
+	if _, err := tx.Exec(`DELETE FROM caption_tracks WHERE video_id = ? AND language = ?`, params.VideoID, params.Language); err != nil {
+		return CaptionTrack{}, CaptionTrack{}, err
+	}
+
+	id := uuid.New()
+	query := `
+	INSERT INTO caption_tracks (
+		id,
+		created_at,
+		video_id,
+		language,
+		label,
+		url
+	) VALUES (?, CURRENT_TIMESTAMP, ?, ?, ?, ?)
+	`
+	if _, err := tx.Exec(query, id, params.VideoID, params.Language, params.Label, params.URL); err != nil {
+		return CaptionTrack{}, CaptionTrack{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return CaptionTrack{}, CaptionTrack{}, err
+	}
+
+	track, err := c.GetCaptionTrack(id)
+	return track, replaced, err
+}
+
+const captionTrackColumns = `
+		id,
+		created_at,
+		video_id,
+		language,
+		label,
+		url`
+
+func scanCaptionTrack(row scanner) (CaptionTrack, error) {
+	var track CaptionTrack
+	err := row.Scan(
+		&track.ID,
+		&track.CreatedAt,
+		&track.VideoID,
+		&track.Language,
+		&track.Label,
+		&track.URL,
+	)
+	return track, err
+}
+
+func (c Client) GetCaptionTrack(id uuid.UUID) (CaptionTrack, error) {
+	query := `
+	SELECT` + captionTrackColumns + `
+	FROM caption_tracks
+	WHERE id = ?
+	`
+	track, err := scanCaptionTrack(c.db.QueryRow(query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return CaptionTrack{}, nil
+		}
+		return CaptionTrack{}, err
+	}
+	return track, nil
+}
+
+// GetCaptionTracks returns the tracks of a video ordered by language.
+func (c Client) GetCaptionTracks(videoID uuid.UUID) ([]CaptionTrack, error) {
+	query := `
+	SELECT` + captionTrackColumns + `
+	FROM caption_tracks
+	WHERE video_id = ?
+	ORDER BY language
+	`
+	rows, err := c.db.Query(query, videoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tracks := []CaptionTrack{}
+	for rows.Next() {
+		track, err := scanCaptionTrack(rows)
+		if err != nil {
+			return nil, err
+		}
+		tracks = append(tracks, track)
+	}
+	return tracks, rows.Err()
+}
+
+func (c Client) DeleteCaptionTrack(id uuid.UUID) error {
+	query := `
+	DELETE FROM caption_tracks
+	WHERE id = ?
+	`
+	_, err := c.db.Exec(query, id)
+	return err
+}
@@ -4,6 +4,8 @@ import (
 	"database/sql"
 	"fmt"
 
+	"github.com/google/uuid"
+
 	_ "github.com/mattn/go-sqlite3"
 )
 
@@ -16,6 +18,9 @@ func NewClient(pathToDB string) (Client, error) {
 	if err != nil {
 		return Client{}, err
 	}
+	// SQLite allows a single writer; sharing one connection between the
+	// handlers and the background workers avoids "database is locked".
+	db.SetMaxOpenConns(1)
 	c := Client{db}
 	err = c.autoMigrate()
 	if err != nil {
@@ -72,16 +77,377 @@ func (c *Client) autoMigrate() error {
 	if err != nil {
 		return err
 	}
+
+	blobDeletionTable := `
+	CREATE TABLE IF NOT EXISTS blob_deletions (
+		id TEXT PRIMARY KEY,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		key TEXT NOT NULL,
+		is_prefix BOOLEAN NOT NULL DEFAULT FALSE,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		last_error TEXT,
+		next_attempt_at TIMESTAMP NOT NULL
+	);
+	`
+	_, err = c.db.Exec(blobDeletionTable)
+	if err != nil {
+		return err
+	}
+
+	videoUploadTable := `
+	CREATE TABLE IF NOT EXISTS video_uploads (
+		video_id TEXT PRIMARY KEY,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		user_id TEXT NOT NULL,
+		upload_length INTEGER NOT NULL,
+		upload_offset INTEGER NOT NULL DEFAULT 0,
+		mime_type TEXT NOT NULL,
+		file_path TEXT NOT NULL,
+		FOREIGN KEY(video_id) REFERENCES videos(id)
+	);
+	`
+	_, err = c.db.Exec(videoUploadTable)
+	if err != nil {
+		return err
+	}
+
+	directUploadTable := `
+	CREATE TABLE IF NOT EXISTS direct_uploads (
+		video_id TEXT PRIMARY KEY,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		user_id TEXT NOT NULL,
+		upload_id TEXT NOT NULL,
+		key TEXT NOT NULL,
+		mime_type TEXT NOT NULL,
+		FOREIGN KEY(video_id) REFERENCES videos(id)
+	);
+	`
+	_, err = c.db.Exec(directUploadTable)
+	if err != nil {
+		return err
+	}
+
+	captionTrackTable := `
+	CREATE TABLE IF NOT EXISTS caption_tracks (
+		id TEXT PRIMARY KEY,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		video_id TEXT NOT NULL,
+		language TEXT NOT NULL,
+		label TEXT NOT NULL,
+		url TEXT NOT NULL,
+		UNIQUE(video_id, language),
+		FOREIGN KEY(video_id) REFERENCES videos(id)
+	);
+	`
+	_, err = c.db.Exec(captionTrackTable)
+	if err != nil {
+		return err
+	}
+
+	userTokenTable := `
+	CREATE TABLE IF NOT EXISTS user_tokens (
+		token_hash TEXT PRIMARY KEY,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		user_id TEXT NOT NULL,
+		purpose TEXT NOT NULL,
+		expires_at TIMESTAMP NOT NULL,
+		used_at TIMESTAMP,
+		FOREIGN KEY(user_id) REFERENCES users(id)
+	);
+	`
+	_, err = c.db.Exec(userTokenTable)
+	if err != nil {
+		return err
+	}
+
+	apiKeyTable := `
+	CREATE TABLE IF NOT EXISTS api_keys (
+		id TEXT PRIMARY KEY,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		user_id TEXT NOT NULL,
+		name TEXT NOT NULL,
+		prefix TEXT NOT NULL UNIQUE,
+		key_hash TEXT NOT NULL,
+		scopes TEXT NOT NULL,
+		last_used_at TIMESTAMP,
+		revoked_at TIMESTAMP,
+		FOREIGN KEY(user_id) REFERENCES users(id)
+	);
+	`
+	_, err = c.db.Exec(apiKeyTable)
+	if err != nil {
+		return err
+	}
+	// Keys created without scopes used to be stored with an empty list,
+	// which granted every scope. The scopes are spelled out now.
+	_, err = c.db.Exec(`UPDATE api_keys SET scopes = '["videos:read","videos:write","account"]' WHERE scopes = '[]'`)
+	if err != nil {
+		return err
+	}
+
+	shareLinkTable := `
+	CREATE TABLE IF NOT EXISTS share_links (
+		id TEXT PRIMARY KEY,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		token TEXT NOT NULL UNIQUE,
+		video_id TEXT NOT NULL,
+		expires_at TIMESTAMP,
+		max_views INTEGER,
+		view_count INTEGER NOT NULL DEFAULT 0,
+		password_hash TEXT,
+		revoked_at TIMESTAMP,
+		FOREIGN KEY(video_id) REFERENCES videos(id)
+	);
+	`
+	_, err = c.db.Exec(shareLinkTable)
+	if err != nil {
+		return err
+	}
+
+	err = c.addColumnIfMissing("videos", "status", "TEXT")
+	if err != nil {
+		return err
+	}
+	err = c.addColumnIfMissing("videos", "failure_reason", "TEXT")
+	if err != nil {
+		return err
+	}
+	err = c.addColumnIfMissing("videos", "hls_url", "TEXT")
+	if err != nil {
+		return err
+	}
+	err = c.addColumnIfMissing("videos", "dash_url", "TEXT")
+	if err != nil {
+		return err
+	}
+	err = c.addColumnIfMissing("videos", "thumbnails", "TEXT")
+	if err != nil {
+		return err
+	}
+	err = c.addColumnIfMissing("videos", "blurhash", "TEXT")
+	if err != nil {
+		return err
+	}
+	err = c.addColumnIfMissing("videos", "lqip", "TEXT")
+	if err != nil {
+		return err
+	}
+	err = c.addColumnIfMissing("videos", "original_url", "TEXT")
+	if err != nil {
+		return err
+	}
+	err = c.addColumnIfMissing("videos", "trickplay", "TEXT")
+	if err != nil {
+		return err
+	}
+	mediaColumns := []struct{ name, definition string }{
+		{"duration_seconds", "REAL"},
+		{"container", "TEXT"},
+		{"video_codec", "TEXT"},
+		{"audio_codec", "TEXT"},
+		{"bit_rate", "INTEGER"},
+		{"frame_rate", "REAL"},
+		{"width", "INTEGER"},
+		{"height", "INTEGER"},
+		{"audio_channels", "INTEGER"},
+		{"rotation", "INTEGER"},
+	}
+	for _, column := range mediaColumns {
+		err = c.addColumnIfMissing("videos", column.name, column.definition)
+		if err != nil {
+			return err
+		}
+	}
+	// Videos from before visibility levels become private, their owners can
+	// share them again explicitly.
+	err = c.addColumnIfMissing("videos", "visibility", "TEXT NOT NULL DEFAULT 'private'")
+	if err != nil {
+		return err
+	}
+	_, err = c.db.Exec(`UPDATE videos SET status = 'ready' WHERE status IS NULL AND video_url IS NOT NULL`)
+	if err != nil {
+		return err
+	}
+	err = c.addColumnIfMissing("blob_deletions", "is_file", "BOOLEAN NOT NULL DEFAULT FALSE")
+	if err != nil {
+		return err
+	}
+	err = c.addColumnIfMissing("blob_deletions", "upload_id", "TEXT")
+	if err != nil {
+		return err
+	}
+	err = c.addColumnIfMissing("users", "email_verified_at", "TIMESTAMP")
+	if err != nil {
+		return err
+	}
+	err = c.addColumnIfMissing("users", "tokens_valid_after", "TIMESTAMP")
+	if err != nil {
+		return err
+	}
+	err = c.addColumnIfMissing("refresh_tokens", "family_id", "TEXT")
+	if err != nil {
+		return err
+	}
+	err = c.addColumnIfMissing("refresh_tokens", "parent_token", "TEXT")
+	if err != nil {
+		return err
+	}
+	refreshTokenColumns := []struct{ name, definition string }{
+		{"user_agent", "TEXT"},
+		{"ip_address", "TEXT"},
+		{"last_used_at", "TIMESTAMP"},
+	}
+	for _, column := range refreshTokenColumns {
+		err = c.addColumnIfMissing("refresh_tokens", column.name, column.definition)
+		if err != nil {
+			return err
+		}
+	}
+	err = c.migrateRefreshTokenFamilies()
+	if err != nil {
+		return err
+	}
+	_, err = c.db.Exec(`CREATE INDEX IF NOT EXISTS refresh_tokens_family_id ON refresh_tokens(family_id)`)
+	if err != nil {
+		return err
+	}
+
+	jobTable := `
+	CREATE TABLE IF NOT EXISTS jobs (
+		id TEXT PRIMARY KEY,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		video_id TEXT NOT NULL,
+		kind TEXT NOT NULL,
+		payload TEXT NOT NULL,
+		status TEXT NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		last_error TEXT,
+		run_at TIMESTAMP NOT NULL
+	);
+	`
+	_, err = c.db.Exec(jobTable)
+	if err != nil {
+		return err
+	}
 	return nil
 }
 
+// addColumnIfMissing lets tables created by older versions pick up new
+// columns, since CREATE TABLE IF NOT EXISTS leaves them untouched.
+// migrateRefreshTokenFamilies gives tokens issued before rotation a family
+// of their own. The family ID is shown to users as the session ID, so it
+// can't be a token; an earlier version backfilled families with their root
+// token, and every token of such a family is moved to one new ID.
+func (c *Client) migrateRefreshTokenFamilies() error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+	UPDATE refresh_tokens
+	SET family_id = lower(hex(randomblob(16)))
+	WHERE family_id IS NULL
+	`)
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(`
+	SELECT DISTINCT family_id
+	FROM refresh_tokens
+	WHERE family_id IN (SELECT token FROM refresh_tokens)
+		OR family_id IN (SELECT parent_token FROM refresh_tokens)
+	`)
+	if err != nil {
+		return err
+	}
+	var legacyIDs []string
+	for rows.Next() {
+		var familyID string
+		if err := rows.Scan(&familyID); err != nil {
+			rows.Close()
+			return err
+		}
+		legacyIDs = append(legacyIDs, familyID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, familyID := range legacyIDs {
+		_, err := tx.Exec(`UPDATE refresh_tokens SET family_id = ? WHERE family_id = ?`, uuid.NewString(), familyID)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (c *Client) addColumnIfMissing(table, column, definition string) error {
+	rows, err := c.db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			colType   string
+			notNull   bool
+			dfltValue sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dfltValue, &pk); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	_, err = c.db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
 func (c Client) Reset() error {
 	if _, err := c.db.Exec("DELETE FROM refresh_tokens"); err != nil {
 		return fmt.Errorf("failed to reset table refresh_tokens: %w", err)
 	}
+	if _, err := c.db.Exec("DELETE FROM user_tokens"); err != nil {
+		return fmt.Errorf("failed to reset table user_tokens: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM api_keys"); err != nil {
+		return fmt.Errorf("failed to reset table api_keys: %w", err)
+	}
 	if _, err := c.db.Exec("DELETE FROM users"); err != nil {
 		return fmt.Errorf("failed to reset table users: %w", err)
 	}
+	if _, err := c.db.Exec("DELETE FROM share_links"); err != nil {
+		return fmt.Errorf("failed to reset table share_links: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM caption_tracks"); err != nil {
+		return fmt.Errorf("failed to reset table caption_tracks: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM jobs"); err != nil {
+		return fmt.Errorf("failed to reset table jobs: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM direct_uploads"); err != nil {
+		return fmt.Errorf("failed to reset table direct_uploads: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM video_uploads"); err != nil {
+		return fmt.Errorf("failed to reset table video_uploads: %w", err)
+	}
 	if _, err := c.db.Exec("DELETE FROM videos"); err != nil {
 		return fmt.Errorf("failed to reset table videos: %w", err)
 	}
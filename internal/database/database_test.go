@@ -0,0 +1,33 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func newTestClient(t *testing.T) Client {
+	t.Helper()
+	c, err := NewClient(filepath.Join(t.TempDir(), "tubely.db"))
+	if err != nil {
+		t.Fatalf("NewClient() err = %v", err)
+	}
+	return c
+}
+
+func newTestUser(t *testing.T, c Client, email string) User {
+	t.Helper()
+	user, err := c.CreateUser(CreateUserParams{Email: email, Password: "hash"})
+	if err != nil {
+		t.Fatalf("CreateUser() err = %v", err)
+	}
+	return *user
+}
+
+func newTestVideo(t *testing.T, c Client, user User) Video {
+	t.Helper()
+	video, err := c.CreateVideo(CreateVideoParams{Title: "Title", Description: "Description", UserID: user.ID})
+	if err != nil {
+		t.Fatalf("CreateVideo() err = %v", err)
+	}
+	return video
+}
@@ -0,0 +1,84 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DirectUpload is a multipart upload that the client sends straight to
+// the storage backend through presigned part URLs.
+type DirectUpload struct {
+	CreatedAt time.Time `json:"created_at"`
+	CreateDirectUploadParams
+}
+
+type CreateDirectUploadParams struct {
+	VideoID  uuid.UUID `json:"video_id"`
+	UserID   uuid.UUID `json:"user_id"`
+	UploadID string    `json:"upload_id"`
+	Key      string    `json:"key"`
+	MimeType string    `json:"mime_type"`
+}
+
+func (c Client) CreateDirectUpload(params CreateDirectUploadParams) (DirectUpload, error) {
+	query := `
+	INSERT OR REPLACE INTO direct_uploads (
+		video_id,
+		created_at,
+		user_id,
+		upload_id,
+		key,
+		mime_type
+	) VALUES (?, CURRENT_TIMESTAMP, ?, ?, ?, ?)
+	`
+	_, err := c.db.Exec(query, params.VideoID, params.UserID, params.UploadID, params.Key, params.MimeType)
+	if err != nil {
+		return DirectUpload{}, err
+	}
+
+	return c.GetDirectUpload(params.VideoID)
+}
+
+func (c Client) GetDirectUpload(videoID uuid.UUID) (DirectUpload, error) {
+	query := `
+	SELECT
+		video_id,
+		created_at,
+		user_id,
+		upload_id,
+		key,
+		mime_type
+	FROM direct_uploads
+	WHERE video_id = ?
+	`
+
+	var upload DirectUpload
+	err := c.db.QueryRow(query, videoID).Scan(
+		&upload.VideoID,
+		&upload.CreatedAt,
+		&upload.UserID,
+		&upload.UploadID,
+		&upload.Key,
+		&upload.MimeType,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return DirectUpload{}, nil
+		}
+		return DirectUpload{}, err
+	}
+
+	return upload, nil
+}
+
+func (c Client) DeleteDirectUpload(videoID uuid.UUID) error {
+	query := `
+	DELETE FROM direct_uploads
+	WHERE video_id = ?
+	`
+	_, err := c.db.Exec(query, videoID)
+	return err
+}
@@ -0,0 +1,188 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type JobStatus string
+
+const (
+	JobStatusQueued  JobStatus = "queued"
+	JobStatusRunning JobStatus = "running"
+	JobStatusDone    JobStatus = "done"
+	JobStatusFailed  JobStatus = "failed"
+)
+
+// Job is a unit of background work for a video. Payload is JSON whose
+// shape depends on Kind.
+type Job struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Status    JobStatus `json:"status"`
+	Attempts  int       `json:"attempts"`
+	LastError *string   `json:"last_error"`
+	RunAt     time.Time `json:"run_at"`
+	CreateJobParams
+}
+
+type CreateJobParams struct {
+	VideoID uuid.UUID `json:"video_id"`
+	Kind    string    `json:"kind"`
+	Payload string    `json:"payload"`
+}
+
+const jobColumns = `
+		id,
+		created_at,
+		updated_at,
+		video_id,
+		kind,
+		payload,
+		status,
+		attempts,
+		last_error,
+		run_at`
+
+func scanJob(row scanner) (Job, error) {
+	var job Job
+	err := row.Scan(
+		&job.ID,
+		&job.CreatedAt,
+		&job.UpdatedAt,
+		&job.VideoID,
+		&job.Kind,
+		&job.Payload,
+		&job.Status,
+		&job.Attempts,
+		&job.LastError,
+		&job.RunAt,
+	)
+	return job, err
+}
+
+func (c Client) CreateJob(params CreateJobParams) (Job, error) {
+	id := uuid.New()
+	query := `
+	INSERT INTO jobs (
+		id,
+		created_at,
+		updated_at,
+		video_id,
+		kind,
+		payload,
+		status,
+		attempts,
+		run_at
+	) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?, ?, 0, ?)
+	`
+	_, err := c.db.Exec(query, id, params.VideoID, params.Kind, params.Payload, JobStatusQueued, time.Now().UTC())
+	if err != nil {
+		return Job{}, err
+	}
+
+	return c.GetJob(id)
+}
+
+func (c Client) GetJob(id uuid.UUID) (Job, error) {
+	query := `
+	SELECT` + jobColumns + `
+	FROM jobs
+	WHERE id = ?
+	`
+
+	job, err := scanJob(c.db.QueryRow(query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Job{}, nil
+		}
+		return Job{}, err
+	}
+	return job, nil
+}
+
+// ClaimJob atomically marks the oldest due job as running and returns it.
+// ok is false when there is nothing to do.
+func (c Client) ClaimJob(now time.Time) (job Job, ok bool, err error) {
+	query := `
+	UPDATE jobs
+	SET
+		status = ?,
+		attempts = attempts + 1,
+		updated_at = CURRENT_TIMESTAMP
+	WHERE id = (
+		SELECT id FROM jobs
+		WHERE status = ? AND run_at <= ?
+		ORDER BY run_at
+		LIMIT 1
+	)
+	RETURNING` + jobColumns
+
+	job, err = scanJob(c.db.QueryRow(query, JobStatusRunning, JobStatusQueued, now.UTC()))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Job{}, false, nil
+		}
+		return Job{}, false, err
+	}
+	return job, true, nil
+}
+
+func (c Client) CompleteJob(id uuid.UUID) error {
+	query := `
+	UPDATE jobs
+	SET
+		status = ?,
+		last_error = NULL,
+		updated_at = CURRENT_TIMESTAMP
+	WHERE id = ?
+	`
+	_, err := c.db.Exec(query, JobStatusDone, id)
+	return err
+}
+
+// RetryJob puts a failed job back in the queue to run again at runAt.
+func (c Client) RetryJob(id uuid.UUID, lastError string, runAt time.Time) error {
+	query := `
+	UPDATE jobs
+	SET
+		status = ?,
+		last_error = ?,
+		run_at = ?,
+		updated_at = CURRENT_TIMESTAMP
+	WHERE id = ?
+	`
+	_, err := c.db.Exec(query, JobStatusQueued, lastError, runAt.UTC(), id)
+	return err
+}
+
+func (c Client) FailJob(id uuid.UUID, lastError string) error {
+	query := `
+	UPDATE jobs
+	SET
+		status = ?,
+		last_error = ?,
+		updated_at = CURRENT_TIMESTAMP
+	WHERE id = ?
+	`
+	_, err := c.db.Exec(query, JobStatusFailed, lastError, id)
+	return err
+}
+
+// RequeueRunningJobs returns jobs that were running when the server last
+// stopped to the queue. It must only be called before workers start.
+func (c Client) RequeueRunningJobs() error {
+	query := `
+	UPDATE jobs
+	SET
+		status = ?,
+		updated_at = CURRENT_TIMESTAMP
+	WHERE status = ?
+	`
+	_, err := c.db.Exec(query, JobStatusQueued, JobStatusRunning)
+	return err
+}
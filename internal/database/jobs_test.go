@@ -0,0 +1,94 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClaimJob(t *testing.T) {
+	c := newTestClient(t)
+	video := newTestVideo(t, c, newTestUser(t, c, "owner@example.com"))
+
+	first, err := c.CreateJob(CreateJobParams{VideoID: video.ID, Kind: "test", Payload: "{}"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	later, err := c.CreateJob(CreateJobParams{VideoID: video.ID, Kind: "test", Payload: "{}"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	if err := c.RetryJob(later.ID, "not yet", now.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	claimed, ok, err := c.ClaimJob(now)
+	if err != nil || !ok {
+		t.Fatalf("ClaimJob() = %v, %v", ok, err)
+	}
+	if claimed.ID != first.ID || claimed.Status != JobStatusRunning || claimed.Attempts != 1 {
+		t.Errorf("claimed %v (%v, %d attempts), want %v running with 1 attempt", claimed.ID, claimed.Status, claimed.Attempts, first.ID)
+	}
+
+	if _, ok, err := c.ClaimJob(now); err != nil || ok {
+		t.Errorf("ClaimJob() claimed a running or future job: %v, %v", ok, err)
+	}
+
+	claimed, ok, err = c.ClaimJob(now.Add(2 * time.Minute))
+	if err != nil || !ok || claimed.ID != later.ID {
+		t.Fatalf("ClaimJob() = %v, %v, %v, want the retried job once due", claimed.ID, ok, err)
+	}
+	if claimed.LastError == nil || *claimed.LastError != "not yet" {
+		t.Errorf("LastError = %v, want the retry reason", claimed.LastError)
+	}
+}
+
+func TestJobLifecycle(t *testing.T) {
+	c := newTestClient(t)
+	video := newTestVideo(t, c, newTestUser(t, c, "owner@example.com"))
+	job, err := c.CreateJob(CreateJobParams{VideoID: video.ID, Kind: "test", Payload: "{}"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != JobStatusQueued || job.Attempts != 0 {
+		t.Fatalf("new job is %v with %d attempts", job.Status, job.Attempts)
+	}
+
+	// A server stopping mid-run leaves the job running until the next start.
+	if _, _, err := c.ClaimJob(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RequeueRunningJobs(); err != nil {
+		t.Fatalf("RequeueRunningJobs() err = %v", err)
+	}
+	claimed, ok, err := c.ClaimJob(time.Now())
+	if err != nil || !ok || claimed.Attempts != 2 {
+		t.Fatalf("ClaimJob() after requeue = %+v, %v, %v", claimed, ok, err)
+	}
+
+	if err := c.FailJob(job.ID, "broken"); err != nil {
+		t.Fatalf("FailJob() err = %v", err)
+	}
+	failed, err := c.GetJob(job.ID)
+	if err != nil || failed.Status != JobStatusFailed || failed.LastError == nil || *failed.LastError != "broken" {
+		t.Errorf("GetJob() = %+v, %v, want failed with the error", failed, err)
+	}
+	if _, ok, _ := c.ClaimJob(time.Now().Add(time.Hour)); ok {
+		t.Error("ClaimJob() picked up a failed job")
+	}
+
+	next, err := c.CreateJob(CreateJobParams{VideoID: video.ID, Kind: "test", Payload: "{}"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RetryJob(next.ID, "flaky", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.CompleteJob(next.ID); err != nil {
+		t.Fatalf("CompleteJob() err = %v", err)
+	}
+	done, err := c.GetJob(next.ID)
+	if err != nil || done.Status != JobStatusDone || done.LastError != nil {
+		t.Errorf("GetJob() = %+v, %v, want done without an error", done, err)
+	}
+}
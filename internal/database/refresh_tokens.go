@@ -2,35 +2,45 @@ package database
 
 import (
 	"database/sql"
+	"errors"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+// ErrRefreshTokenUnusable is returned when rotating a refresh token that has
+// already been revoked or rotated, or has expired.
+var ErrRefreshTokenUnusable = errors.New("refresh token is revoked or expired")
+
+// RefreshToken is one link in a token family. Each refresh revokes the
+// presented token and issues a child in the same family, so a family
+// stands for one login.
 type RefreshToken struct {
 	CreateRefreshTokenParams
-	CreatedAt time.Time  `json:"created_at"`
-	UpdatedAt time.Time  `json:"updated_at"`
-	RevokedAt *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
 }
 
 type CreateRefreshTokenParams struct {
-	Token     string    `json:"token"`
-	UserID    uuid.UUID `json:"user_id"`
-	ExpiresAt time.Time `json:"expires_at"`
+	Token       string    `json:"token"`
+	UserID      uuid.UUID `json:"user_id"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	FamilyID    string    `json:"family_id"`
+	ParentToken *string   `json:"-"`
+	// UserAgent and IPAddress describe the client the token was issued to.
+	UserAgent string `json:"user_agent"`
+	IPAddress string `json:"ip_address"`
 }
 
+// CreateRefreshToken stores a token that starts a new family unless
+// params.FamilyID is set.
 func (c Client) CreateRefreshToken(params CreateRefreshTokenParams) (RefreshToken, error) {
-	query := `
-		INSERT INTO refresh_tokens (
-			token,
-			created_at,
-			updated_at,
-			user_id,
-			expires_at
-		) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?)
-	`
-	_, err := c.db.Exec(query, params.Token, params.UserID.String(), params.ExpiresAt)
+	if params.FamilyID == "" {
+		params.FamilyID = uuid.NewString()
+	}
+	_, err := c.db.Exec(insertRefreshTokenQuery, refreshTokenArgs(params)...)
 	if err != nil {
 		return RefreshToken{}, err
 	}
@@ -38,6 +48,74 @@ func (c Client) CreateRefreshToken(params CreateRefreshTokenParams) (RefreshToke
 	return c.GetRefreshToken(params.Token)
 }
 
+const insertRefreshTokenQuery = `
+	INSERT INTO refresh_tokens (
+		token,
+		created_at,
+		updated_at,
+		user_id,
+		expires_at,
+		family_id,
+		parent_token,
+		user_agent,
+		ip_address,
+		last_used_at
+	) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+`
+
+func refreshTokenArgs(params CreateRefreshTokenParams) []any {
+	return []any{
+		params.Token,
+		params.UserID.String(),
+		params.ExpiresAt,
+		params.FamilyID,
+		params.ParentToken,
+		params.UserAgent,
+		params.IPAddress,
+	}
+}
+
+// RotateRefreshToken revokes the token presented as parent and stores next
+// as its child in the same family. It fails with ErrRefreshTokenUnusable
+// if the parent was already revoked or has expired, including when a
+// concurrent request rotated it first.
+func (c Client) RotateRefreshToken(parent RefreshToken, next CreateRefreshTokenParams, now time.Time) (RefreshToken, error) {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return RefreshToken{}, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`
+	UPDATE refresh_tokens
+	SET revoked_at = ?, updated_at = ?, last_used_at = ?
+	WHERE token = ? AND revoked_at IS NULL AND expires_at > ?
+	`, now.UTC(), now.UTC(), now.UTC(), parent.Token, now.UTC())
+	if err != nil {
+		return RefreshToken{}, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return RefreshToken{}, err
+	}
+	if n != 1 {
+		return RefreshToken{}, ErrRefreshTokenUnusable
+	}
+
+	next.UserID = parent.UserID
+	next.FamilyID = parent.FamilyID
+	next.ParentToken = &parent.Token
+	_, err = tx.Exec(insertRefreshTokenQuery, refreshTokenArgs(next)...)
+	if err != nil {
+		return RefreshToken{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return RefreshToken{}, err
+	}
+
+	return c.GetRefreshToken(next.Token)
+}
+
 func (c Client) RevokeRefreshToken(token string) error {
 	query := `
 		UPDATE refresh_tokens
@@ -48,16 +126,50 @@ func (c Client) RevokeRefreshToken(token string) error {
 	return err
 }
 
+// RevokeRefreshTokenFamily revokes every token that is still active in the
+// family, ending the login it belongs to.
+func (c Client) RevokeRefreshTokenFamily(familyID string) error {
+	query := `
+		UPDATE refresh_tokens
+		SET revoked_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE family_id = ? AND revoked_at IS NULL
+	`
+	_, err := c.db.Exec(query, familyID)
+	return err
+}
+
 func (c Client) GetRefreshToken(token string) (RefreshToken, error) {
 	query := `
-		SELECT token, created_at, updated_at, user_id, expires_at, revoked_at
+		SELECT
+			token,
+			created_at,
+			updated_at,
+			user_id,
+			expires_at,
+			revoked_at,
+			family_id,
+			parent_token,
+			COALESCE(user_agent, ''),
+			COALESCE(ip_address, ''),
+			last_used_at
 		FROM refresh_tokens
 		WHERE token = ?
 	`
 	var rt RefreshToken
 	var userID string
-	err := c.db.QueryRow(query, token).
-		Scan(&rt.Token, &rt.CreatedAt, &rt.UpdatedAt, &userID, &rt.ExpiresAt, &rt.RevokedAt)
+	err := c.db.QueryRow(query, token).Scan(
+		&rt.Token,
+		&rt.CreatedAt,
+		&rt.UpdatedAt,
+		&userID,
+		&rt.ExpiresAt,
+		&rt.RevokedAt,
+		&rt.FamilyID,
+		&rt.ParentToken,
+		&rt.UserAgent,
+		&rt.IPAddress,
+		&rt.LastUsedAt,
+	)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return RefreshToken{}, nil
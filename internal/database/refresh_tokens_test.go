@@ -0,0 +1,143 @@
+package database
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRotateRefreshToken(t *testing.T) {
+	c := newTestClient(t)
+	user := newTestUser(t, c, "user@example.com")
+	now := time.Now().UTC()
+
+	root, err := c.CreateRefreshToken(CreateRefreshTokenParams{Token: "root", UserID: user.ID, ExpiresAt: now.Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root.FamilyID == "" || root.FamilyID == root.Token {
+		t.Fatalf("FamilyID = %q, want a new ID", root.FamilyID)
+	}
+
+	child, err := c.RotateRefreshToken(root, CreateRefreshTokenParams{Token: "child", ExpiresAt: now.Add(2 * time.Hour)}, now)
+	if err != nil {
+		t.Fatalf("RotateRefreshToken() err = %v", err)
+	}
+	if child.UserID != user.ID || child.FamilyID != root.FamilyID || child.ParentToken == nil || *child.ParentToken != root.Token {
+		t.Errorf("child = %+v, want it in the root's family", child.CreateRefreshTokenParams)
+	}
+	if root, _ = c.GetRefreshToken(root.Token); root.RevokedAt == nil {
+		t.Error("rotated token wasn't revoked")
+	}
+
+	// A second rotation of the same token is how a reused token shows up.
+	_, err = c.RotateRefreshToken(root, CreateRefreshTokenParams{Token: "reused", ExpiresAt: now.Add(2 * time.Hour)}, now)
+	if !errors.Is(err, ErrRefreshTokenUnusable) {
+		t.Errorf("rotating a rotated token: err = %v, want ErrRefreshTokenUnusable", err)
+	}
+	if reused, _ := c.GetRefreshToken("reused"); reused.Token != "" {
+		t.Error("a failed rotation stored its child")
+	}
+
+	_, err = c.RotateRefreshToken(child, CreateRefreshTokenParams{Token: "late", ExpiresAt: now.Add(3 * time.Hour)}, child.ExpiresAt)
+	if !errors.Is(err, ErrRefreshTokenUnusable) {
+		t.Errorf("rotating an expired token: err = %v, want ErrRefreshTokenUnusable", err)
+	}
+}
+
+func TestRevokeRefreshTokenFamily(t *testing.T) {
+	c := newTestClient(t)
+	user := newTestUser(t, c, "user@example.com")
+	now := time.Now().UTC()
+
+	root, err := c.CreateRefreshToken(CreateRefreshTokenParams{Token: "root", UserID: user.ID, ExpiresAt: now.Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	child, err := c.RotateRefreshToken(root, CreateRefreshTokenParams{Token: "child", ExpiresAt: now.Add(time.Hour)}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := c.CreateRefreshToken(CreateRefreshTokenParams{Token: "other", UserID: user.ID, ExpiresAt: now.Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.RevokeRefreshTokenFamily(root.FamilyID); err != nil {
+		t.Fatal(err)
+	}
+	if child, _ = c.GetRefreshToken(child.Token); child.RevokedAt == nil {
+		t.Error("active token of the family wasn't revoked")
+	}
+	if other, _ = c.GetRefreshToken(other.Token); other.RevokedAt != nil {
+		t.Error("token of another family was revoked")
+	}
+}
+
+func TestMigrateRefreshTokenFamilies(t *testing.T) {
+	c := newTestClient(t)
+	user := newTestUser(t, c, "user@example.com")
+	now := time.Now().UTC()
+
+	// As left behind by earlier versions: a token from before rotation
+	// existed, and a family keyed by its root token that has rotated once.
+	insert := func(token string, familyID, parentToken *string, revokedAt *time.Time) {
+		t.Helper()
+		_, err := c.db.Exec(`
+		INSERT INTO refresh_tokens (token, created_at, updated_at, user_id, expires_at, revoked_at, family_id, parent_token)
+		VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?, ?, ?)
+		`, token, user.ID.String(), now.Add(time.Hour), revokedAt, familyID, parentToken)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	root := "root"
+	insert("unmigrated", nil, nil, nil)
+	insert(root, &root, nil, &now)
+	insert("child", &root, &root, nil)
+
+	if err := c.autoMigrate(); err != nil {
+		t.Fatalf("autoMigrate() err = %v", err)
+	}
+
+	unmigrated, _ := c.GetRefreshToken("unmigrated")
+	migratedRoot, _ := c.GetRefreshToken(root)
+	child, _ := c.GetRefreshToken("child")
+	if unmigrated.FamilyID == "" || unmigrated.FamilyID == unmigrated.Token {
+		t.Errorf("unmigrated token got family %q, want a new ID", unmigrated.FamilyID)
+	}
+	if migratedRoot.FamilyID == root || migratedRoot.FamilyID != child.FamilyID {
+		t.Errorf("families = %q (root), %q (child), want one new ID for both", migratedRoot.FamilyID, child.FamilyID)
+	}
+	if unmigrated.FamilyID == child.FamilyID {
+		t.Error("separate families were merged")
+	}
+
+	sessions, err := c.GetSessions(user.ID, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := map[string]bool{}
+	for _, session := range sessions {
+		ids[session.ID] = true
+	}
+	if len(sessions) != 2 || !ids[unmigrated.FamilyID] || !ids[child.FamilyID] {
+		t.Errorf("GetSessions() = %+v, want the unmigrated token and the rotated family", sessions)
+	}
+
+	// Reusing the rotated root still ends the session it belongs to.
+	if err := c.RevokeRefreshTokenFamily(migratedRoot.FamilyID); err != nil {
+		t.Fatal(err)
+	}
+	if child, _ = c.GetRefreshToken("child"); child.RevokedAt == nil {
+		t.Error("revoking the root's family didn't revoke the child")
+	}
+
+	// Running the migration again leaves the new IDs alone.
+	if err := c.autoMigrate(); err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := c.GetRefreshToken("unmigrated"); again.FamilyID != unmigrated.FamilyID {
+		t.Errorf("family changed on a second run: %q to %q", unmigrated.FamilyID, again.FamilyID)
+	}
+}
@@ -0,0 +1,98 @@
+package database
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Session is a login as seen by its user: one refresh token family,
+// described by the token that is currently active in it.
+type Session struct {
+	ID         string    `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+}
+
+// GetSessions lists the user's sessions that still have an active refresh
+// token, most recently used first.
+func (c Client) GetSessions(userID uuid.UUID, now time.Time) ([]Session, error) {
+	query := `
+	SELECT
+		rt.family_id,
+		root.created_at,
+		rt.created_at,
+		rt.last_used_at,
+		rt.expires_at,
+		COALESCE(rt.user_agent, ''),
+		COALESCE(rt.ip_address, '')
+	FROM refresh_tokens rt
+	JOIN refresh_tokens root ON root.family_id = rt.family_id AND root.parent_token IS NULL
+	WHERE rt.user_id = ? AND rt.revoked_at IS NULL AND rt.expires_at > ?
+	ORDER BY COALESCE(rt.last_used_at, rt.created_at) DESC
+	`
+	rows, err := c.db.Query(query, userID.String(), now.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []Session{}
+	for rows.Next() {
+		var session Session
+		var issuedAt time.Time
+		var lastUsedAt *time.Time
+		err := rows.Scan(
+			&session.ID,
+			&session.CreatedAt,
+			&issuedAt,
+			&lastUsedAt,
+			&session.ExpiresAt,
+			&session.UserAgent,
+			&session.IPAddress,
+		)
+		if err != nil {
+			return nil, err
+		}
+		session.LastUsedAt = issuedAt
+		if lastUsedAt != nil {
+			session.LastUsedAt = *lastUsedAt
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// RevokeSession revokes the user's session with the given ID, reporting
+// whether it was still active.
+func (c Client) RevokeSession(userID uuid.UUID, sessionID string) (bool, error) {
+	query := `
+	UPDATE refresh_tokens
+	SET revoked_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+	WHERE user_id = ? AND family_id = ? AND revoked_at IS NULL
+	`
+	res, err := c.db.Exec(query, userID.String(), sessionID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// RevokeOtherSessions revokes every session of the user except keepID,
+// which may be empty to revoke them all.
+func (c Client) RevokeOtherSessions(userID uuid.UUID, keepID string) error {
+	query := `
+	UPDATE refresh_tokens
+	SET revoked_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+	WHERE user_id = ? AND family_id != ? AND revoked_at IS NULL
+	`
+	_, err := c.db.Exec(query, userID.String(), keepID)
+	return err
+}
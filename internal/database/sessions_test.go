@@ -0,0 +1,102 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSessions(t *testing.T) {
+	c := newTestClient(t)
+	user := newTestUser(t, c, "user@example.com")
+	other := newTestUser(t, c, "other@example.com")
+	now := time.Now().UTC()
+
+	laptop, err := c.CreateRefreshToken(CreateRefreshTokenParams{Token: "laptop", UserID: user.ID, ExpiresAt: now.Add(time.Hour), UserAgent: "laptop"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	phone, err := c.CreateRefreshToken(CreateRefreshTokenParams{Token: "phone", UserID: user.ID, ExpiresAt: now.Add(time.Hour), UserAgent: "phone"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.CreateRefreshToken(CreateRefreshTokenParams{Token: "expired", UserID: user.ID, ExpiresAt: now.Add(-time.Minute)}); err != nil {
+		t.Fatal(err)
+	}
+	elsewhere, err := c.CreateRefreshToken(CreateRefreshTokenParams{Token: "elsewhere", UserID: other.ID, ExpiresAt: now.Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Rotation keeps a login a single session, described by its newest token.
+	if _, err := c.RotateRefreshToken(laptop, CreateRefreshTokenParams{Token: "laptop-2", ExpiresAt: now.Add(2 * time.Hour), UserAgent: "laptop 2"}, now); err != nil {
+		t.Fatal(err)
+	}
+
+	sessions, err := c.GetSessions(user.ID, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byID := map[string]Session{}
+	for _, session := range sessions {
+		byID[session.ID] = session
+	}
+	if len(sessions) != 2 || byID[laptop.FamilyID].UserAgent != "laptop 2" || byID[phone.FamilyID].UserAgent != "phone" {
+		t.Fatalf("GetSessions() = %+v, want the rotated laptop and the phone", sessions)
+	}
+	if byID[laptop.FamilyID].CreatedAt != laptop.CreatedAt {
+		t.Errorf("CreatedAt = %v, want when the login started (%v)", byID[laptop.FamilyID].CreatedAt, laptop.CreatedAt)
+	}
+
+	if revoked, err := c.RevokeSession(user.ID, elsewhere.FamilyID); err != nil || revoked {
+		t.Errorf("RevokeSession() of another user's session = %v, %v", revoked, err)
+	}
+	if rt, _ := c.GetRefreshToken(elsewhere.Token); rt.RevokedAt != nil {
+		t.Error("another user's session was revoked")
+	}
+
+	if revoked, err := c.RevokeSession(user.ID, phone.FamilyID); err != nil || !revoked {
+		t.Fatalf("RevokeSession() = %v, %v", revoked, err)
+	}
+	if revoked, err := c.RevokeSession(user.ID, phone.FamilyID); err != nil || revoked {
+		t.Errorf("revoking twice = %v, %v, want false", revoked, err)
+	}
+	if sessions, _ := c.GetSessions(user.ID, now); len(sessions) != 1 || sessions[0].ID != laptop.FamilyID {
+		t.Errorf("GetSessions() after revoking = %+v, want only the laptop", sessions)
+	}
+}
+
+func TestRevokeOtherSessions(t *testing.T) {
+	c := newTestClient(t)
+	user := newTestUser(t, c, "user@example.com")
+	other := newTestUser(t, c, "other@example.com")
+	now := time.Now().UTC()
+
+	tokens := map[string]RefreshToken{}
+	for _, params := range []CreateRefreshTokenParams{
+		{Token: "current", UserID: user.ID},
+		{Token: "stale", UserID: user.ID},
+		{Token: "elsewhere", UserID: other.ID},
+	} {
+		params.ExpiresAt = now.Add(time.Hour)
+		rt, err := c.CreateRefreshToken(params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens[rt.Token] = rt
+	}
+
+	if err := c.RevokeOtherSessions(user.ID, tokens["current"].FamilyID); err != nil {
+		t.Fatal(err)
+	}
+	for token, wantRevoked := range map[string]bool{"current": false, "stale": true, "elsewhere": false} {
+		if rt, _ := c.GetRefreshToken(token); (rt.RevokedAt != nil) != wantRevoked {
+			t.Errorf("%v: revoked = %v, want %v", token, rt.RevokedAt != nil, wantRevoked)
+		}
+	}
+
+	if err := c.RevokeOtherSessions(user.ID, ""); err != nil {
+		t.Fatal(err)
+	}
+	if sessions, _ := c.GetSessions(user.ID, now); len(sessions) != 0 {
+		t.Errorf("GetSessions() = %+v, want every session revoked", sessions)
+	}
+}
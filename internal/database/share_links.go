@@ -0,0 +1,174 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ShareLink grants access to a single video through its token, regardless
+// of the video's visibility, until it expires, runs out of views or is
+// revoked.
+type ShareLink struct {
+	ID        uuid.UUID  `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	ViewCount int        `json:"view_count"`
+	RevokedAt *time.Time `json:"revoked_at"`
+	CreateShareLinkParams
+}
+
+type CreateShareLinkParams struct {
+	Token        string     `json:"token"`
+	VideoID      uuid.UUID  `json:"video_id"`
+	ExpiresAt    *time.Time `json:"expires_at"`
+	MaxViews     *int       `json:"max_views"`
+	PasswordHash *string    `json:"-"`
+}
+
+const shareLinkColumns = `
+		id,
+		created_at,
+		token,
+		video_id,
+		expires_at,
+		max_views,
+		view_count,
+		password_hash,
+		revoked_at`
+
+func scanShareLink(row scanner) (ShareLink, error) {
+	var link ShareLink
+	err := row.Scan(
+		&link.ID,
+		&link.CreatedAt,
+		&link.Token,
+		&link.VideoID,
+		&link.ExpiresAt,
+		&link.MaxViews,
+		&link.ViewCount,
+		&link.PasswordHash,
+		&link.RevokedAt,
+	)
+	return link, err
+}
+
+func (c Client) CreateShareLink(params CreateShareLinkParams) (ShareLink, error) {
+	id := uuid.New()
+	query := `
+	INSERT INTO share_links (
+		id,
+		created_at,
+		token,
+		video_id,
+		expires_at,
+		max_views,
+		view_count,
+		password_hash
+	) VALUES (?, CURRENT_TIMESTAMP, ?, ?, ?, ?, 0, ?)
+	`
+	_, err := c.db.Exec(query, id, params.Token, params.VideoID, params.ExpiresAt, params.MaxViews, params.PasswordHash)
+	if err != nil {
+		return ShareLink{}, err
+	}
+
+	return c.GetShareLink(id)
+}
+
+func (c Client) GetShareLink(id uuid.UUID) (ShareLink, error) {
+	query := `
+	SELECT` + shareLinkColumns + `
+	FROM share_links
+	WHERE id = ?
+	`
+	link, err := scanShareLink(c.db.QueryRow(query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ShareLink{}, nil
+		}
+		return ShareLink{}, err
+	}
+	return link, nil
+}
+
+func (c Client) GetShareLinkByToken(token string) (ShareLink, error) {
+	query := `
+	SELECT` + shareLinkColumns + `
+	FROM share_links
+	WHERE token = ?
+	`
+	link, err := scanShareLink(c.db.QueryRow(query, token))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ShareLink{}, nil
+		}
+		return ShareLink{}, err
+	}
+	return link, nil
+}
+
+// GetShareLinks lists a video's links, newest first.
+func (c Client) GetShareLinks(videoID uuid.UUID) ([]ShareLink, error) {
+	query := `
+	SELECT` + shareLinkColumns + `
+	FROM share_links
+	WHERE video_id = ?
+	ORDER BY created_at DESC
+	`
+	rows, err := c.db.Query(query, videoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	links := []ShareLink{}
+	for rows.Next() {
+		link, err := scanShareLink(rows)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, link)
+	}
+	return links, rows.Err()
+}
+
+// Usable reports whether the link can still be used at now, the same
+// check UseShareLink makes when counting a view.
+func (l ShareLink) Usable(now time.Time) bool {
+	return l.RevokedAt == nil &&
+		(l.ExpiresAt == nil || l.ExpiresAt.After(now)) &&
+		(l.MaxViews == nil || l.ViewCount < *l.MaxViews)
+}
+
+// UseShareLink counts a view of the link, reporting false without counting
+// when the link is revoked, expired or has no views left.
+func (c Client) UseShareLink(id uuid.UUID, now time.Time) (bool, error) {
+	query := `
+	UPDATE share_links
+	SET view_count = view_count + 1
+	WHERE id = ?
+		AND revoked_at IS NULL
+		AND (expires_at IS NULL OR expires_at > ?)
+		AND (max_views IS NULL OR view_count < max_views)
+	`
+	res, err := c.db.Exec(query, id, now.UTC())
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+func (c Client) RevokeShareLink(id uuid.UUID) error {
+	query := `
+	UPDATE share_links
+	SET revoked_at = CURRENT_TIMESTAMP
+	WHERE id = ? AND revoked_at IS NULL
+	`
+	_, err := c.db.Exec(query, id)
+	return err
+}
@@ -0,0 +1,68 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestUseShareLink(t *testing.T) {
+	c := newTestClient(t)
+	video := newTestVideo(t, c, newTestUser(t, c, "owner@example.com"))
+	now := time.Now()
+
+	newLink := func(token string, expiresAt *time.Time, maxViews *int) ShareLink {
+		t.Helper()
+		link, err := c.CreateShareLink(CreateShareLinkParams{Token: token, VideoID: video.ID, ExpiresAt: expiresAt, MaxViews: maxViews})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return link
+	}
+	use := func(link ShareLink, at time.Time) bool {
+		t.Helper()
+		used, err := c.UseShareLink(link.ID, at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return used
+	}
+
+	maxViews := 2
+	limited := newLink("limited", nil, &maxViews)
+	for i, want := range []bool{true, true, false} {
+		if got := use(limited, now); got != want {
+			t.Errorf("view %d: UseShareLink() = %v, want %v", i+1, got, want)
+		}
+	}
+	limited, _ = c.GetShareLink(limited.ID)
+	if limited.ViewCount != maxViews || limited.Usable(now) {
+		t.Errorf("ViewCount = %d, Usable() = %v, want %d views and unusable", limited.ViewCount, limited.Usable(now), maxViews)
+	}
+
+	expiresAt := now.Add(time.Hour)
+	expiring := newLink("expiring", &expiresAt, nil)
+	if !use(expiring, expiresAt.Add(-time.Second)) {
+		t.Error("UseShareLink() = false just before expiry")
+	}
+	if use(expiring, expiresAt) || use(expiring, expiresAt.Add(time.Second)) {
+		t.Error("UseShareLink() = true once expired")
+	}
+	if expiring.Usable(expiresAt) {
+		t.Error("Usable() = true at expiry")
+	}
+
+	revoked := newLink("revoked", nil, nil)
+	if err := c.RevokeShareLink(revoked.ID); err != nil {
+		t.Fatal(err)
+	}
+	revoked, _ = c.GetShareLink(revoked.ID)
+	if use(revoked, now) || revoked.Usable(now) {
+		t.Error("revoked link is still usable")
+	}
+
+	if use(ShareLink{ID: uuid.New()}, now) {
+		t.Error("UseShareLink() = true for an unknown link")
+	}
+}
@@ -0,0 +1,93 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UserTokenPurpose says what a single-use user token may be redeemed for.
+type UserTokenPurpose string
+
+const (
+	UserTokenPasswordReset     UserTokenPurpose = "password_reset"
+	UserTokenEmailVerification UserTokenPurpose = "email_verification"
+)
+
+// ErrUserTokenUnusable is returned when redeeming a token that doesn't
+// exist, has expired, was already used or was issued for another purpose.
+var ErrUserTokenUnusable = errors.New("token is invalid or expired")
+
+// CreateUserTokenParams describes a token mailed to a user. Only its hash
+// is stored.
+type CreateUserTokenParams struct {
+	TokenHash string
+	UserID    uuid.UUID
+	Purpose   UserTokenPurpose
+	ExpiresAt time.Time
+}
+
+// CreateUserToken stores a new token and invalidates the user's earlier
+// tokens for the same purpose, so only the latest email works.
+func (c Client) CreateUserToken(params CreateUserTokenParams) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+	UPDATE user_tokens
+	SET used_at = CURRENT_TIMESTAMP
+	WHERE user_id = ? AND purpose = ? AND used_at IS NULL
+	`, params.UserID.String(), params.Purpose)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+	INSERT INTO user_tokens (
+		token_hash,
+		created_at,
+		user_id,
+		purpose,
+		expires_at
+	) VALUES (?, CURRENT_TIMESTAMP, ?, ?, ?)
+	`, params.TokenHash, params.UserID.String(), params.Purpose, params.ExpiresAt.UTC())
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UseUserToken marks the token as used and returns the user it was issued
+// to. Each token can be redeemed once.
+func (c Client) UseUserToken(tokenHash string, purpose UserTokenPurpose, now time.Time) (uuid.UUID, error) {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return uuid.Nil, err
+	}
+	defer tx.Rollback()
+
+	var userID string
+	err = tx.QueryRow(`
+	SELECT user_id
+	FROM user_tokens
+	WHERE token_hash = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?
+	`, tokenHash, purpose, now.UTC()).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return uuid.Nil, ErrUserTokenUnusable
+		}
+		return uuid.Nil, err
+	}
+	_, err = tx.Exec(`UPDATE user_tokens SET used_at = ? WHERE token_hash = ?`, now.UTC(), tokenHash)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return uuid.Nil, err
+	}
+	return uuid.Parse(userID)
+}
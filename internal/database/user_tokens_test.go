@@ -0,0 +1,73 @@
+package database
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestUseUserToken(t *testing.T) {
+	c := newTestClient(t)
+	user := newTestUser(t, c, "user@example.com")
+	now := time.Now().UTC()
+
+	create := func(hash string, purpose UserTokenPurpose) {
+		t.Helper()
+		err := c.CreateUserToken(CreateUserTokenParams{TokenHash: hash, UserID: user.ID, Purpose: purpose, ExpiresAt: now.Add(time.Hour)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	create("reset", UserTokenPasswordReset)
+	if _, err := c.UseUserToken("reset", UserTokenEmailVerification, now); !errors.Is(err, ErrUserTokenUnusable) {
+		t.Errorf("redeemed for another purpose: err = %v, want ErrUserTokenUnusable", err)
+	}
+	userID, err := c.UseUserToken("reset", UserTokenPasswordReset, now)
+	if err != nil || userID != user.ID {
+		t.Fatalf("UseUserToken() = %v, %v, want %v", userID, err, user.ID)
+	}
+	if _, err := c.UseUserToken("reset", UserTokenPasswordReset, now); !errors.Is(err, ErrUserTokenUnusable) {
+		t.Errorf("redeemed twice: err = %v, want ErrUserTokenUnusable", err)
+	}
+
+	create("expiring", UserTokenEmailVerification)
+	if _, err := c.UseUserToken("expiring", UserTokenEmailVerification, now.Add(time.Hour)); !errors.Is(err, ErrUserTokenUnusable) {
+		t.Errorf("redeemed at expiry: err = %v, want ErrUserTokenUnusable", err)
+	}
+	if _, err := c.UseUserToken("expiring", UserTokenEmailVerification, now.Add(time.Hour-time.Second)); err != nil {
+		t.Errorf("redeemed just before expiry: err = %v", err)
+	}
+
+	if _, err := c.UseUserToken("unknown", UserTokenPasswordReset, now); !errors.Is(err, ErrUserTokenUnusable) {
+		t.Errorf("unknown token: err = %v, want ErrUserTokenUnusable", err)
+	}
+}
+
+func TestCreateUserTokenReplacesEarlierTokens(t *testing.T) {
+	c := newTestClient(t)
+	user := newTestUser(t, c, "user@example.com")
+	now := time.Now().UTC()
+
+	for _, params := range []CreateUserTokenParams{
+		{TokenHash: "first", Purpose: UserTokenPasswordReset},
+		{TokenHash: "verify", Purpose: UserTokenEmailVerification},
+		{TokenHash: "second", Purpose: UserTokenPasswordReset},
+	} {
+		params.UserID = user.ID
+		params.ExpiresAt = now.Add(time.Hour)
+		if err := c.CreateUserToken(params); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := c.UseUserToken("first", UserTokenPasswordReset, now); !errors.Is(err, ErrUserTokenUnusable) {
+		t.Errorf("replaced token: err = %v, want ErrUserTokenUnusable", err)
+	}
+	if _, err := c.UseUserToken("second", UserTokenPasswordReset, now); err != nil {
+		t.Errorf("latest token: err = %v", err)
+	}
+	if _, err := c.UseUserToken("verify", UserTokenEmailVerification, now); err != nil {
+		t.Errorf("token for another purpose: err = %v", err)
+	}
+}
@@ -0,0 +1,73 @@
+package database
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// Trickplay describes the seek preview sprite sheets of a video. Each
+// sheet is a Columns x Rows grid of TileWidth x TileHeight frames taken
+// every Interval seconds; the WebVTT file maps time ranges to tiles.
+type Trickplay struct {
+	VTTURL     string   `json:"vtt_url"`
+	SpriteURLs []string `json:"sprite_urls"`
+	Interval   int      `json:"interval"`
+	TileWidth  int      `json:"tile_width"`
+	TileHeight int      `json:"tile_height"`
+	Columns    int      `json:"columns"`
+	Rows       int      `json:"rows"`
+}
+
+func (t *Trickplay) Scan(src any) error {
+	return scanJSON(src, t)
+}
+
+func (t Trickplay) Value() (driver.Value, error) {
+	return valueJSON(t)
+}
+
+// ThumbnailVariant is one size and format of a video's thumbnail.
+type ThumbnailVariant struct {
+	URL      string `json:"url"`
+	MimeType string `json:"mime_type"`
+	Width    int    `json:"width"`
+	Height   int    `json:"height"`
+}
+
+// ThumbnailVariants lists every rendition of the thumbnail, so clients can
+// build a srcset per format.
+type ThumbnailVariants []ThumbnailVariant
+
+func (t *ThumbnailVariants) Scan(src any) error {
+	return scanJSON(src, t)
+}
+
+func (t ThumbnailVariants) Value() (driver.Value, error) {
+	if t == nil {
+		return nil, nil
+	}
+	return valueJSON(t)
+}
+
+// scanJSON decodes a TEXT column holding JSON into dest.
+func scanJSON(src any, dest any) error {
+	switch v := src.(type) {
+	case nil:
+		return nil
+	case string:
+		return json.Unmarshal([]byte(v), dest)
+	case []byte:
+		return json.Unmarshal(v, dest)
+	default:
+		return fmt.Errorf("can't scan %T as JSON", src)
+	}
+}
+
+func valueJSON(v any) (driver.Value, error) {
+	dat, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return string(dat), nil
+}
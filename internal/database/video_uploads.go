@@ -0,0 +1,106 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// VideoUpload tracks a resumable upload in progress. Offset is the number
+// of bytes already persisted to FilePath.
+type VideoUpload struct {
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Offset    int64     `json:"offset"`
+	CreateVideoUploadParams
+}
+
+type CreateVideoUploadParams struct {
+	VideoID  uuid.UUID `json:"video_id"`
+	UserID   uuid.UUID `json:"user_id"`
+	Length   int64     `json:"length"`
+	MimeType string    `json:"mime_type"`
+	FilePath string    `json:"file_path"`
+}
+
+// CreateVideoUpload starts a new upload for the video, replacing any
+// upload that was previously in progress.
+func (c Client) CreateVideoUpload(params CreateVideoUploadParams) (VideoUpload, error) {
+	query := `
+	INSERT OR REPLACE INTO video_uploads (
+		video_id,
+		created_at,
+		updated_at,
+		user_id,
+		upload_length,
+		upload_offset,
+		mime_type,
+		file_path
+	) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, 0, ?, ?)
+	`
+	_, err := c.db.Exec(query, params.VideoID, params.UserID, params.Length, params.MimeType, params.FilePath)
+	if err != nil {
+		return VideoUpload{}, err
+	}
+
+	return c.GetVideoUpload(params.VideoID)
+}
+
+func (c Client) GetVideoUpload(videoID uuid.UUID) (VideoUpload, error) {
+	query := `
+	SELECT
+		video_id,
+		created_at,
+		updated_at,
+		user_id,
+		upload_length,
+		upload_offset,
+		mime_type,
+		file_path
+	FROM video_uploads
+	WHERE video_id = ?
+	`
+
+	var upload VideoUpload
+	err := c.db.QueryRow(query, videoID).Scan(
+		&upload.VideoID,
+		&upload.CreatedAt,
+		&upload.UpdatedAt,
+		&upload.UserID,
+		&upload.Length,
+		&upload.Offset,
+		&upload.MimeType,
+		&upload.FilePath,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return VideoUpload{}, nil
+		}
+		return VideoUpload{}, err
+	}
+
+	return upload, nil
+}
+
+func (c Client) UpdateVideoUploadOffset(videoID uuid.UUID, offset int64) error {
+	query := `
+	UPDATE video_uploads
+	SET
+		upload_offset = ?,
+		updated_at = CURRENT_TIMESTAMP
+	WHERE video_id = ?
+	`
+	_, err := c.db.Exec(query, offset, videoID)
+	return err
+}
+
+func (c Client) DeleteVideoUpload(videoID uuid.UUID) error {
+	query := `
+	DELETE FROM video_uploads
+	WHERE video_id = ?
+	`
+	_, err := c.db.Exec(query, videoID)
+	return err
+}
@@ -8,38 +8,191 @@ import (
 	"github.com/google/uuid"
 )
 
+type VideoStatus string
+
+const (
+	VideoStatusUploaded   VideoStatus = "uploaded"
+	VideoStatusProcessing VideoStatus = "processing"
+	VideoStatusReady      VideoStatus = "ready"
+	VideoStatusFailed     VideoStatus = "failed"
+)
+
+// Visibility controls who can see a video. Unlisted videos can be watched
+// by anyone with the ID, public ones are also listed.
+type Visibility string
+
+const (
+	VisibilityPrivate  Visibility = "private"
+	VisibilityUnlisted Visibility = "unlisted"
+	VisibilityPublic   Visibility = "public"
+)
+
+func (v Visibility) Valid() bool {
+	return v == VisibilityPrivate || v == VisibilityUnlisted || v == VisibilityPublic
+}
+
+// MediaInfo is what ffprobe reported about the uploaded file. Fields are
+// nil until the video has been processed, or when the stream is missing.
+type MediaInfo struct {
+	DurationSeconds *float64 `json:"duration_seconds"`
+	Container       *string  `json:"container"`
+	VideoCodec      *string  `json:"video_codec"`
+	AudioCodec      *string  `json:"audio_codec"`
+	BitRate         *int64   `json:"bit_rate"`
+	FrameRate       *float64 `json:"frame_rate"`
+	Width           *int     `json:"width"`
+	Height          *int     `json:"height"`
+	AudioChannels   *int     `json:"audio_channels"`
+	Rotation        *int     `json:"rotation"`
+}
+
 type Video struct {
-	ID           uuid.UUID `json:"id"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
-	ThumbnailURL *string   `json:"thumbnail_url"`
-	VideoURL     *string   `json:"video_url"`
+	ID            uuid.UUID         `json:"id"`
+	CreatedAt     time.Time         `json:"created_at"`
+	UpdatedAt     time.Time         `json:"updated_at"`
+	ThumbnailURL  *string           `json:"thumbnail_url"`
+	Thumbnails    ThumbnailVariants `json:"thumbnails,omitempty"`
+	BlurHash      *string           `json:"blurhash,omitempty"`
+	LQIP          *string           `json:"lqip,omitempty"`
+	VideoURL      *string           `json:"video_url"`
+	HLSURL        *string           `json:"hls_url"`
+	DashURL       *string           `json:"dash_url"`
+	OriginalURL   *string           `json:"original_url,omitempty"`
+	Trickplay     *Trickplay        `json:"trickplay"`
+	Captions      []CaptionTrack    `json:"captions"`
+	Media         MediaInfo         `json:"media"`
+	Status        VideoStatus       `json:"status,omitempty"`
+	FailureReason *string           `json:"failure_reason,omitempty"`
 	CreateVideoParams
 }
 
 type CreateVideoParams struct {
-	Title       string    `json:"title"`
-	Description string    `json:"description"`
-	UserID      uuid.UUID `json:"user_id"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	Visibility  Visibility `json:"visibility"`
+	UserID      uuid.UUID  `json:"user_id"`
 }
 
-func (c Client) GetVideos(userID uuid.UUID) ([]Video, error) {
-	query := `
-	SELECT
+const videoColumns = `
 		id,
 		created_at,
 		updated_at,
 		title,
 		description,
 		thumbnail_url,
+		thumbnails,
+		blurhash,
+		lqip,
 		video_url,
-		user_id
+		hls_url,
+		dash_url,
+		original_url,
+		trickplay,
+		duration_seconds,
+		container,
+		video_codec,
+		audio_codec,
+		bit_rate,
+		frame_rate,
+		width,
+		height,
+		audio_channels,
+		rotation,
+		COALESCE(status, ''),
+		failure_reason,
+		visibility,
+		user_id`
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanVideo(row scanner) (Video, error) {
+	var video Video
+	err := row.Scan(
+		&video.ID,
+		&video.CreatedAt,
+		&video.UpdatedAt,
+		&video.Title,
+		&video.Description,
+		&video.ThumbnailURL,
+		&video.Thumbnails,
+		&video.BlurHash,
+		&video.LQIP,
+		&video.VideoURL,
+		&video.HLSURL,
+		&video.DashURL,
+		&video.OriginalURL,
+		&video.Trickplay,
+		&video.Media.DurationSeconds,
+		&video.Media.Container,
+		&video.Media.VideoCodec,
+		&video.Media.AudioCodec,
+		&video.Media.BitRate,
+		&video.Media.FrameRate,
+		&video.Media.Width,
+		&video.Media.Height,
+		&video.Media.AudioChannels,
+		&video.Media.Rotation,
+		&video.Status,
+		&video.FailureReason,
+		&video.Visibility,
+		&video.UserID,
+	)
+	return video, err
+}
+
+func (c Client) GetVideos(userID uuid.UUID) ([]Video, error) {
+	return c.FilterVideos(VideoFilter{UserID: userID})
+}
+
+// VideoFilter narrows FilterVideos down. Zero values don't filter.
+type VideoFilter struct {
+	UserID     uuid.UUID
+	Visibility Visibility
+	Status     VideoStatus
+	MinHeight  int
+	MaxHeight  int
+	Limit      int
+	Offset     int
+}
+
+// FilterVideos lists videos, newest first. Resolution bounds apply to the
+// short side so portrait and landscape videos compare alike.
+func (c Client) FilterVideos(filter VideoFilter) ([]Video, error) {
+	query := `
+	SELECT` + videoColumns + `
 	FROM videos
-	WHERE user_id = ?
-	ORDER BY created_at DESC
+	WHERE 1 = 1
 	`
+	args := []any{}
+	if filter.UserID != uuid.Nil {
+		query += " AND user_id = ?"
+		args = append(args, filter.UserID)
+	}
+	if filter.Visibility != "" {
+		query += " AND visibility = ?"
+		args = append(args, filter.Visibility)
+	}
+	if filter.Status != "" {
+		query += " AND status = ?"
+		args = append(args, filter.Status)
+	}
+	if filter.MinHeight > 0 {
+		query += " AND MIN(width, height) >= ?"
+		args = append(args, filter.MinHeight)
+	}
+	if filter.MaxHeight > 0 {
+		query += " AND MIN(width, height) <= ?"
+		args = append(args, filter.MaxHeight)
+	}
+	query += " ORDER BY created_at DESC"
+	if filter.Limit > 0 {
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, filter.Limit, filter.Offset)
+	}
 
-	rows, err := c.db.Query(query, userID)
+	rows, err := c.db.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -47,22 +200,22 @@ func (c Client) GetVideos(userID uuid.UUID) ([]Video, error) {
 
 	videos := []Video{}
 	for rows.Next() {
-		var video Video
-		if err := rows.Scan(
-			&video.ID,
-			&video.CreatedAt,
-			&video.UpdatedAt,
-			&video.Title,
-			&video.Description,
-			&video.ThumbnailURL,
-			&video.VideoURL,
-			&video.UserID,
-		); err != nil {
+		video, err := scanVideo(rows)
+		if err != nil {
 			return nil, err
 		}
 		videos = append(videos, video)
 	}
+	// With a single connection the tracks can only be queried once rows
+	// has released it.
+	rows.Close()
 
+	for i := range videos {
+		videos[i].Captions, err = c.GetCaptionTracks(videos[i].ID)
+		if err != nil {
+			return nil, err
+		}
+	}
 	return videos, nil
 }
 
@@ -75,10 +228,14 @@ func (c Client) CreateVideo(params CreateVideoParams) (Video, error) {
 		updated_at,
 		title,
 		description,
+		visibility,
 		user_id
-	) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?)
+	) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?, ?)
 	`
-	_, err := c.db.Exec(query, id, params.Title, params.Description, params.UserID)
+	if params.Visibility == "" {
+		params.Visibility = VisibilityPrivate
+	}
+	_, err := c.db.Exec(query, id, params.Title, params.Description, params.Visibility, params.UserID)
 	if err != nil {
 		return Video{}, err
 	}
@@ -88,29 +245,12 @@ func (c Client) CreateVideo(params CreateVideoParams) (Video, error) {
 
 func (c Client) GetVideo(id uuid.UUID) (Video, error) {
 	query := `
-	SELECT
-		id,
-		created_at,
-		updated_at,
-		title,
-		description,
-		thumbnail_url,
-		video_url,
-		user_id
+	SELECT` + videoColumns + `
 	FROM videos
 	WHERE id = ?
 	`
 
-	var video Video
-	err := c.db.QueryRow(query, id).Scan(
-		&video.ID,
-		&video.CreatedAt,
-		&video.UpdatedAt,
-		&video.Title,
-		&video.Description,
-		&video.ThumbnailURL,
-		&video.VideoURL,
-		&video.UserID)
+	video, err := scanVideo(c.db.QueryRow(query, id))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return Video{}, nil
@@ -118,6 +258,10 @@ func (c Client) GetVideo(id uuid.UUID) (Video, error) {
 		return Video{}, err
 	}
 
+	video.Captions, err = c.GetCaptionTracks(id)
+	if err != nil {
+		return Video{}, err
+	}
 	return video, nil
 }
 
@@ -125,10 +269,29 @@ func (c Client) UpdateVideo(video Video) error {
 	query := `
 	UPDATE videos
 	SET
+		updated_at = CURRENT_TIMESTAMP,
 		title = ?,
 		description = ?,
 		thumbnail_url = ?,
+		thumbnails = ?,
+		blurhash = ?,
+		lqip = ?,
 		video_url = ?,
+		hls_url = ?,
+		dash_url = ?,
+		original_url = ?,
+		trickplay = ?,
+		duration_seconds = ?,
+		container = ?,
+		video_codec = ?,
+		audio_codec = ?,
+		bit_rate = ?,
+		frame_rate = ?,
+		width = ?,
+		height = ?,
+		audio_channels = ?,
+		rotation = ?,
+		visibility = ?,
 		user_id = ?
 	WHERE id = ?
 	`
@@ -138,13 +301,174 @@ func (c Client) UpdateVideo(video Video) error {
 		video.Title,
 		video.Description,
 		&video.ThumbnailURL,
+		&video.Thumbnails,
+		&video.BlurHash,
+		&video.LQIP,
 		&video.VideoURL,
+		&video.HLSURL,
+		&video.DashURL,
+		&video.OriginalURL,
+		video.Trickplay,
+		video.Media.DurationSeconds,
+		video.Media.Container,
+		video.Media.VideoCodec,
+		video.Media.AudioCodec,
+		video.Media.BitRate,
+		video.Media.FrameRate,
+		video.Media.Width,
+		video.Media.Height,
+		video.Media.AudioChannels,
+		video.Media.Rotation,
+		video.Visibility,
 		video.UserID,
 		video.ID,
 	)
 	return err
 }
 
+// UpdateVideoOutputs stores what processing produced for video: the
+// published file, streaming manifests, original, trickplay and probed
+// media info. Metadata and thumbnails the user may be editing meanwhile
+// are left alone. Objects the new outputs replace are enqueued for
+// deletion in the same transaction.
+func (c Client) UpdateVideoOutputs(video Video, replaced []CreateBlobDeletionParams) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+	UPDATE videos
+	SET
+		updated_at = CURRENT_TIMESTAMP,
+		video_url = ?,
+		hls_url = ?,
+		dash_url = ?,
+		original_url = ?,
+		trickplay = ?,
+		duration_seconds = ?,
+		container = ?,
+		video_codec = ?,
+		audio_codec = ?,
+		bit_rate = ?,
+		frame_rate = ?,
+		width = ?,
+		height = ?,
+		audio_channels = ?,
+		rotation = ?
+	WHERE id = ?
+	`
+	_, err = tx.Exec(
+		query,
+		video.VideoURL,
+		video.HLSURL,
+		video.DashURL,
+		video.OriginalURL,
+		video.Trickplay,
+		video.Media.DurationSeconds,
+		video.Media.Container,
+		video.Media.VideoCodec,
+		video.Media.AudioCodec,
+		video.Media.BitRate,
+		video.Media.FrameRate,
+		video.Media.Width,
+		video.Media.Height,
+		video.Media.AudioChannels,
+		video.Media.Rotation,
+		video.ID,
+	)
+	if err != nil {
+		return err
+	}
+	if err := insertBlobDeletions(tx, replaced); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UpdateVideoDetailsParams holds user editable metadata. Nil fields are
+// left unchanged.
+type UpdateVideoDetailsParams struct {
+	Title       *string     `json:"title"`
+	Description *string     `json:"description"`
+	Visibility  *Visibility `json:"visibility"`
+}
+
+// UpdateVideoDetails changes only the user editable metadata. Processing
+// writes its results through UpdateVideoOutputs and SetVideoStatus, which
+// leave these columns alone, so an edit made mid-job is kept.
+func (c Client) UpdateVideoDetails(id uuid.UUID, params UpdateVideoDetailsParams) (Video, error) {
+	query := `
+	UPDATE videos
+	SET
+		updated_at = CURRENT_TIMESTAMP,
+		title = COALESCE(?, title),
+		description = COALESCE(?, description),
+		visibility = COALESCE(?, visibility)
+	WHERE id = ?
+	`
+	_, err := c.db.Exec(query, params.Title, params.Description, params.Visibility, id)
+	if err != nil {
+		return Video{}, err
+	}
+	return c.GetVideo(id)
+}
+
+// SetVideoThumbnail replaces the thumbnail fields of video, leaving every
+// other column as it is in the database.
+func (c Client) SetVideoThumbnail(video Video) error {
+	query := `
+	UPDATE videos
+	SET
+		updated_at = CURRENT_TIMESTAMP,
+		thumbnail_url = ?,
+		thumbnails = ?,
+		blurhash = ?,
+		lqip = ?
+	WHERE id = ?
+	`
+	_, err := c.db.Exec(query, video.ThumbnailURL, video.Thumbnails, video.BlurHash, video.LQIP, video.ID)
+	return err
+}
+
+// SetVideoThumbnailIfEmpty sets the thumbnail fields of video only when the
+// stored video doesn't have a thumbnail yet, reporting whether it did.
+func (c Client) SetVideoThumbnailIfEmpty(video Video) (bool, error) {
+	query := `
+	UPDATE videos
+	SET
+		thumbnail_url = ?,
+		thumbnails = ?,
+		blurhash = ?,
+		lqip = ?
+	WHERE id = ? AND thumbnail_url IS NULL
+	`
+	res, err := c.db.Exec(query, video.ThumbnailURL, video.Thumbnails, video.BlurHash, video.LQIP, video.ID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// SetVideoStatus writes only the processing state, so a worker moving a
+// video between states can't clobber metadata edited meanwhile.
+func (c Client) SetVideoStatus(id uuid.UUID, status VideoStatus, failureReason *string) error {
+	query := `
+	UPDATE videos
+	SET
+		status = ?,
+		failure_reason = ?
+	WHERE id = ?
+	`
+	_, err := c.db.Exec(query, status, failureReason, id)
+	return err
+}
+
 func (c Client) DeleteVideo(id uuid.UUID) error {
 	query := `
 	DELETE FROM videos
@@ -0,0 +1,97 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUpdateVideoOutputsKeepsConcurrentEdits(t *testing.T) {
+	c := newTestClient(t)
+	stale := newTestVideo(t, c, newTestUser(t, c, "owner@example.com"))
+
+	title := "Renamed while processing"
+	visibility := VisibilityPrivate
+	public := VisibilityPublic
+	if _, err := c.UpdateVideoDetails(stale.ID, UpdateVideoDetailsParams{Visibility: &public}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.UpdateVideoDetails(stale.ID, UpdateVideoDetailsParams{Title: &title, Visibility: &visibility}); err != nil {
+		t.Fatal(err)
+	}
+	thumbnail := "videos/thumb.jpg"
+	if _, err := c.SetVideoThumbnailIfEmpty(Video{ID: stale.ID, ThumbnailURL: &thumbnail}); err != nil {
+		t.Fatal(err)
+	}
+
+	videoKey := "videos/landscape/abc.mp4"
+	height := 720
+	stale.VideoURL = &videoKey
+	stale.Media.Height = &height
+	if err := c.UpdateVideoOutputs(stale, nil); err != nil {
+		t.Fatalf("UpdateVideoOutputs() err = %v", err)
+	}
+
+	got, err := c.GetVideo(stale.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.VideoURL == nil || *got.VideoURL != videoKey || got.Media.Height == nil || *got.Media.Height != height {
+		t.Errorf("outputs not stored: video_url %v, height %v", got.VideoURL, got.Media.Height)
+	}
+	if got.Title != title || got.Visibility != VisibilityPrivate || got.ThumbnailURL == nil {
+		t.Errorf("concurrent edits reverted: title %q, visibility %q, thumbnail %v", got.Title, got.Visibility, got.ThumbnailURL)
+	}
+}
+
+func TestSetVideoThumbnailKeepsConcurrentEdits(t *testing.T) {
+	c := newTestClient(t)
+	stale := newTestVideo(t, c, newTestUser(t, c, "owner@example.com"))
+
+	videoKey := "videos/landscape/abc.mp4"
+	if err := c.UpdateVideoOutputs(Video{ID: stale.ID, VideoURL: &videoKey}, nil); err != nil {
+		t.Fatal(err)
+	}
+	title := "Renamed while uploading"
+	if _, err := c.UpdateVideoDetails(stale.ID, UpdateVideoDetailsParams{Title: &title}); err != nil {
+		t.Fatal(err)
+	}
+
+	thumbnail := "videos/thumbnails/a/640.jpeg"
+	blurHash := "LEHV6nWB2yk8pyo0adR*.7kCMdnj"
+	stale.ThumbnailURL = &thumbnail
+	stale.Thumbnails = ThumbnailVariants{{URL: thumbnail, MimeType: "image/jpeg", Width: 640, Height: 360}}
+	stale.BlurHash = &blurHash
+	if err := c.SetVideoThumbnail(stale); err != nil {
+		t.Fatalf("SetVideoThumbnail() err = %v", err)
+	}
+
+	got, err := c.GetVideo(stale.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ThumbnailURL == nil || *got.ThumbnailURL != thumbnail || len(got.Thumbnails) != 1 || got.BlurHash == nil {
+		t.Errorf("thumbnail not stored: %v, %v, %v", got.ThumbnailURL, got.Thumbnails, got.BlurHash)
+	}
+	if got.Title != title || got.VideoURL == nil || *got.VideoURL != videoKey {
+		t.Errorf("concurrent edits reverted: title %q, video_url %v", got.Title, got.VideoURL)
+	}
+}
+
+func TestUpdateVideoOutputsEnqueuesReplacedBlobs(t *testing.T) {
+	c := newTestClient(t)
+	video := newTestVideo(t, c, newTestUser(t, c, "owner@example.com"))
+
+	videoKey := "videos/new.mp4"
+	video.VideoURL = &videoKey
+	if err := c.UpdateVideoOutputs(video, []CreateBlobDeletionParams{{Key: "landscape/old.mp4"}}); err != nil {
+		t.Fatalf("UpdateVideoOutputs() err = %v", err)
+	}
+
+	deletions, err := c.GetDueBlobDeletions(time.Now().Add(time.Minute), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deletions) != 1 || deletions[0].Key != "landscape/old.mp4" {
+		t.Errorf("deletions = %+v, want the replaced video", deletions)
+	}
+}
@@ -0,0 +1,45 @@
+package mail
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileMailer(t *testing.T) {
+	dir := t.TempDir()
+	mailer, err := NewFileMailer(dir, "Tubely <no-reply@tubely.test>")
+	if err != nil {
+		t.Fatalf("NewFileMailer() err = %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		err := mailer.Send(context.Background(), Message{To: "user@example.com", Subject: "Hello", Body: "line one\nline two\n"})
+		if err != nil {
+			t.Fatalf("Send() err = %v", err)
+		}
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if err != nil || len(files) != 2 {
+		t.Fatalf("got %v message files, err %v, want 2", len(files), err)
+	}
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"From: Tubely <no-reply@tubely.test>\r\n", "To: user@example.com\r\n", "Subject: Hello\r\n", "\r\n\r\nline one\r\nline two\r\n"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("message %q doesn't contain %q", data, want)
+		}
+	}
+}
+
+func TestSendRejectsHeaderInjection(t *testing.T) {
+	mailer := NewLogMailer("no-reply@tubely.test")
+	msg := Message{To: "user@example.com\r\nBcc: victim@example.com", Subject: "Hi", Body: "Body"}
+	if err := mailer.Send(context.Background(), msg); err == nil {
+		t.Error("Send() accepted a recipient with a line break")
+	}
+}
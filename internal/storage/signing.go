@@ -0,0 +1,168 @@
+package storage
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// URLSigner hands out URLs for stored keys that stop working after
+// expiresIn. Clients get these instead of the permanent URLs.
+type URLSigner interface {
+	SignURL(ctx context.Context, key string, expiresIn time.Duration) (string, error)
+}
+
+// PrefixSigner is implemented by signers that can authorize every key
+// under a prefix with a single signature, which is much cheaper than
+// signing each segment of a playlist on its own.
+type PrefixSigner interface {
+	// SignPrefix returns a function producing the signed URL of any key
+	// under prefix, valid for expiresIn.
+	SignPrefix(ctx context.Context, prefix string, expiresIn time.Duration) (func(key string) string, error)
+}
+
+// PublicSigner returns the store's unsigned URLs, for buckets that are
+// meant to be public.
+type PublicSigner struct {
+	store BlobStore
+}
+
+func NewPublicSigner(store BlobStore) *PublicSigner {
+	return &PublicSigner{store: store}
+}
+
+func (s *PublicSigner) SignURL(ctx context.Context, key string, expiresIn time.Duration) (string, error) {
+	return s.store.URL(key), nil
+}
+
+// PresignSigner uses the store's own presigning, e.g. S3 presigned GETs.
+type PresignSigner struct {
+	store BlobStore
+}
+
+func NewPresignSigner(store BlobStore) *PresignSigner {
+	return &PresignSigner{store: store}
+}
+
+func (s *PresignSigner) SignURL(ctx context.Context, key string, expiresIn time.Duration) (string, error) {
+	return s.store.Presign(ctx, key, expiresIn)
+}
+
+// CloudFrontSigner signs URLs of a CloudFront distribution with a canned
+// policy, using a key from one of the distribution's trusted key groups.
+type CloudFrontSigner struct {
+	baseURL    string
+	keyPairID  string
+	privateKey *rsa.PrivateKey
+	now        func() time.Time
+}
+
+// NewCloudFrontSigner parses privateKeyPEM, a PKCS #1 or PKCS #8 RSA key.
+func NewCloudFrontSigner(baseURL, keyPairID string, privateKeyPEM []byte) (*CloudFrontSigner, error) {
+	block, _ := pem.Decode(privateKeyPEM)
+	if block == nil {
+		return nil, errors.New("no PEM data found in CloudFront private key")
+	}
+
+	var privateKey *rsa.PrivateKey
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't parse CloudFront private key: %w", err)
+		}
+		privateKey = key
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't parse CloudFront private key: %w", err)
+		}
+		rsaKey, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("CloudFront private key must be an RSA key")
+		}
+		privateKey = rsaKey
+	default:
+		return nil, fmt.Errorf("unsupported CloudFront private key type %q", block.Type)
+	}
+
+	return &CloudFrontSigner{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		keyPairID:  keyPairID,
+		privateKey: privateKey,
+		now:        time.Now,
+	}, nil
+}
+
+func (s *CloudFrontSigner) SignURL(ctx context.Context, key string, expiresIn time.Duration) (string, error) {
+	resource := s.baseURL + "/" + key
+	expires := s.now().Add(expiresIn).Unix()
+
+	resourceJSON, err := json.Marshal(resource)
+	if err != nil {
+		return "", err
+	}
+	// CloudFront verifies the signature against this exact serialization of
+	// the canned policy.
+	policy := fmt.Sprintf(`{"Statement":[{"Resource":%s,"Condition":{"DateLessThan":{"AWS:EpochTime":%d}}}]}`, resourceJSON, expires)
+	signature, err := s.sign(policy)
+	if err != nil {
+		return "", err
+	}
+
+	query := url.Values{}
+	query.Set("Expires", fmt.Sprintf("%d", expires))
+	query.Set("Signature", signature)
+	query.Set("Key-Pair-Id", s.keyPairID)
+	return resource + "?" + query.Encode(), nil
+}
+
+// SignPrefix signs a custom policy whose resource is a wildcard over
+// prefix, so the same query string is valid for every key below it.
+func (s *CloudFrontSigner) SignPrefix(ctx context.Context, prefix string, expiresIn time.Duration) (func(key string) string, error) {
+	expires := s.now().Add(expiresIn).Unix()
+
+	resourceJSON, err := json.Marshal(s.baseURL + "/" + prefix + "*")
+	if err != nil {
+		return nil, err
+	}
+	policy := fmt.Sprintf(`{"Statement":[{"Resource":%s,"Condition":{"DateLessThan":{"AWS:EpochTime":%d}}}]}`, resourceJSON, expires)
+	signature, err := s.sign(policy)
+	if err != nil {
+		return nil, err
+	}
+
+	query := url.Values{}
+	query.Set("Policy", cloudFrontEncoding.Replace(base64.StdEncoding.EncodeToString([]byte(policy))))
+	query.Set("Signature", signature)
+	query.Set("Key-Pair-Id", s.keyPairID)
+	encoded := query.Encode()
+	return func(key string) string {
+		return s.baseURL + "/" + key + "?" + encoded
+	}, nil
+}
+
+// sign returns the CloudFront encoded signature of policy.
+func (s *CloudFrontSigner) sign(policy string) (string, error) {
+	hashed := sha1.Sum([]byte(policy))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, s.privateKey, crypto.SHA1, hashed[:])
+	if err != nil {
+		return "", fmt.Errorf("couldn't sign CloudFront URL: %w", err)
+	}
+	return cloudFrontEncoding.Replace(base64.StdEncoding.EncodeToString(signature)), nil
+}
+
+// cloudFrontEncoding swaps the base64 characters CloudFront can't take in a
+// query string for the ones it expects instead.
+var cloudFrontEncoding = strings.NewReplacer("+", "-", "=", "_", "/", "~")
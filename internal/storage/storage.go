@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+var ErrNotFound = errors.New("object not found")
+
+// ErrInvalidParts is returned when a multipart upload can't be completed
+// because of the parts the client listed, as opposed to a backend failure.
+var ErrInvalidParts = errors.New("invalid upload parts")
+
+type ObjectInfo struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	ContentType  string    `json:"content_type"`
+	ETag         string    `json:"etag"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+// BlobStore is implemented by every storage backend that videos and
+// thumbnails can be written to. Keys are slash separated paths such as
+// "landscape/<hex>.mp4".
+type BlobStore interface {
+	Put(ctx context.Context, key string, body io.Reader, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, ObjectInfo, error)
+	Delete(ctx context.Context, key string) error
+	Stat(ctx context.Context, key string) (ObjectInfo, error)
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+	Presign(ctx context.Context, key string, expiresIn time.Duration) (string, error)
+	// URL returns the public, unsigned URL for key.
+	URL(key string) string
+}
+
+type CompletedPart struct {
+	PartNumber int32  `json:"part_number"`
+	ETag       string `json:"etag"`
+}
+
+// MultipartStore is implemented by backends that let clients upload parts
+// directly through presigned URLs, bypassing the API server.
+type MultipartStore interface {
+	CreateMultipartUpload(ctx context.Context, key, contentType string) (string, error)
+	PresignUploadPart(ctx context.Context, key, uploadID string, partNumber int32, expiresIn time.Duration) (string, error)
+	CompleteMultipartUpload(ctx context.Context, key, uploadID string, parts []CompletedPart) error
+	AbortMultipartUpload(ctx context.Context, key, uploadID string) error
+}
@@ -0,0 +1,219 @@
+package storage
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+func testBlobStore(t *testing.T, store BlobStore) {
+	ctx := context.Background()
+
+	if err := store.Put(ctx, "landscape/a.mp4", strings.NewReader("video"), "video/mp4"); err != nil {
+		t.Fatalf("Put err: %v", err)
+	}
+	if err := store.Put(ctx, "thumbnails/b.png", strings.NewReader("image"), "image/png"); err != nil {
+		t.Fatalf("Put err: %v", err)
+	}
+
+	body, info, err := store.Get(ctx, "landscape/a.mp4")
+	if err != nil {
+		t.Fatalf("Get err: %v", err)
+	}
+	data, _ := io.ReadAll(body)
+	body.Close()
+	if string(data) != "video" {
+		t.Fatalf("want: video, got: %v", string(data))
+	}
+	if info.Size != 5 || info.ContentType != "video/mp4" {
+		t.Fatalf("unexpected info: %+v", info)
+	}
+
+	infos, err := store.List(ctx, "thumbnails/")
+	if err != nil {
+		t.Fatalf("List err: %v", err)
+	}
+	if len(infos) != 1 || infos[0].Key != "thumbnails/b.png" {
+		t.Fatalf("unexpected list: %+v", infos)
+	}
+
+	if err := store.Delete(ctx, "landscape/a.mp4"); err != nil {
+		t.Fatalf("Delete err: %v", err)
+	}
+	if err := store.Delete(ctx, "landscape/a.mp4"); err != nil {
+		t.Fatalf("second Delete err: %v", err)
+	}
+	if _, err := store.Stat(ctx, "landscape/a.mp4"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("want: ErrNotFound, got: %v", err)
+	}
+
+	if got := store.URL("thumbnails/b.png"); got != "http://localhost:8091/assets/thumbnails/b.png" {
+		t.Fatalf("unexpected URL: %v", got)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	testBlobStore(t, NewMemoryStore("http://localhost:8091/assets/"))
+}
+
+func TestLocalStore(t *testing.T) {
+	store, err := NewLocalStore(t.TempDir(), "http://localhost:8091/assets")
+	if err != nil {
+		t.Fatalf("NewLocalStore err: %v", err)
+	}
+	testBlobStore(t, store)
+}
+
+func TestLocalStore_rejectsEscapingKeys(t *testing.T) {
+	root := t.TempDir()
+	store, err := NewLocalStore(root, "")
+	if err != nil {
+		t.Fatalf("NewLocalStore err: %v", err)
+	}
+	if err := store.Put(context.Background(), "../../outside.txt", strings.NewReader("x"), "text/plain"); err != nil {
+		t.Fatalf("Put err: %v", err)
+	}
+	if _, err := store.Stat(context.Background(), "outside.txt"); err != nil {
+		t.Fatalf("want key cleaned into root, got: %v", err)
+	}
+}
+
+func TestCloudFrontSigner(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	signer, err := NewCloudFrontSigner("https://cdn.example.com/", "K123", keyPEM)
+	if err != nil {
+		t.Fatalf("NewCloudFrontSigner() err = %v", err)
+	}
+	signer.now = func() time.Time { return time.Unix(1700000000, 0) }
+
+	signed, err := signer.SignURL(context.Background(), "videos/a.mp4", time.Hour)
+	if err != nil {
+		t.Fatalf("SignURL() err = %v", err)
+	}
+	u, err := url.Parse(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := u.Query()
+	if query.Get("Expires") != "1700003600" || query.Get("Key-Pair-Id") != "K123" {
+		t.Errorf("unexpected query %v", query)
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(strings.NewReplacer("-", "+", "_", "=", "~", "/").Replace(query.Get("Signature")))
+	if err != nil {
+		t.Fatalf("signature isn't CloudFront base64: %v", err)
+	}
+	policy := `{"Statement":[{"Resource":"https://cdn.example.com/videos/a.mp4","Condition":{"DateLessThan":{"AWS:EpochTime":1700003600}}}]}`
+	hashed := sha1.Sum([]byte(policy))
+	if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA1, hashed[:], signature); err != nil {
+		t.Errorf("signature doesn't verify: %v", err)
+	}
+}
+
+func TestS3AbortMultipartUploadIgnoresNoSuchUpload(t *testing.T) {
+	status := http.StatusNotFound
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete || r.URL.Query().Get("uploadId") != "upload-1" {
+			t.Errorf("unexpected request %v %v", r.Method, r.URL)
+		}
+		w.Header().Set("Content-Type", "application/xml")
+		w.WriteHeader(status)
+		code := "NoSuchUpload"
+		if status != http.StatusNotFound {
+			code = "InternalError"
+		}
+		fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?><Error><Code>%s</Code><Message>failed</Message></Error>`, code)
+	}))
+	defer srv.Close()
+
+	client := s3.New(s3.Options{
+		Region:           "us-east-1",
+		BaseEndpoint:     aws.String(srv.URL),
+		UsePathStyle:     true,
+		Credentials:      aws.AnonymousCredentials{},
+		RetryMaxAttempts: 1,
+	})
+	store := NewS3Store(client, "bucket", "https://cdn.example.com")
+
+	if err := store.AbortMultipartUpload(context.Background(), "videos/a.mp4", "upload-1"); err != nil {
+		t.Errorf("AbortMultipartUpload() of a finished upload err = %v", err)
+	}
+
+	status = http.StatusInternalServerError
+	if err := store.AbortMultipartUpload(context.Background(), "videos/a.mp4", "upload-1"); err == nil {
+		t.Error("AbortMultipartUpload() err = nil, want the S3 error")
+	}
+}
+
+func TestCloudFrontSignerSignPrefix(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	signer, err := NewCloudFrontSigner("https://cdn.example.com", "K123", keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer.now = func() time.Time { return time.Unix(1700000000, 0) }
+
+	signURL, err := signer.SignPrefix(context.Background(), "videos/1/", time.Hour)
+	if err != nil {
+		t.Fatalf("SignPrefix() err = %v", err)
+	}
+	first, err := url.Parse(signURL("videos/1/hls/720p/segment_0000.ts"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := url.Parse(signURL("videos/1/hls/720p/segment_0001.ts"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Path != "/videos/1/hls/720p/segment_0000.ts" || first.RawQuery != second.RawQuery {
+		t.Errorf("want one query for every key, got %v and %v", first, second)
+	}
+
+	decode := strings.NewReplacer("-", "+", "_", "=", "~", "/")
+	query := first.Query()
+	policy, err := base64.StdEncoding.DecodeString(decode.Replace(query.Get("Policy")))
+	if err != nil {
+		t.Fatalf("policy isn't CloudFront base64: %v", err)
+	}
+	want := `{"Statement":[{"Resource":"https://cdn.example.com/videos/1/*","Condition":{"DateLessThan":{"AWS:EpochTime":1700003600}}}]}`
+	if string(policy) != want {
+		t.Errorf("policy = %s, want %s", policy, want)
+	}
+	signature, err := base64.StdEncoding.DecodeString(decode.Replace(query.Get("Signature")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashed := sha1.Sum(policy)
+	if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA1, hashed[:], signature); err != nil {
+		t.Errorf("signature doesn't verify: %v", err)
+	}
+	if query.Get("Key-Pair-Id") != "K123" || query.Has("Expires") {
+		t.Errorf("unexpected query %v", query)
+	}
+}
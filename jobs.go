@@ -0,0 +1,304 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	jobKindProcessVideo = "process_video"
+
+	jobPollInterval = 5 * time.Second
+	jobMaxAttempts  = 3
+)
+
+// jobHandlers maps a job kind to the function that runs it. A returned
+// error makes the job retry until jobMaxAttempts is reached, except for
+// invalid media which won't get any better.
+var jobHandlers = map[string]func(*apiConfig, context.Context, database.Job) error{
+	jobKindProcessVideo: (*apiConfig).runProcessVideoJob,
+}
+
+// processVideoPayload points at the raw upload, either a file in
+// uploadsRoot or an object in the blob store.
+type processVideoPayload struct {
+	FilePath  string `json:"file_path,omitempty"`
+	SourceKey string `json:"source_key,omitempty"`
+	MimeType  string `json:"mime_type"`
+}
+
+func (cfg *apiConfig) enqueueJob(videoID uuid.UUID, kind string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	_, err = cfg.db.CreateJob(database.CreateJobParams{
+		VideoID: videoID,
+		Kind:    kind,
+		Payload: string(data),
+	})
+	if err != nil {
+		return err
+	}
+
+	select {
+	case cfg.jobWake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// enqueueVideoProcessing marks the video as uploaded and queues the
+// transcode/faststart/aspect ratio pipeline for it.
+func (cfg *apiConfig) enqueueVideoProcessing(videoID uuid.UUID, payload processVideoPayload) (database.Video, error) {
+	if err := cfg.db.SetVideoStatus(videoID, database.VideoStatusUploaded, nil); err != nil {
+		return database.Video{}, err
+	}
+	if err := cfg.enqueueJob(videoID, jobKindProcessVideo, payload); err != nil {
+		return database.Video{}, err
+	}
+	return cfg.db.GetVideo(videoID)
+}
+
+func (cfg *apiConfig) startJobWorkers(ctx context.Context, workers int) error {
+	if err := cfg.db.RequeueRunningJobs(); err != nil {
+		return err
+	}
+	for i := 0; i < workers; i++ {
+		go cfg.runJobWorker(ctx)
+	}
+	return nil
+}
+
+func (cfg *apiConfig) runJobWorker(ctx context.Context) {
+	ticker := time.NewTicker(jobPollInterval)
+	defer ticker.Stop()
+
+	for {
+		job, ok, err := cfg.db.ClaimJob(time.Now())
+		if err != nil {
+			log.Printf("ClaimJob returned err: %v", err)
+		}
+		if ok {
+			cfg.runJob(ctx, job)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-cfg.jobWake:
+		}
+	}
+}
+
+func (cfg *apiConfig) runJob(ctx context.Context, job database.Job) {
+	handler, ok := jobHandlers[job.Kind]
+	if !ok {
+		cfg.failJob(ctx, job, fmt.Errorf("unknown job kind %q", job.Kind))
+		return
+	}
+
+	err := handler(cfg, ctx, job)
+	if err == nil {
+		if err := cfg.db.CompleteJob(job.ID); err != nil {
+			log.Printf("CompleteJob returned err: %v", err)
+		}
+		return
+	}
+
+	if job.Attempts >= jobMaxAttempts || isInvalidMedia(err) {
+		cfg.failJob(ctx, job, err)
+		return
+	}
+
+	backoff := jobBackoff(job.Attempts)
+	log.Printf("job %v (%v) attempt %d failed, retrying in %v: %v", job.ID, job.Kind, job.Attempts, backoff, err)
+	if err := cfg.db.RetryJob(job.ID, err.Error(), time.Now().Add(backoff)); err != nil {
+		log.Printf("RetryJob returned err: %v", err)
+	}
+}
+
+// jobBackoff is how long a job waits before its next attempt, growing
+// quadratically from 30s after the first.
+func jobBackoff(attempts int) time.Duration {
+	return time.Duration(attempts*attempts) * 30 * time.Second
+}
+
+func (cfg *apiConfig) failJob(ctx context.Context, job database.Job, jobErr error) {
+	log.Printf("job %v (%v) failed: %v", job.ID, job.Kind, jobErr)
+	if err := cfg.db.FailJob(job.ID, jobErr.Error()); err != nil {
+		log.Printf("FailJob returned err: %v", err)
+	}
+	reason := jobErr.Error()
+	if err := cfg.db.SetVideoStatus(job.VideoID, database.VideoStatusFailed, &reason); err != nil {
+		log.Printf("SetVideoStatus returned err: %v", err)
+	}
+
+	// Nothing retries a failed video, it has to be uploaded again.
+	if job.Kind == jobKindProcessVideo {
+		var payload processVideoPayload
+		if err := json.Unmarshal([]byte(job.Payload), &payload); err == nil {
+			cfg.removeProcessVideoSource(ctx, payload)
+		}
+	}
+}
+
+func (cfg *apiConfig) runProcessVideoJob(ctx context.Context, job database.Job) error {
+	var payload processVideoPayload
+	if err := json.Unmarshal([]byte(job.Payload), &payload); err != nil {
+		return err
+	}
+
+	video, err := cfg.db.GetVideo(job.VideoID)
+	if err != nil {
+		return err
+	}
+	if video.ID == uuid.Nil {
+		// The video was deleted while queued, only the source is left.
+		cfg.removeProcessVideoSource(ctx, payload)
+		return nil
+	}
+
+	if err := cfg.db.SetVideoStatus(video.ID, database.VideoStatusProcessing, nil); err != nil {
+		return err
+	}
+
+	filePath := payload.FilePath
+	if payload.SourceKey != "" {
+		filePath, err = cfg.downloadToTemp(ctx, payload.SourceKey)
+		if err != nil {
+			return fmt.Errorf("couldn't fetch uploaded video: %w", err)
+		}
+		defer os.Remove(filePath)
+	}
+
+	// Direct uploads reach the server for the first time here.
+	probe, err := validateVideoFile(filePath, payload.MimeType)
+	if err != nil {
+		return err
+	}
+
+	// Everything past this point works on an MP4, other containers are
+	// transcoded first.
+	if needsTranscode(payload.MimeType) {
+		transcodedPath, err := transcodeToMP4(ctx, filePath)
+		if err != nil {
+			return fmt.Errorf("couldn't transcode video: %w", err)
+		}
+		defer os.Remove(transcodedPath)
+
+		if err := cfg.keepOriginal(ctx, &video, filePath, payload.MimeType); err != nil {
+			return err
+		}
+		filePath = transcodedPath
+		probe, err = probeMedia(filePath)
+		if err != nil {
+			return err
+		}
+	} else if err := cfg.keepOriginal(ctx, &video, "", ""); err != nil {
+		return err
+	}
+
+	videoKey, err := cfg.publishVideo(ctx, video.ID, job.ID, filePath, "video/mp4")
+	if err != nil {
+		return err
+	}
+	var replaced []database.CreateBlobDeletionParams
+	if previous, ok := cfg.refBlob(video.VideoURL); ok && previous.Key != videoKey {
+		replaced = append(replaced, previous)
+	}
+	video.VideoURL = &videoKey
+	video.Media = probe.toMediaInfo()
+
+	if err := cfg.packageStreams(ctx, &video, filePath); err != nil {
+		return err
+	}
+	if err := cfg.updateHLSCaptions(ctx, video); err != nil {
+		return fmt.Errorf("couldn't add captions to HLS: %w", err)
+	}
+
+	trickplay, err := cfg.generateTrickplay(ctx, video.ID, filePath)
+	if err != nil {
+		return fmt.Errorf("couldn't generate trickplay: %w", err)
+	}
+	video.Trickplay = trickplay
+
+	// video was loaded before processing started, only the columns the
+	// job produces are written back.
+	if err := cfg.db.UpdateVideoOutputs(video, replaced); err != nil {
+		return err
+	}
+	if len(replaced) > 0 {
+		cfg.wakeBlobDeletions()
+	}
+
+	// A missing thumbnail shouldn't fail an otherwise playable video.
+	if err := cfg.generateThumbnail(ctx, video.ID, filePath); err != nil {
+		log.Printf("couldn't generate thumbnail for %v: %v", video.ID, err)
+	}
+
+	if err := cfg.db.SetVideoStatus(video.ID, database.VideoStatusReady, nil); err != nil {
+		return err
+	}
+	cfg.removeProcessVideoSource(ctx, payload)
+	return nil
+}
+
+// packageStreams produces the adaptive streaming output for video: HLS with
+// TS segments by default, or CMAF segments shared by HLS and DASH when
+// DASH is enabled. Output of the other mode is removed.
+func (cfg *apiConfig) packageStreams(ctx context.Context, video *database.Video, filePath string) error {
+	if !cfg.dashEnabled {
+		hlsKey, err := cfg.packageHLS(ctx, video.ID, filePath)
+		if err != nil {
+			return fmt.Errorf("couldn't package HLS: %w", err)
+		}
+		video.HLSURL = &hlsKey
+		video.DashURL = nil
+		return cfg.deletePrefix(ctx, cmafPrefix(video.ID))
+	}
+
+	hlsKey, dashKey, err := cfg.packageCMAF(ctx, video.ID, filePath)
+	if err != nil {
+		return fmt.Errorf("couldn't package DASH: %w", err)
+	}
+	video.HLSURL = &hlsKey
+	video.DashURL = &dashKey
+	return cfg.deletePrefix(ctx, hlsPrefix(video.ID))
+}
+
+// keepOriginal stores the untranscoded upload at filePath when
+// cfg.keepOriginals is set. Without an original, or with the option off, a
+// previously kept original is removed.
+func (cfg *apiConfig) keepOriginal(ctx context.Context, video *database.Video, filePath, mimeType string) error {
+	if filePath == "" || !cfg.keepOriginals {
+		video.OriginalURL = nil
+		return cfg.deletePrefix(ctx, originalPrefix(video.ID))
+	}
+	key, err := cfg.storeOriginal(ctx, video.ID, filePath, mimeType)
+	if err != nil {
+		return fmt.Errorf("couldn't store original: %w", err)
+	}
+	video.OriginalURL = &key
+	return nil
+}
+
+func (cfg *apiConfig) removeProcessVideoSource(ctx context.Context, payload processVideoPayload) {
+	if payload.FilePath != "" {
+		os.Remove(payload.FilePath)
+	}
+	if payload.SourceKey != "" {
+		if err := cfg.store.Delete(ctx, payload.SourceKey); err != nil {
+			log.Printf("couldn't delete source %q: %v", payload.SourceKey, err)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+const jobKindTestFailure = "test_failure"
+
+func TestRunJobRetriesWithBackoff(t *testing.T) {
+	jobHandlers[jobKindTestFailure] = func(*apiConfig, context.Context, database.Job) error {
+		return errors.New("transient")
+	}
+	defer delete(jobHandlers, jobKindTestFailure)
+
+	cfg := newTestConfig(t)
+	user, _ := newTestUser(t, cfg, "owner@example.com")
+	video := newTestVideo(t, cfg, user)
+	if err := cfg.enqueueJob(video.ID, jobKindTestFailure, struct{}{}); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	for attempt := 1; attempt <= jobMaxAttempts; attempt++ {
+		job, ok, err := cfg.db.ClaimJob(now)
+		if err != nil || !ok {
+			t.Fatalf("attempt %d: ClaimJob() = %v, %v", attempt, ok, err)
+		}
+		start := time.Now()
+		cfg.runJob(context.Background(), job)
+
+		job, err = cfg.db.GetJob(job.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if attempt == jobMaxAttempts {
+			if job.Status != database.JobStatusFailed {
+				t.Errorf("status after the last attempt = %v, want failed", job.Status)
+			}
+			break
+		}
+		if job.Status != database.JobStatusQueued || job.LastError == nil || *job.LastError != "transient" {
+			t.Errorf("attempt %d: job = %v (%v), want queued with the error", attempt, job.Status, job.LastError)
+		}
+		if wait := job.RunAt.Sub(start); wait < jobBackoff(attempt)-time.Second || wait > jobBackoff(attempt)+time.Second {
+			t.Errorf("attempt %d: next run in %v, want %v", attempt, wait, jobBackoff(attempt))
+		}
+		now = job.RunAt
+	}
+
+	video, err := cfg.db.GetVideo(video.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if video.Status != database.VideoStatusFailed || video.FailureReason == nil || *video.FailureReason != "transient" {
+		t.Errorf("video = %v (%v), want failed with the job error", video.Status, video.FailureReason)
+	}
+}
+
+func TestJobBackoff(t *testing.T) {
+	for attempts, want := range map[int]time.Duration{1: 30 * time.Second, 2: 2 * time.Minute, 3: 270 * time.Second} {
+		if got := jobBackoff(attempts); got != want {
+			t.Errorf("jobBackoff(%d) = %v, want %v", attempts, got, want)
+		}
+	}
+}
+
+func TestFailJobRemovesSource(t *testing.T) {
+	cfg := newTestConfig(t)
+	user, _ := newTestUser(t, cfg, "owner@example.com")
+	video := newTestVideo(t, cfg, user)
+
+	source := filepath.Join(cfg.uploadsRoot, "source.mp4")
+	if err := os.WriteFile(source, []byte("not a video"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	payload, _ := json.Marshal(processVideoPayload{FilePath: source, MimeType: "video/mp4"})
+	job, err := cfg.db.CreateJob(database.CreateJobParams{VideoID: video.ID, Kind: jobKindProcessVideo, Payload: string(payload)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg.failJob(context.Background(), job, errors.New("unreadable"))
+
+	if _, err := os.Stat(source); !os.IsNotExist(err) {
+		t.Errorf("source of a failed job kept, stat err = %v", err)
+	}
+}
@@ -2,15 +2,20 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
-
-	// "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/mail"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
 
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
@@ -18,15 +23,32 @@ import (
 
 type apiConfig struct {
 	db               database.Client
-	jwtSecret        string
+	jwtKeys          *auth.KeySet
 	platform         string
 	filepathRoot     string
 	assetsRoot       string
-	s3Client         *s3.Client
+	store            storage.BlobStore
+	urlSigner        storage.URLSigner
+	playbackURLTTL   time.Duration
 	s3Bucket         string
 	s3Region         string
 	s3CfDistribution string
 	port             string
+	uploadsRoot      string
+	dashEnabled      bool
+	keepOriginals    bool
+	mailer           mail.Mailer
+	appBaseURL       string
+
+	thumbnailMode           string
+	thumbnailTimestamp      string
+	thumbnailSceneThreshold float64
+	thumbnailFormat         string
+	trickplayInterval       int
+
+	blobDeletionWake chan struct{}
+	jobWake          chan struct{}
+	uploadLocks      *uploadLocks
 }
 
 type thumbnail struct {
@@ -37,13 +59,6 @@ type thumbnail struct {
 // var videoThumbnails = map[uuid.UUID]thumbnail{}
 
 func main() {
-	AWScfg, err := config.LoadDefaultConfig(context.TODO(), config.WithRegion("eu-north-1"))
-	if err != nil {
-		log.Printf("LoadDefaultConfig returned err: %v", err)
-	}
-
-	s3Client := s3.NewFromConfig(AWScfg)
-
 	godotenv.Load(".env")
 
 	pathToDB := os.Getenv("DB_PATH")
@@ -57,8 +72,18 @@ func main() {
 	}
 
 	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		log.Fatal("JWT_SECRET environment variable is not set")
+	jwtKeyDir := os.Getenv("JWT_KEY_DIR")
+	var jwtKeys *auth.KeySet
+	if jwtKeyDir != "" {
+		jwtKeys, err = auth.LoadKeySet(jwtKeyDir, os.Getenv("JWT_SIGNING_KEY_ID"), jwtSecret)
+		if err != nil {
+			log.Fatalf("Couldn't load JWT keys: %v", err)
+		}
+	} else {
+		if jwtSecret == "" {
+			log.Fatal("JWT_SECRET or JWT_KEY_DIR environment variable must be set")
+		}
+		jwtKeys = auth.NewHMACKeySet(jwtSecret)
 	}
 
 	platform := os.Getenv("PLATFORM")
@@ -76,37 +101,219 @@ func main() {
 		log.Fatal("ASSETS_ROOT environment variable is not set")
 	}
 
-	s3Bucket := os.Getenv("S3_BUCKET")
-	if s3Bucket == "" {
-		log.Fatal("S3_BUCKET environment variable is not set")
+	port := os.Getenv("PORT")
+	if port == "" {
+		log.Fatal("PORT environment variable is not set")
 	}
 
-	s3Region := os.Getenv("S3_REGION")
-	if s3Region == "" {
-		log.Fatal("S3_REGION environment variable is not set")
+	uploadsRoot := os.Getenv("UPLOADS_ROOT")
+	if uploadsRoot == "" {
+		uploadsRoot = "./uploads"
 	}
 
-	s3CfDistribution := os.Getenv("S3_CF_DISTRO")
-	if s3CfDistribution == "" {
-		log.Fatal("S3_CF_DISTRO environment variable is not set")
+	processingWorkers := 2
+	if workers := os.Getenv("PROCESSING_WORKERS"); workers != "" {
+		processingWorkers, err = strconv.Atoi(workers)
+		if err != nil || processingWorkers < 1 {
+			log.Fatalf("PROCESSING_WORKERS must be a positive number: %v", workers)
+		}
 	}
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		log.Fatal("PORT environment variable is not set")
+	dashEnabled := os.Getenv("DASH_ENABLED") == "true"
+	keepOriginals := os.Getenv("KEEP_ORIGINAL_UPLOADS") == "true"
+
+	thumbnailMode := os.Getenv("THUMBNAIL_MODE")
+	if thumbnailMode == "" {
+		thumbnailMode = "timestamp"
+	}
+	if thumbnailMode != "timestamp" && thumbnailMode != "scene" {
+		log.Fatalf("THUMBNAIL_MODE must be timestamp or scene: %v", thumbnailMode)
+	}
+
+	thumbnailTimestamp := os.Getenv("THUMBNAIL_TIMESTAMP")
+	if thumbnailTimestamp == "" {
+		thumbnailTimestamp = "00:00:01"
+	}
+
+	thumbnailSceneThreshold := 0.4
+	if threshold := os.Getenv("THUMBNAIL_SCENE_THRESHOLD"); threshold != "" {
+		thumbnailSceneThreshold, err = strconv.ParseFloat(threshold, 64)
+		if err != nil || thumbnailSceneThreshold <= 0 || thumbnailSceneThreshold >= 1 {
+			log.Fatalf("THUMBNAIL_SCENE_THRESHOLD must be between 0 and 1: %v", threshold)
+		}
+	}
+
+	thumbnailFormat := os.Getenv("THUMBNAIL_FORMAT")
+	if thumbnailFormat == "" {
+		thumbnailFormat = "jpeg"
+	}
+	if thumbnailFormat != "jpeg" && thumbnailFormat != "webp" {
+		log.Fatalf("THUMBNAIL_FORMAT must be jpeg or webp: %v", thumbnailFormat)
+	}
+
+	trickplayInterval := 10
+	if interval := os.Getenv("TRICKPLAY_INTERVAL"); interval != "" {
+		trickplayInterval, err = strconv.Atoi(interval)
+		if err != nil || trickplayInterval < 1 {
+			log.Fatalf("TRICKPLAY_INTERVAL must be a positive number of seconds: %v", interval)
+		}
+	}
+
+	storageBackend := os.Getenv("STORAGE_BACKEND")
+	if storageBackend == "" {
+		storageBackend = "s3"
+	}
+
+	var s3Bucket, s3Region, s3CfDistribution string
+	var store storage.BlobStore
+	switch storageBackend {
+	case "s3":
+		s3Bucket = os.Getenv("S3_BUCKET")
+		if s3Bucket == "" {
+			log.Fatal("S3_BUCKET environment variable is not set")
+		}
+
+		s3Region = os.Getenv("S3_REGION")
+		if s3Region == "" {
+			log.Fatal("S3_REGION environment variable is not set")
+		}
+
+		s3CfDistribution = os.Getenv("S3_CF_DISTRO")
+		if s3CfDistribution == "" {
+			log.Fatal("S3_CF_DISTRO environment variable is not set")
+		}
+
+		awsCfg, err := config.LoadDefaultConfig(context.TODO(), config.WithRegion(s3Region))
+		if err != nil {
+			log.Fatalf("Couldn't load AWS config: %v", err)
+		}
+		store = storage.NewS3Store(s3.NewFromConfig(awsCfg), s3Bucket, s3CfDistribution)
+	case "local":
+		store, err = storage.NewLocalStore(assetsRoot, fmt.Sprintf("http://localhost:%v/assets", port))
+		if err != nil {
+			log.Fatalf("Couldn't create local storage: %v", err)
+		}
+	case "memory":
+		store = storage.NewMemoryStore(fmt.Sprintf("http://localhost:%v/assets", port))
+	default:
+		log.Fatalf("Unknown STORAGE_BACKEND: %v", storageBackend)
+	}
+
+	playbackURLTTL := time.Hour
+	if ttl := os.Getenv("PLAYBACK_URL_TTL"); ttl != "" {
+		playbackURLTTL, err = time.ParseDuration(ttl)
+		if err != nil || playbackURLTTL <= 0 {
+			log.Fatalf("PLAYBACK_URL_TTL must be a positive duration: %v", ttl)
+		}
+	}
+
+	// Only S3 can expire a URL. The local and memory stores hand out plain
+	// /assets/ URLs, which would pass for signed ones without being any.
+	playbackSigning := os.Getenv("PLAYBACK_SIGNING")
+	if playbackSigning == "" {
+		playbackSigning = "presign"
+		if storageBackend != "s3" {
+			playbackSigning = "none"
+		}
+	}
+
+	var urlSigner storage.URLSigner
+	switch playbackSigning {
+	case "none":
+		urlSigner = storage.NewPublicSigner(store)
+	case "presign":
+		if storageBackend != "s3" {
+			log.Fatal("PLAYBACK_SIGNING=presign requires STORAGE_BACKEND=s3")
+		}
+		urlSigner = storage.NewPresignSigner(store)
+	case "cloudfront":
+		if storageBackend != "s3" {
+			log.Fatal("PLAYBACK_SIGNING=cloudfront requires STORAGE_BACKEND=s3")
+		}
+		cfKeyPairID := os.Getenv("CF_KEY_PAIR_ID")
+		if cfKeyPairID == "" {
+			log.Fatal("CF_KEY_PAIR_ID environment variable is not set")
+		}
+		cfPrivateKeyPath := os.Getenv("CF_PRIVATE_KEY_PATH")
+		if cfPrivateKeyPath == "" {
+			log.Fatal("CF_PRIVATE_KEY_PATH environment variable is not set")
+		}
+		cfPrivateKey, err := os.ReadFile(cfPrivateKeyPath)
+		if err != nil {
+			log.Fatalf("Couldn't read CloudFront private key: %v", err)
+		}
+		urlSigner, err = storage.NewCloudFrontSigner(s3CfDistribution, cfKeyPairID, cfPrivateKey)
+		if err != nil {
+			log.Fatalf("Couldn't create CloudFront signer: %v", err)
+		}
+	default:
+		log.Fatalf("Unknown PLAYBACK_SIGNING: %v", playbackSigning)
+	}
+
+	mailFrom := os.Getenv("MAIL_FROM")
+	if mailFrom == "" {
+		mailFrom = "Tubely <no-reply@localhost>"
+	}
+	var mailer mail.Mailer
+	switch mailerKind := os.Getenv("MAILER"); mailerKind {
+	case "", "log":
+		mailer = mail.NewLogMailer(mailFrom)
+	case "file":
+		mailDir := os.Getenv("MAIL_DIR")
+		if mailDir == "" {
+			mailDir = "./mail"
+		}
+		mailer, err = mail.NewFileMailer(mailDir, mailFrom)
+		if err != nil {
+			log.Fatalf("Couldn't create mail directory: %v", err)
+		}
+	case "smtp":
+		smtpHost := os.Getenv("SMTP_HOST")
+		if smtpHost == "" {
+			log.Fatal("SMTP_HOST environment variable is not set")
+		}
+		smtpPort := os.Getenv("SMTP_PORT")
+		if smtpPort == "" {
+			smtpPort = "587"
+		}
+		mailer = mail.NewSMTPMailer(smtpHost, smtpPort, os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"), mailFrom)
+	default:
+		log.Fatalf("Unknown MAILER: %v", mailerKind)
+	}
+
+	appBaseURL := strings.TrimSuffix(os.Getenv("APP_BASE_URL"), "/")
+	if appBaseURL == "" {
+		appBaseURL = fmt.Sprintf("http://localhost:%v", port)
 	}
 
 	cfg := apiConfig{
 		db:               db,
-		jwtSecret:        jwtSecret,
+		jwtKeys:          jwtKeys,
 		platform:         platform,
 		filepathRoot:     filepathRoot,
 		assetsRoot:       assetsRoot,
-		s3Client:         s3Client,
+		store:            store,
+		urlSigner:        urlSigner,
+		playbackURLTTL:   playbackURLTTL,
 		s3Bucket:         s3Bucket,
 		s3Region:         s3Region,
 		s3CfDistribution: s3CfDistribution,
 		port:             port,
+		uploadsRoot:      uploadsRoot,
+		dashEnabled:      dashEnabled,
+		keepOriginals:    keepOriginals,
+		mailer:           mailer,
+		appBaseURL:       appBaseURL,
+
+		thumbnailMode:           thumbnailMode,
+		thumbnailTimestamp:      thumbnailTimestamp,
+		thumbnailSceneThreshold: thumbnailSceneThreshold,
+		thumbnailFormat:         thumbnailFormat,
+		trickplayInterval:       trickplayInterval,
+
+		blobDeletionWake: make(chan struct{}, 1),
+		jobWake:          make(chan struct{}, 1),
+		uploadLocks:      newUploadLocks(),
 	}
 
 	err = cfg.ensureAssetsDir()
@@ -114,25 +321,67 @@ func main() {
 		log.Fatalf("Couldn't create assets directory: %v", err)
 	}
 
+	err = os.MkdirAll(uploadsRoot, 0755)
+	if err != nil {
+		log.Fatalf("Couldn't create uploads directory: %v", err)
+	}
+
+	go cfg.runBlobDeletionWorker(context.Background())
+
+	err = cfg.startJobWorkers(context.Background(), processingWorkers)
+	if err != nil {
+		log.Fatalf("Couldn't start job workers: %v", err)
+	}
+
 	mux := http.NewServeMux()
 	appHandler := http.StripPrefix("/app", http.FileServer(http.Dir(filepathRoot)))
 	mux.Handle("/app/", appHandler)
 
-	assetsHandler := http.StripPrefix("/assets", http.FileServer(http.Dir(assetsRoot)))
-	mux.Handle("/assets/", noCacheMiddleware(assetsHandler))
+	mux.Handle("/assets/", http.StripPrefix("/assets", assetsHandler(assetsRoot)))
+
+	mux.HandleFunc("GET /.well-known/jwks.json", cfg.handlerJWKS)
 
 	mux.HandleFunc("POST /api/login", cfg.handlerLogin)
 	mux.HandleFunc("POST /api/refresh", cfg.handlerRefresh)
 	mux.HandleFunc("POST /api/revoke", cfg.handlerRevoke)
+	mux.HandleFunc("GET /api/sessions", cfg.handlerSessionsList)
+	mux.HandleFunc("DELETE /api/sessions/{sessionID}", cfg.handlerSessionRevoke)
+	mux.HandleFunc("POST /api/sessions/revoke_others", cfg.handlerSessionsRevokeOthers)
+	mux.HandleFunc("POST /api/api_keys", cfg.handlerAPIKeyCreate)
+	mux.HandleFunc("GET /api/api_keys", cfg.handlerAPIKeysList)
+	mux.HandleFunc("DELETE /api/api_keys/{keyID}", cfg.handlerAPIKeyRevoke)
 
 	mux.HandleFunc("POST /api/users", cfg.handlerUsersCreate)
+	mux.HandleFunc("POST /api/password_reset", cfg.handlerPasswordResetRequest)
+	mux.HandleFunc("POST /api/password_reset/confirm", cfg.handlerPasswordResetConfirm)
+	mux.HandleFunc("POST /api/email_verification", cfg.handlerEmailVerificationRequest)
+	mux.HandleFunc("POST /api/email_verification/confirm", cfg.handlerEmailVerificationConfirm)
 
 	mux.HandleFunc("POST /api/videos", cfg.handlerVideoMetaCreate)
 	mux.HandleFunc("POST /api/thumbnail_upload/{videoID}", cfg.handlerUploadThumbnail)
 	mux.HandleFunc("POST /api/video_upload/{videoID}", cfg.handlerUploadVideo)
+	mux.HandleFunc("POST /api/video_upload/{videoID}/direct", cfg.handlerDirectUploadStart)
+	mux.HandleFunc("POST /api/video_upload/{videoID}/direct/complete", cfg.handlerDirectUploadComplete)
+	mux.HandleFunc("DELETE /api/video_upload/{videoID}/direct", cfg.handlerDirectUploadAbort)
+	mux.HandleFunc("OPTIONS /api/tus/{videoID}", cfg.handlerTusOptions)
+	mux.HandleFunc("POST /api/tus/{videoID}", cfg.handlerTusCreate)
+	mux.HandleFunc("HEAD /api/tus/{videoID}", cfg.handlerTusHead)
+	mux.HandleFunc("PATCH /api/tus/{videoID}", cfg.handlerTusPatch)
+	mux.HandleFunc("DELETE /api/tus/{videoID}", cfg.handlerTusDelete)
 	mux.HandleFunc("GET /api/videos", cfg.handlerVideosRetrieve)
+	mux.HandleFunc("GET /api/videos/public", cfg.handlerVideosPublic)
 	mux.HandleFunc("GET /api/videos/{videoID}", cfg.handlerVideoGet)
+	mux.HandleFunc("GET /api/videos/{videoID}/events", cfg.handlerVideoEvents)
+	mux.HandleFunc("GET /api/videos/{videoID}/stream/{path...}", cfg.handlerVideoStream)
+	mux.HandleFunc("POST /api/videos/{videoID}/captions", cfg.handlerCaptionsCreate)
+	mux.HandleFunc("GET /api/videos/{videoID}/captions", cfg.handlerCaptionsList)
+	mux.HandleFunc("DELETE /api/videos/{videoID}/captions/{trackID}", cfg.handlerCaptionsDelete)
+	mux.HandleFunc("POST /api/videos/{videoID}/share_links", cfg.handlerShareLinkCreate)
+	mux.HandleFunc("GET /api/videos/{videoID}/share_links", cfg.handlerShareLinksList)
+	mux.HandleFunc("DELETE /api/videos/{videoID}/share_links/{linkID}", cfg.handlerShareLinkRevoke)
+	mux.HandleFunc("POST /api/share/{token}", cfg.handlerShareLinkResolve)
 	// mux.HandleFunc("GET /api/thumbnails/{videoID}", cfg.handlerThumbnailGet)
+	mux.HandleFunc("PATCH /api/videos/{videoID}", cfg.handlerVideoMetaUpdate)
 	mux.HandleFunc("DELETE /api/videos/{videoID}", cfg.handlerVideoMetaDelete)
 
 	mux.HandleFunc("POST /admin/reset", cfg.handlerReset)
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+)
+
+// newTestConfig returns an apiConfig backed by a fresh database and an
+// in-memory store.
+func newTestConfig(t *testing.T) *apiConfig {
+	t.Helper()
+	db, err := database.NewClient(filepath.Join(t.TempDir(), "tubely.db"))
+	if err != nil {
+		t.Fatalf("NewClient() err = %v", err)
+	}
+	store := storage.NewMemoryStore("http://cdn.test")
+	return &apiConfig{
+		db:               db,
+		jwtKeys:          auth.NewHMACKeySet("test-secret"),
+		assetsRoot:       t.TempDir(),
+		uploadsRoot:      t.TempDir(),
+		store:            store,
+		urlSigner:        storage.NewPublicSigner(store),
+		playbackURLTTL:   time.Hour,
+		blobDeletionWake: make(chan struct{}, 1),
+		jobWake:          make(chan struct{}, 1),
+		uploadLocks:      newUploadLocks(),
+	}
+}
+
+// newTestUser creates a user and returns it with an access token.
+func newTestUser(t *testing.T, cfg *apiConfig, email string) (database.User, string) {
+	t.Helper()
+	user, err := cfg.db.CreateUser(database.CreateUserParams{Email: email, Password: "hash"})
+	if err != nil {
+		t.Fatalf("CreateUser() err = %v", err)
+	}
+	token, err := auth.MakeJWT(user.ID, cfg.jwtKeys, time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT() err = %v", err)
+	}
+	return *user, token
+}
+
+func newTestVideo(t *testing.T, cfg *apiConfig, user database.User) database.Video {
+	t.Helper()
+	video, err := cfg.db.CreateVideo(database.CreateVideoParams{Title: "Title", Description: "Description", UserID: user.ID})
+	if err != nil {
+		t.Fatalf("CreateVideo() err = %v", err)
+	}
+	return video
+}
+
+// serveTestRequest routes a single request to handler through a mux, so
+// path values in pattern are available to it.
+func serveTestRequest(pattern string, handler http.HandlerFunc, method, target, authorization string, body io.Reader) *httptest.ResponseRecorder {
+	mux := http.NewServeMux()
+	mux.HandleFunc(pattern, handler)
+
+	req := httptest.NewRequest(method, target, body)
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	return rec
+}
+
+// fakeTool puts an executable shell script called name first on PATH, in
+// place of ffmpeg or ffprobe.
+func fakeTool(t *testing.T, name, script string) {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"+script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+	"github.com/google/uuid"
+)
+
+var (
+	hlsURIAttribute      = regexp.MustCompile(`URI="([^"]*)"`)
+	dashTemplateURLAttrs = regexp.MustCompile(`\b(initialization|media)="([^"]*)"`)
+)
+
+// isManifestKey reports whether key is a file that refers to other files
+// of the video by relative URL: an HLS playlist, a DASH manifest or the
+// trickplay VTT.
+func isManifestKey(key string) bool {
+	switch path.Ext(key) {
+	case ".m3u8", ".mpd":
+		return true
+	case ".vtt":
+		return path.Base(path.Dir(key)) == "trickplay"
+	}
+	return false
+}
+
+// proxiesManifests reports whether manifests have to be served through
+// handlerVideoStream. Players resolve the URIs inside a manifest relative
+// to it and drop its query string, so with signed URLs every child would
+// be requested unsigned.
+func (cfg *apiConfig) proxiesManifests() bool {
+	_, public := cfg.urlSigner.(*storage.PublicSigner)
+	return !public
+}
+
+// streamURL is the URL handlerVideoStream serves key of videoID at. It
+// works for as long as token, a playback token for the video, is valid.
+func (cfg *apiConfig) streamURL(videoID uuid.UUID, key, token string) (string, bool) {
+	rel, ok := strings.CutPrefix(key, videoPrefix(videoID))
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprintf("%v/api/videos/%v/stream/%v?token=%v", cfg.appBaseURL, videoID, rel, token), true
+}
+
+// signedManifestRef is signRef for the HLS and DASH manifests of videoID.
+func (cfg *apiConfig) signedManifestRef(ctx context.Context, videoID uuid.UUID, ref *string) (*string, error) {
+	key, ok := cfg.storedKey(ref)
+	if !ok || !cfg.proxiesManifests() {
+		return cfg.signRef(ctx, ref)
+	}
+	token, err := auth.MakePlaybackToken(videoID, cfg.jwtKeys, cfg.playbackURLTTL)
+	if err != nil {
+		return nil, err
+	}
+	url, ok := cfg.streamURL(videoID, key, token)
+	if !ok {
+		return cfg.signRef(ctx, ref)
+	}
+	return &url, nil
+}
+
+// manifestURIRewriter returns a function that turns a URI found in the
+// manifest at manifestKey into one a player can fetch: child manifests go
+// through handlerVideoStream again, everything else is signed. URIs that
+// don't point below the video's prefix are left alone.
+func (cfg *apiConfig) manifestURIRewriter(ctx context.Context, videoID uuid.UUID, token, manifestKey string) (func(uri string) (string, error), error) {
+	var signPrefix func(key string) string
+	if prefixSigner, ok := cfg.urlSigner.(storage.PrefixSigner); ok {
+		var err error
+		signPrefix, err = prefixSigner.SignPrefix(ctx, videoPrefix(videoID), cfg.playbackURLTTL)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return func(uri string) (string, error) {
+		if uri == "" || strings.Contains(uri, "://") || strings.HasPrefix(uri, "/") {
+			return uri, nil
+		}
+		key := path.Join(path.Dir(manifestKey), uri)
+		if !strings.HasPrefix(key, videoPrefix(videoID)) {
+			return uri, nil
+		}
+
+		switch {
+		case isManifestKey(key):
+			streamURL, _ := cfg.streamURL(videoID, key, token)
+			return streamURL, nil
+		case signPrefix != nil:
+			return signPrefix(key), nil
+		case strings.Contains(key, "$"):
+			// A DASH segment template can't be signed per segment ahead of
+			// time, handlerVideoStream redirects each request instead.
+			streamURL, _ := cfg.streamURL(videoID, key, token)
+			return streamURL, nil
+		default:
+			return cfg.urlSigner.SignURL(ctx, key, cfg.playbackURLTTL)
+		}
+	}, nil
+}
+
+// rewriteHLSPlaylist replaces every URI line and URI attribute of playlist
+// with the result of rewrite.
+func rewriteHLSPlaylist(playlist string, rewrite func(uri string) (string, error)) (string, error) {
+	var out strings.Builder
+	var rewriteErr error
+	for _, line := range strings.SplitAfter(playlist, "\n") {
+		content := strings.TrimRight(line, "\r\n")
+		ending := line[len(content):]
+		switch {
+		case content == "":
+		case strings.HasPrefix(content, "#"):
+			content = hlsURIAttribute.ReplaceAllStringFunc(content, func(attr string) string {
+				uri, err := rewrite(hlsURIAttribute.FindStringSubmatch(attr)[1])
+				if err != nil {
+					rewriteErr = err
+				}
+				return `URI="` + uri + `"`
+			})
+		default:
+			uri, err := rewrite(content)
+			if err != nil {
+				return "", err
+			}
+			content = uri
+		}
+		if rewriteErr != nil {
+			return "", rewriteErr
+		}
+		out.WriteString(content + ending)
+	}
+	return out.String(), nil
+}
+
+// rewriteDASHManifest replaces the segment template URLs of mpd with the
+// result of rewrite.
+func rewriteDASHManifest(mpd string, rewrite func(uri string) (string, error)) (string, error) {
+	var rewriteErr error
+	out := dashTemplateURLAttrs.ReplaceAllStringFunc(mpd, func(attr string) string {
+		match := dashTemplateURLAttrs.FindStringSubmatch(attr)
+		uri, err := rewrite(html.UnescapeString(match[2]))
+		if err != nil {
+			rewriteErr = err
+		}
+		return fmt.Sprintf(`%v="%v"`, match[1], html.EscapeString(uri))
+	})
+	if rewriteErr != nil {
+		return "", rewriteErr
+	}
+	return out, nil
+}
+
+// rewriteTrickplayVTT replaces the image URL of every cue in vtt with the
+// result of rewrite, keeping its #xywh fragment.
+func rewriteTrickplayVTT(vtt string, rewrite func(uri string) (string, error)) (string, error) {
+	var out strings.Builder
+	for _, line := range strings.SplitAfter(vtt, "\n") {
+		content := strings.TrimRight(line, "\r\n")
+		ending := line[len(content):]
+		if content != "" && !strings.HasPrefix(content, "WEBVTT") && !strings.Contains(content, "-->") {
+			uri, fragment, hasFragment := strings.Cut(content, "#")
+			signed, err := rewrite(uri)
+			if err != nil {
+				return "", err
+			}
+			content = signed
+			if hasFragment {
+				content += "#" + fragment
+			}
+		}
+		out.WriteString(content + ending)
+	}
+	return out.String(), nil
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+	"github.com/google/uuid"
+)
+
+func TestRewriteHLSPlaylist(t *testing.T) {
+	playlist := "#EXTM3U\n" +
+		"#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID=\"subs\",NAME=\"English\",URI=\"../captions/en.m3u8\"\n" +
+		"#EXT-X-STREAM-INF:BANDWIDTH=1000,RESOLUTION=640x360\n" +
+		"360p/index.m3u8\n" +
+		"#EXT-X-MAP:URI=\"init-0.m4s\"\n" +
+		"\n" +
+		"https://example.com/external.ts\n"
+	got, err := rewriteHLSPlaylist(playlist, func(uri string) (string, error) {
+		if strings.Contains(uri, "://") {
+			return uri, nil
+		}
+		return "signed:" + uri, nil
+	})
+	if err != nil {
+		t.Fatalf("rewriteHLSPlaylist() err = %v", err)
+	}
+	want := "#EXTM3U\n" +
+		"#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID=\"subs\",NAME=\"English\",URI=\"signed:../captions/en.m3u8\"\n" +
+		"#EXT-X-STREAM-INF:BANDWIDTH=1000,RESOLUTION=640x360\n" +
+		"signed:360p/index.m3u8\n" +
+		"#EXT-X-MAP:URI=\"signed:init-0.m4s\"\n" +
+		"\n" +
+		"https://example.com/external.ts\n"
+	if got != want {
+		t.Errorf("rewriteHLSPlaylist() = %q, want %q", got, want)
+	}
+}
+
+func TestRewriteDASHManifest(t *testing.T) {
+	mpd := `<SegmentTemplate timescale="1000" initialization="init-$RepresentationID$.m4s" media="chunk-$RepresentationID$-$Number%05d$.m4s" startNumber="1">`
+	got, err := rewriteDASHManifest(mpd, func(uri string) (string, error) {
+		return "https://cdn.test/" + uri + "?a=1&b=2", nil
+	})
+	if err != nil {
+		t.Fatalf("rewriteDASHManifest() err = %v", err)
+	}
+	want := `<SegmentTemplate timescale="1000" initialization="https://cdn.test/init-$RepresentationID$.m4s?a=1&amp;b=2" media="https://cdn.test/chunk-$RepresentationID$-$Number%05d$.m4s?a=1&amp;b=2" startNumber="1">`
+	if got != want {
+		t.Errorf("rewriteDASHManifest() = %q, want %q", got, want)
+	}
+}
+
+func TestRewriteTrickplayVTT(t *testing.T) {
+	vtt := buildTrickplayVTT(15, 10, 2, 90)
+	got, err := rewriteTrickplayVTT(vtt, func(uri string) (string, error) {
+		return "https://cdn.test/" + uri + "?sig=1", nil
+	})
+	if err != nil {
+		t.Fatalf("rewriteTrickplayVTT() err = %v", err)
+	}
+	want := "WEBVTT\n" +
+		"\n00:00:00.000 --> 00:00:10.000\nhttps://cdn.test/sprite_000.jpg?sig=1#xywh=0,0,160,90\n" +
+		"\n00:00:10.000 --> 00:00:15.000\nhttps://cdn.test/sprite_000.jpg?sig=1#xywh=160,0,160,90\n"
+	if got != want {
+		t.Errorf("rewriteTrickplayVTT() = %q, want %q", got, want)
+	}
+}
+
+// newStreamTestConfig stores a packaged HLS ladder and DASH manifest for a
+// new video and returns it with a playback token.
+func newStreamTestConfig(t *testing.T, signer func(storage.BlobStore) storage.URLSigner) (*apiConfig, uuid.UUID, string) {
+	t.Helper()
+	cfg := newTestConfig(t)
+	cfg.appBaseURL = "http://tubely.test"
+	cfg.urlSigner = signer(cfg.store)
+
+	videoID := uuid.New()
+	files := map[string]string{
+		"hls/master.m3u8":          "#EXTM3U\n#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID=\"subs\",NAME=\"English\",URI=\"../captions/en.m3u8\"\n#EXT-X-STREAM-INF:BANDWIDTH=1000\n360p/index.m3u8\n",
+		"hls/360p/index.m3u8":      "#EXTM3U\n#EXTINF:6.0,\nsegment_0000.ts\n#EXTINF:6.0,\nsegment_0001.ts\n#EXT-X-ENDLIST\n",
+		"captions/en.m3u8":         "#EXTM3U\n#EXTINF:12.0,\nen.vtt\n#EXT-X-ENDLIST\n",
+		"trickplay/thumbnails.vtt": buildTrickplayVTT(15, 10, 2, 90),
+		"cmaf/manifest.mpd":        `<MPD><SegmentTemplate initialization="init-$RepresentationID$.m4s" media="chunk-$RepresentationID$-$Number%05d$.m4s"/></MPD>`,
+	}
+	for rel, body := range files {
+		key := videoPrefix(videoID) + rel
+		if err := cfg.store.Put(context.Background(), key, strings.NewReader(body), contentTypeForKey(key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	token, err := auth.MakePlaybackToken(videoID, cfg.jwtKeys, cfg.playbackURLTTL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg, videoID, token
+}
+
+func getStream(cfg *apiConfig, videoID uuid.UUID, rel, token string) *httptest.ResponseRecorder {
+	target := fmt.Sprintf("/api/videos/%v/stream/%v?token=%v", videoID, rel, token)
+	return serveTestRequest("GET /api/videos/{videoID}/stream/{path...}", cfg.handlerVideoStream, http.MethodGet, target, "", nil)
+}
+
+func readStream(t *testing.T, cfg *apiConfig, videoID uuid.UUID, rel, token string) string {
+	t.Helper()
+	rec := getStream(cfg, videoID, rel, token)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET %v: status = %d: %s", rel, rec.Code, rec.Body)
+	}
+	return rec.Body.String()
+}
+
+func TestVideoStreamPresignsPlaylists(t *testing.T) {
+	cfg, videoID, token := newStreamTestConfig(t, func(store storage.BlobStore) storage.URLSigner {
+		return storage.NewPresignSigner(store)
+	})
+	streamBase := fmt.Sprintf("http://tubely.test/api/videos/%v/stream/", videoID)
+
+	master := readStream(t, cfg, videoID, "hls/master.m3u8", token)
+	if !strings.Contains(master, "\n"+streamBase+"hls/360p/index.m3u8?token="+token+"\n") {
+		t.Errorf("variant playlist not routed through the stream endpoint:\n%v", master)
+	}
+	if !strings.Contains(master, `URI="`+streamBase+"captions/en.m3u8?token="+token+`"`) {
+		t.Errorf("subtitle playlist not routed through the stream endpoint:\n%v", master)
+	}
+
+	variant := readStream(t, cfg, videoID, "hls/360p/index.m3u8", token)
+	for _, segment := range []string{"segment_0000.ts", "segment_0001.ts"} {
+		if !strings.Contains(variant, "\nhttp://cdn.test/"+videoPrefix(videoID)+"hls/360p/"+segment+"\n") {
+			t.Errorf("segment %v not presigned:\n%v", segment, variant)
+		}
+	}
+
+	mpd := readStream(t, cfg, videoID, "cmaf/manifest.mpd", token)
+	if !strings.Contains(mpd, `media="`+streamBase+`cmaf/chunk-$RepresentationID$-$Number%05d$.m4s?token=`+token+`"`) {
+		t.Errorf("segment template not routed through the stream endpoint:\n%v", mpd)
+	}
+
+	vtt := readStream(t, cfg, videoID, "trickplay/thumbnails.vtt", token)
+	if !strings.Contains(vtt, "\nhttp://cdn.test/"+videoPrefix(videoID)+"trickplay/sprite_000.jpg#xywh=160,0,160,90\n") {
+		t.Errorf("sprite not presigned:\n%v", vtt)
+	}
+
+	for _, rel := range []string{"cmaf/chunk-0-00001.m4s", "captions/en.vtt"} {
+		rec := getStream(cfg, videoID, rel, token)
+		if rec.Code != http.StatusFound || rec.Header().Get("Location") != "http://cdn.test/"+videoPrefix(videoID)+rel {
+			t.Errorf("%v: status = %d, location %q, want a redirect to the presigned URL", rel, rec.Code, rec.Header().Get("Location"))
+		}
+	}
+}
+
+func TestVideoStreamSignsPlaylistsWithOneCloudFrontPolicy(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	cfg, videoID, token := newStreamTestConfig(t, func(storage.BlobStore) storage.URLSigner {
+		signer, err := storage.NewCloudFrontSigner("https://cdn.example.com", "K123", keyPEM)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signer
+	})
+
+	variant := readStream(t, cfg, videoID, "hls/360p/index.m3u8", token)
+	queries := map[string]bool{}
+	for _, line := range strings.Split(variant, "\n") {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		u, err := url.Parse(line)
+		if err != nil || u.Host != "cdn.example.com" || !u.Query().Has("Policy") {
+			t.Errorf("segment %q isn't signed with a CloudFront policy", line)
+			continue
+		}
+		queries[u.RawQuery] = true
+	}
+	if len(queries) != 1 {
+		t.Errorf("want every segment signed by the same policy, got %d signatures", len(queries))
+	}
+
+	mpd := readStream(t, cfg, videoID, "cmaf/manifest.mpd", token)
+	if !strings.Contains(mpd, `media="https://cdn.example.com/`+videoPrefix(videoID)+`cmaf/chunk-$RepresentationID$-$Number%05d$.m4s?Key-Pair-Id=K123&amp;Policy=`) {
+		t.Errorf("segment template not signed with the policy:\n%v", mpd)
+	}
+
+	vtt := readStream(t, cfg, videoID, "trickplay/thumbnails.vtt", token)
+	if !strings.Contains(vtt, "\nhttps://cdn.example.com/"+videoPrefix(videoID)+"trickplay/sprite_000.jpg?Key-Pair-Id=K123&Policy=") ||
+		!strings.Contains(vtt, "#xywh=0,0,160,90\n") {
+		t.Errorf("sprite not signed with the policy:\n%v", vtt)
+	}
+}
+
+func TestVideoStreamRequiresPlaybackToken(t *testing.T) {
+	cfg, videoID, token := newStreamTestConfig(t, func(store storage.BlobStore) storage.URLSigner {
+		return storage.NewPresignSigner(store)
+	})
+	otherToken, err := auth.MakePlaybackToken(uuid.New(), cfg.jwtKeys, cfg.playbackURLTTL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accessToken, err := auth.MakeJWT(uuid.New(), cfg.jwtKeys, cfg.playbackURLTTL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, tt := range map[string]struct {
+		rel, token string
+		want       int
+	}{
+		"missing token":     {"hls/master.m3u8", "", http.StatusUnauthorized},
+		"other video":       {"hls/master.m3u8", otherToken, http.StatusUnauthorized},
+		"access token":      {"hls/master.m3u8", accessToken, http.StatusUnauthorized},
+		"missing manifest":  {"hls/720p/index.m3u8", token, http.StatusNotFound},
+		"outside the video": {"..%2Fother%2Fhls%2Fmaster.m3u8", token, http.StatusNotFound},
+	} {
+		if rec := getStream(cfg, videoID, tt.rel, tt.token); rec.Code != tt.want {
+			t.Errorf("%v: status = %d, want %d", name, rec.Code, tt.want)
+		}
+	}
+}
+
+func TestSignedVideoRoutesManifestsThroughStream(t *testing.T) {
+	cfg, videoID, _ := newStreamTestConfig(t, func(store storage.BlobStore) storage.URLSigner {
+		return storage.NewPresignSigner(store)
+	})
+	hlsKey := videoPrefix(videoID) + "hls/master.m3u8"
+	video, err := cfg.signedVideo(context.Background(), database.Video{
+		ID:        videoID,
+		HLSURL:    &hlsKey,
+		Trickplay: &database.Trickplay{VTTURL: trickplayPrefix(videoID) + "thumbnails.vtt"},
+	})
+	if err != nil {
+		t.Fatalf("signedVideo() err = %v", err)
+	}
+
+	for rel, signed := range map[string]string{
+		"hls/master.m3u8":          *video.HLSURL,
+		"trickplay/thumbnails.vtt": video.Trickplay.VTTURL,
+	} {
+		u, err := url.Parse(signed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := fmt.Sprintf("/api/videos/%v/stream/%v", videoID, rel); u.Path != want {
+			t.Errorf("path = %q, want %q", u.Path, want)
+		}
+		if got, err := auth.ValidatePlaybackToken(u.Query().Get("token"), cfg.jwtKeys); err != nil || got != videoID {
+			t.Errorf("%v token is for %v, %v, want %v", rel, got, err, videoID)
+		}
+	}
+}
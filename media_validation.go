@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"os"
+)
+
+// invalidMediaError is returned when an upload isn't what it claims to be.
+// Its message is safe to show to the client, and jobs failing with it are
+// not retried.
+type invalidMediaError struct {
+	msg string
+}
+
+func (e *invalidMediaError) Error() string {
+	return e.msg
+}
+
+func invalidMedia(format string, args ...any) error {
+	return &invalidMediaError{msg: fmt.Sprintf(format, args...)}
+}
+
+func isInvalidMedia(err error) bool {
+	var invalid *invalidMediaError
+	return errors.As(err, &invalid)
+}
+
+// videoUploadTypes maps the MIME types accepted for video uploads to the
+// container sniffVideoContainer reports for them, which doubles as the file
+// extension.
+var videoUploadTypes = map[string]string{
+	"video/mp4":        "mp4",
+	"video/quicktime":  "mov",
+	"video/webm":       "webm",
+	"video/x-matroska": "mkv",
+}
+
+var allowedVideoCodecs = map[string]bool{
+	"h264":  true,
+	"hevc":  true,
+	"av1":   true,
+	"vp8":   true,
+	"vp9":   true,
+	"mpeg4": true,
+}
+
+var ebmlMagic = []byte{0x1a, 0x45, 0xdf, 0xa3}
+
+// sniffVideoContainer identifies a container from the first bytes of a
+// file: ISO base media files carry an "ftyp" box whose major brand tells
+// MP4 and QuickTime apart, and Matroska files start with an EBML header
+// whose DocType tells WebM and MKV apart.
+func sniffVideoContainer(header []byte) string {
+	if len(header) >= 12 && string(header[4:8]) == "ftyp" {
+		if string(header[8:12]) == "qt  " {
+			return "mov"
+		}
+		return "mp4"
+	}
+	if bytes.HasPrefix(header, ebmlMagic) {
+		switch ebmlDocType(header) {
+		case "webm":
+			return "webm"
+		case "matroska":
+			return "mkv"
+		}
+	}
+	return ""
+}
+
+// ebmlDocType finds the DocType element (ID 0x4282) in an EBML header. Its
+// size is a one byte vint in every file muxers produce in practice.
+func ebmlDocType(header []byte) string {
+	i := bytes.Index(header, []byte{0x42, 0x82})
+	if i < 0 || i+3 > len(header) || header[i+2]&0x80 == 0 {
+		return ""
+	}
+	size := int(header[i+2] & 0x7f)
+	start := i + 3
+	if start+size > len(header) {
+		return ""
+	}
+	return string(bytes.TrimRight(header[start:start+size], "\x00"))
+}
+
+// validateVideoFile checks the file's magic bytes against the declared
+// MIME type and has ffprobe confirm it is a complete, playable video.
+func validateVideoFile(filePath, declaredMimeType string) (mediaProbe, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return mediaProbe{}, err
+	}
+	header := make([]byte, 512)
+	n, err := io.ReadFull(file, header)
+	file.Close()
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return mediaProbe{}, invalidMedia("video file is empty")
+	}
+
+	container := sniffVideoContainer(header[:n])
+	if container == "" {
+		return mediaProbe{}, invalidMedia("file is not a recognized video container")
+	}
+	if videoUploadTypes[declaredMimeType] != container {
+		return mediaProbe{}, invalidMedia("file content is %v but was uploaded as %v", container, declaredMimeType)
+	}
+
+	probe, err := probeMedia(filePath)
+	if errors.Is(err, errUnreadableMedia) {
+		return mediaProbe{}, invalidMedia("couldn't read video, it may be truncated or corrupt")
+	}
+	if err != nil {
+		return mediaProbe{}, err
+	}
+	if !probe.HasVideo {
+		return mediaProbe{}, invalidMedia("file has no video stream")
+	}
+	if !allowedVideoCodecs[probe.VideoCodec] {
+		return mediaProbe{}, invalidMedia("unsupported video codec %v", probe.VideoCodec)
+	}
+	if probe.DurationSeconds <= 0 {
+		return mediaProbe{}, invalidMedia("video has no duration, it may be truncated")
+	}
+	return probe, nil
+}
+
+// validateImage sniffs data and fully decodes it, so truncated images and
+// images labeled with the wrong type are rejected. It returns the actual
+// MIME type.
+func validateImage(data []byte, declaredMimeType string) (string, error) {
+	mimeType := http.DetectContentType(data)
+	if mimeType != "image/jpeg" && mimeType != "image/png" {
+		return "", invalidMedia("file is not a JPEG or PNG image")
+	}
+	if mimeType != declaredMimeType {
+		return "", invalidMedia("file content is %v but was uploaded as %v", mimeType, declaredMimeType)
+	}
+	if _, _, err := image.Decode(bytes.NewReader(data)); err != nil {
+		return "", invalidMedia("couldn't decode image, it may be truncated or corrupt")
+	}
+	return mimeType, nil
+}
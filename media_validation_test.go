@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSniffVideoContainer(t *testing.T) {
+	tests := []struct {
+		name   string
+		header []byte
+		want   string
+	}{
+		{"mp4", []byte("\x00\x00\x00\x20ftypisom\x00\x00\x02\x00"), "mp4"},
+		{"mov", []byte("\x00\x00\x00\x14ftypqt  \x00\x00\x00\x00"), "mov"},
+		{"webm", []byte("\x1a\x45\xdf\xa3\x9f\x42\x86\x81\x01\x42\x82\x84webm\x42\x87"), "webm"},
+		{"mkv", []byte("\x1a\x45\xdf\xa3\xa3\x42\x86\x81\x01\x42\x82\x88matroska\x42\x87"), "mkv"},
+		{"png", []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR"), ""},
+		{"short", []byte("\x00\x00"), ""},
+	}
+	for _, tt := range tests {
+		if got := sniffVideoContainer(tt.header); got != tt.want {
+			t.Errorf("%v: sniffVideoContainer() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestValidateVideoFileProbeFailures(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "upload.mp4")
+	if err := os.WriteFile(filePath, []byte("\x00\x00\x00\x20ftypisom\x00\x00\x02\x00"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		ffprobe     string
+		wantErr     bool
+		wantInvalid bool
+	}{
+		{"playable", `echo '{"streams":[{"codec_type":"video","codec_name":"h264","width":1280,"height":720}],"format":{"duration":"10"}}'`, false, false},
+		{"demuxer error", `echo "moov atom not found" >&2; exit 1`, true, true},
+		{"unparseable output", `echo nonsense`, true, true},
+		{"no video stream", `echo '{"streams":[{"codec_type":"audio","codec_name":"aac"}],"format":{"duration":"10"}}'`, true, true},
+		{"killed", `kill -9 $$`, true, false},
+		{"missing binary", "", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.ffprobe == "" {
+				t.Setenv("PATH", t.TempDir())
+			} else {
+				fakeTool(t, "ffprobe", tt.ffprobe)
+			}
+			_, err := validateVideoFile(filePath, "video/mp4")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validateVideoFile() err = %v, want error %v", err, tt.wantErr)
+			}
+			if isInvalidMedia(err) != tt.wantInvalid {
+				t.Errorf("validateVideoFile() err = %v, want invalid media %v", err, tt.wantInvalid)
+			}
+		})
+	}
+}
+
+func TestValidateImage(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	if mimeType, err := validateImage(data, "image/png"); err != nil || mimeType != "image/png" {
+		t.Errorf("validateImage(png) = %q, %v", mimeType, err)
+	}
+	if _, err := validateImage(data, "image/jpeg"); !isInvalidMedia(err) {
+		t.Errorf("expected mislabeled image to be rejected, got %v", err)
+	}
+	if _, err := validateImage(data[:len(data)/2], "image/png"); !isInvalidMedia(err) {
+		t.Errorf("expected truncated image to be rejected, got %v", err)
+	}
+	if _, err := validateImage([]byte("<html></html>"), "image/png"); !isInvalidMedia(err) {
+		t.Errorf("expected non-image to be rejected, got %v", err)
+	}
+}
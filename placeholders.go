@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/blurhash"
+)
+
+const (
+	blurHashSampleWidth = 32
+	lqipWidth           = 16
+	lqipQuality         = 50
+)
+
+// thumbnailPlaceholders computes a BlurHash and a tiny inline JPEG (LQIP)
+// for the image at sourcePath, for clients to show while the thumbnail
+// loads.
+func thumbnailPlaceholders(sourcePath string) (string, string, error) {
+	file, err := os.Open(sourcePath)
+	if err != nil {
+		return "", "", err
+	}
+	defer file.Close()
+
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return "", "", err
+	}
+
+	xComponents, yComponents := 4, 3
+	if img.Bounds().Dy() > img.Bounds().Dx() {
+		xComponents, yComponents = 3, 4
+	}
+	blurHash, err := blurhash.Encode(downscale(img, blurHashSampleWidth), xComponents, yComponents)
+	if err != nil {
+		return "", "", err
+	}
+
+	var lqip bytes.Buffer
+	if err := jpeg.Encode(&lqip, downscale(img, lqipWidth), &jpeg.Options{Quality: lqipQuality}); err != nil {
+		return "", "", err
+	}
+	return blurHash, "data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(lqip.Bytes()), nil
+}
+
+// downscale box filters img to width pixels wide, keeping the aspect
+// ratio. Images that are already narrower are only copied.
+func downscale(img image.Image, width int) *image.RGBA {
+	bounds := img.Bounds()
+	if bounds.Dx() < width {
+		width = bounds.Dx()
+	}
+	height := max(bounds.Dy()*width/bounds.Dx(), 1)
+
+	out := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0 := bounds.Min.Y + y*bounds.Dy()/height
+		y1 := max(bounds.Min.Y+(y+1)*bounds.Dy()/height, y0+1)
+		for x := 0; x < width; x++ {
+			x0 := bounds.Min.X + x*bounds.Dx()/width
+			x1 := max(bounds.Min.X+(x+1)*bounds.Dx()/width, x0+1)
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := img.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa)
+					n++
+				}
+			}
+			out.Set(x, y, color.RGBA64{uint16(r / n), uint16(g / n), uint16(b / n), uint16(a / n)})
+		}
+	}
+	return out
+}
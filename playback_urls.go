@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// signRef turns a stored asset reference into a URL that expires after
+// cfg.playbackURLTTL. References that aren't in the store are returned as
+// they are.
+func (cfg *apiConfig) signRef(ctx context.Context, ref *string) (*string, error) {
+	key, ok := cfg.storedKey(ref)
+	if !ok {
+		return ref, nil
+	}
+	signed, err := cfg.urlSigner.SignURL(ctx, key, cfg.playbackURLTTL)
+	if err != nil {
+		return nil, err
+	}
+	return &signed, nil
+}
+
+func (cfg *apiConfig) signString(ctx context.Context, ref string) (string, error) {
+	signed, err := cfg.signRef(ctx, &ref)
+	if err != nil {
+		return "", err
+	}
+	return *signed, nil
+}
+
+// signedVideo returns a copy of video with every asset reference signed.
+// The HLS and DASH manifests and the trickplay VTT are served by
+// handlerVideoStream, which signs the URIs inside them as well.
+func (cfg *apiConfig) signedVideo(ctx context.Context, video database.Video) (database.Video, error) {
+	var err error
+	for _, ref := range []**string{&video.ThumbnailURL, &video.VideoURL, &video.OriginalURL} {
+		if *ref, err = cfg.signRef(ctx, *ref); err != nil {
+			return database.Video{}, err
+		}
+	}
+	for _, ref := range []**string{&video.HLSURL, &video.DashURL} {
+		if *ref, err = cfg.signedManifestRef(ctx, video.ID, *ref); err != nil {
+			return database.Video{}, err
+		}
+	}
+
+	if video.Thumbnails != nil {
+		thumbnails := make(database.ThumbnailVariants, len(video.Thumbnails))
+		for i, variant := range video.Thumbnails {
+			if variant.URL, err = cfg.signString(ctx, variant.URL); err != nil {
+				return database.Video{}, err
+			}
+			thumbnails[i] = variant
+		}
+		video.Thumbnails = thumbnails
+	}
+
+	if video.Trickplay != nil {
+		trickplay := *video.Trickplay
+		vttURL, err := cfg.signedManifestRef(ctx, video.ID, &trickplay.VTTURL)
+		if err != nil {
+			return database.Video{}, err
+		}
+		trickplay.VTTURL = *vttURL
+		trickplay.SpriteURLs = make([]string, len(video.Trickplay.SpriteURLs))
+		for i, sprite := range video.Trickplay.SpriteURLs {
+			if trickplay.SpriteURLs[i], err = cfg.signString(ctx, sprite); err != nil {
+				return database.Video{}, err
+			}
+		}
+		video.Trickplay = &trickplay
+	}
+
+	if video.Captions != nil {
+		captions := make([]database.CaptionTrack, len(video.Captions))
+		for i, track := range video.Captions {
+			if captions[i], err = cfg.signedCaptionTrack(ctx, track); err != nil {
+				return database.Video{}, err
+			}
+		}
+		video.Captions = captions
+	}
+	return video, nil
+}
+
+func (cfg *apiConfig) signedVideos(ctx context.Context, videos []database.Video) ([]database.Video, error) {
+	signed := make([]database.Video, 0, len(videos))
+	for _, video := range videos {
+		signedVideo, err := cfg.signedVideo(ctx, video)
+		if err != nil {
+			return nil, err
+		}
+		signed = append(signed, signedVideo)
+	}
+	return signed, nil
+}
+
+func (cfg *apiConfig) signedCaptionTrack(ctx context.Context, track database.CaptionTrack) (database.CaptionTrack, error) {
+	var err error
+	track.URL, err = cfg.signString(ctx, track.URL)
+	return track, err
+}
+
+func (cfg *apiConfig) respondWithVideo(w http.ResponseWriter, r *http.Request, code int, video database.Video) {
+	signed, err := cfg.signedVideo(r.Context(), video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't sign video URLs", err)
+		return
+	}
+	respondWithJSON(w, code, signed)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+)
+
+func TestSignedVideo(t *testing.T) {
+	store := storage.NewMemoryStore("http://cdn.test")
+	cfg := &apiConfig{
+		store:          store,
+		urlSigner:      storage.NewPublicSigner(store),
+		playbackURLTTL: time.Hour,
+	}
+
+	key := "videos/1/landscape/a.mp4"
+	legacy := "http://cdn.test/thumbnails/b.png"
+	external := "https://example.com/c.png"
+	video := database.Video{
+		VideoURL:     &key,
+		ThumbnailURL: &legacy,
+		HLSURL:       &external,
+		Trickplay:    &database.Trickplay{VTTURL: "videos/1/trickplay/thumbnails.vtt", SpriteURLs: []string{"videos/1/trickplay/sprite_000.jpg"}},
+	}
+
+	signed, err := cfg.signedVideo(context.Background(), video)
+	if err != nil {
+		t.Fatalf("signedVideo() err = %v", err)
+	}
+	if got, want := *signed.VideoURL, "http://cdn.test/videos/1/landscape/a.mp4"; got != want {
+		t.Errorf("VideoURL = %q, want %q", got, want)
+	}
+	if got, want := *signed.ThumbnailURL, legacy; got != want {
+		t.Errorf("ThumbnailURL = %q, want %q", got, want)
+	}
+	if got, want := *signed.HLSURL, external; got != want {
+		t.Errorf("HLSURL = %q, want %q", got, want)
+	}
+	if got, want := signed.Trickplay.SpriteURLs[0], "http://cdn.test/videos/1/trickplay/sprite_000.jpg"; got != want {
+		t.Errorf("SpriteURLs[0] = %q, want %q", got, want)
+	}
+	if video.Trickplay.SpriteURLs[0] != "videos/1/trickplay/sprite_000.jpg" {
+		t.Error("signedVideo modified the stored video")
+	}
+}
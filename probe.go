@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// mediaProbe is the subset of ffprobe output the processing pipeline uses.
+// Width and Height are the coded size of the first video stream.
+type mediaProbe struct {
+	Container       string
+	DurationSeconds float64
+	BitRate         int64
+	HasVideo        bool
+	VideoCodec      string
+	Width           int
+	Height          int
+	FrameRate       float64
+	Rotation        int
+	HasAudio        bool
+	AudioCodec      string
+	AudioChannels   int
+}
+
+// errUnreadableMedia is wrapped by probeMedia when ffprobe ran but couldn't
+// make sense of the file, as opposed to failing to run at all.
+var errUnreadableMedia = errors.New("ffprobe couldn't read the file")
+
+type ffprobeOutput struct {
+	Streams []struct {
+		CodecType    string            `json:"codec_type"`
+		CodecName    string            `json:"codec_name"`
+		Width        int               `json:"width"`
+		Height       int               `json:"height"`
+		RFrameRate   string            `json:"r_frame_rate"`
+		AvgFrameRate string            `json:"avg_frame_rate"`
+		Channels     int               `json:"channels"`
+		Tags         map[string]string `json:"tags"`
+		SideDataList []struct {
+			Rotation *float64 `json:"rotation"`
+		} `json:"side_data_list"`
+	} `json:"streams"`
+	Format struct {
+		FormatName string `json:"format_name"`
+		Duration   string `json:"duration"`
+		BitRate    string `json:"bit_rate"`
+	} `json:"format"`
+}
+
+func probeMedia(filePath string) (mediaProbe, error) {
+	cmd := exec.Command("ffprobe", "-v", "error", "-print_format", "json", "-show_streams", "-show_format", filePath)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		// With -v error, ffprobe only writes to stderr to report what it
+		// couldn't demux. A kill signal or a missing binary says nothing
+		// about the file.
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.Exited() && stderr.Len() > 0 {
+			return mediaProbe{}, fmt.Errorf("ffprobe err: %w: %w: %s", errUnreadableMedia, err, lastLine(stderr.String()))
+		}
+		return mediaProbe{}, fmt.Errorf("ffprobe err: %w: %s", err, lastLine(stderr.String()))
+	}
+
+	var output ffprobeOutput
+	if err := json.Unmarshal(stdout.Bytes(), &output); err != nil {
+		return mediaProbe{}, fmt.Errorf("unmarshal failed: %w: %v", errUnreadableMedia, err)
+	}
+	return parseProbe(output), nil
+}
+
+func parseProbe(output ffprobeOutput) mediaProbe {
+	probe := mediaProbe{
+		Container: output.Format.FormatName,
+	}
+	probe.DurationSeconds, _ = strconv.ParseFloat(output.Format.Duration, 64)
+	probe.BitRate, _ = strconv.ParseInt(output.Format.BitRate, 10, 64)
+
+	for _, stream := range output.Streams {
+		switch stream.CodecType {
+		case "video":
+			if probe.HasVideo || stream.Width == 0 || stream.Height == 0 {
+				continue
+			}
+			probe.HasVideo = true
+			probe.VideoCodec = stream.CodecName
+			probe.Width = stream.Width
+			probe.Height = stream.Height
+			probe.FrameRate = parseFrameRate(stream.RFrameRate)
+			if probe.FrameRate == 0 {
+				probe.FrameRate = parseFrameRate(stream.AvgFrameRate)
+			}
+			if rotate, err := strconv.Atoi(stream.Tags["rotate"]); err == nil {
+				probe.Rotation = rotate
+			}
+			for _, sideData := range stream.SideDataList {
+				if sideData.Rotation != nil {
+					probe.Rotation = int(*sideData.Rotation)
+				}
+			}
+			probe.Rotation = ((probe.Rotation % 360) + 360) % 360
+		case "audio":
+			if probe.HasAudio {
+				continue
+			}
+			probe.HasAudio = true
+			probe.AudioCodec = stream.CodecName
+			probe.AudioChannels = stream.Channels
+		}
+	}
+	return probe
+}
+
+// parseFrameRate turns ffprobe's rational "30000/1001" into 29.97.
+func parseFrameRate(rate string) float64 {
+	num, den, ok := strings.Cut(rate, "/")
+	if !ok {
+		f, _ := strconv.ParseFloat(rate, 64)
+		return f
+	}
+	n, err1 := strconv.ParseFloat(num, 64)
+	d, err2 := strconv.ParseFloat(den, 64)
+	if err1 != nil || err2 != nil || d == 0 {
+		return 0
+	}
+	return n / d
+}
+
+// getVideoDimensions returns the displayed size of the first video stream.
+func getVideoDimensions(filePath string) (int, int, error) {
+	probe, err := probeMedia(filePath)
+	if err != nil {
+		return 0, 0, err
+	}
+	if !probe.HasVideo {
+		return 0, 0, fmt.Errorf("no video streams found")
+	}
+	width, height := probe.displaySize()
+	return width, height, nil
+}
+
+// displaySize is the frame size after rotation metadata is applied, which
+// ffmpeg does before any filter runs.
+func (p mediaProbe) displaySize() (int, int) {
+	if p.Rotation == 90 || p.Rotation == 270 {
+		return p.Height, p.Width
+	}
+	return p.Width, p.Height
+}
+
+func (p mediaProbe) toMediaInfo() database.MediaInfo {
+	info := database.MediaInfo{}
+	if p.Container != "" {
+		info.Container = &p.Container
+	}
+	if p.DurationSeconds > 0 {
+		info.DurationSeconds = &p.DurationSeconds
+	}
+	if p.BitRate > 0 {
+		info.BitRate = &p.BitRate
+	}
+	if p.HasVideo {
+		info.VideoCodec = &p.VideoCodec
+		info.Width = &p.Width
+		info.Height = &p.Height
+		info.Rotation = &p.Rotation
+		if p.FrameRate > 0 {
+			info.FrameRate = &p.FrameRate
+		}
+	}
+	if p.HasAudio {
+		info.AudioCodec = &p.AudioCodec
+		info.AudioChannels = &p.AudioChannels
+	}
+	return info
+}
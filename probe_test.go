@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseProbe(t *testing.T) {
+	raw := `{
+		"streams": [
+			{"codec_type": "audio", "codec_name": "aac", "channels": 2},
+			{"codec_type": "video", "codec_name": "h264", "width": 1920, "height": 1080,
+			 "r_frame_rate": "30000/1001", "side_data_list": [{"rotation": -90}]}
+		],
+		"format": {"format_name": "mov,mp4,m4a,3gp,3g2,mj2", "duration": "12.500000", "bit_rate": "4000000"}
+	}`
+	var output ffprobeOutput
+	if err := json.Unmarshal([]byte(raw), &output); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	probe := parseProbe(output)
+	if !probe.HasVideo || probe.VideoCodec != "h264" || probe.Width != 1920 || probe.Height != 1080 {
+		t.Fatalf("unexpected video fields: %+v\n", probe)
+	}
+	if probe.FrameRate < 29.97 || probe.FrameRate > 29.98 {
+		t.Fatalf("want: 29.97, got: %v\n", probe.FrameRate)
+	}
+	if probe.Rotation != 270 {
+		t.Fatalf("want: 270, got: %v\n", probe.Rotation)
+	}
+	if !probe.HasAudio || probe.AudioChannels != 2 {
+		t.Fatalf("unexpected audio fields: %+v\n", probe)
+	}
+	if probe.DurationSeconds != 12.5 || probe.BitRate != 4000000 {
+		t.Fatalf("unexpected format fields: %+v\n", probe)
+	}
+}
+
+func TestDisplaySize(t *testing.T) {
+	tests := []struct {
+		rotation      int
+		width, height int
+	}{
+		{0, 1920, 1080},
+		{90, 1080, 1920},
+		{180, 1920, 1080},
+		{270, 1080, 1920},
+	}
+	for _, tt := range tests {
+		width, height := mediaProbe{Width: 1920, Height: 1080, Rotation: tt.rotation}.displaySize()
+		if width != tt.width || height != tt.height {
+			t.Errorf("rotation %d: want: %dx%d, got: %dx%d", tt.rotation, tt.width, tt.height, width, height)
+		}
+	}
+}
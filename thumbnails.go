@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+var thumbnailExtensions = map[string]string{
+	"image/jpeg": "jpeg",
+	"image/png":  "png",
+	"image/webp": "webp",
+}
+
+// thumbnailWidths are the widths every thumbnail is resized to. Widths
+// above the source's are skipped rather than upscaled.
+var thumbnailWidths = []int{160, 320, 640, 1280}
+
+// thumbnailVariantTypes are the formats each width is encoded in.
+var thumbnailVariantTypes = []string{"image/jpeg", "image/webp"}
+
+func thumbnailPrefix(videoID uuid.UUID) string {
+	return videoPrefix(videoID) + "thumbnails/"
+}
+
+// thumbnailVariantWidths returns the widths to render for a source image
+// that is sourceWidth wide.
+func thumbnailVariantWidths(sourceWidth int) []int {
+	widths := []int{}
+	for _, width := range thumbnailWidths {
+		if width <= sourceWidth {
+			widths = append(widths, width)
+		}
+	}
+	if len(widths) == 0 {
+		widths = append(widths, sourceWidth-sourceWidth%2)
+	}
+	return widths
+}
+
+// storeThumbnailVariants re-encodes the image at sourcePath into every
+// thumbnail width and format under a fresh directory of thumbnailPrefix.
+// Re-encoding drops EXIF and any other metadata of the source. The variant
+// in cfg.thumbnailFormat with the largest width is returned as the primary
+// thumbnail key.
+func (cfg *apiConfig) storeThumbnailVariants(ctx context.Context, videoID uuid.UUID, sourcePath string, width, height int) (string, database.ThumbnailVariants, error) {
+	if width < 2 || height < 2 {
+		return "", nil, fmt.Errorf("thumbnail too small: %dx%d", width, height)
+	}
+
+	outputDir, err := os.MkdirTemp("", "tubely-thumbnails-")
+	if err != nil {
+		return "", nil, err
+	}
+	defer os.RemoveAll(outputDir)
+
+	setKey := make([]byte, 16)
+	rand.Read(setKey)
+	prefix := fmt.Sprintf("%v%v/", thumbnailPrefix(videoID), hex.EncodeToString(setKey))
+
+	primaryType := "image/" + cfg.thumbnailFormat
+	primaryKey := ""
+	variants := database.ThumbnailVariants{}
+	for _, variantWidth := range thumbnailVariantWidths(width) {
+		variantHeight := max(evenScale(height, width, variantWidth), 2)
+		for _, mimeType := range thumbnailVariantTypes {
+			name := fmt.Sprintf("%d.%v", variantWidth, thumbnailExtensions[mimeType])
+			if err := resizeThumbnail(ctx, sourcePath, filepath.Join(outputDir, name), mimeType, variantWidth, variantHeight); err != nil {
+				return "", nil, err
+			}
+			key := prefix + name
+			variants = append(variants, database.ThumbnailVariant{
+				URL:      key,
+				MimeType: mimeType,
+				Width:    variantWidth,
+				Height:   variantHeight,
+			})
+			if mimeType == primaryType {
+				primaryKey = key
+			}
+		}
+	}
+
+	if err := cfg.putDir(ctx, outputDir, prefix); err != nil {
+		return "", nil, fmt.Errorf("couldn't store thumbnails: %w", err)
+	}
+	return primaryKey, variants, nil
+}
+
+func resizeThumbnail(ctx context.Context, sourcePath, outputPath, mimeType string, width, height int) error {
+	args := []string{
+		"-i", sourcePath,
+		"-vf", fmt.Sprintf("scale=%d:%d", width, height),
+		"-map_metadata", "-1",
+		"-frames:v", "1",
+	}
+	if mimeType == "image/webp" {
+		args = append(args, "-c:v", "libwebp", "-quality", "80")
+	} else {
+		args = append(args, "-q:v", "3")
+	}
+	args = append(args, "-y", outputPath)
+
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("ffmpeg resize err: %w: %s", err, lastLine(stderr.String()))
+	}
+	return nil
+}
+
+// deleteOtherThumbnails removes every thumbnail set of the video except the
+// one primaryKey belongs to.
+func (cfg *apiConfig) deleteOtherThumbnails(ctx context.Context, videoID uuid.UUID, primaryKey string) error {
+	keepPrefix := path.Dir(primaryKey) + "/"
+
+	objects, err := cfg.store.List(ctx, thumbnailPrefix(videoID))
+	if err != nil {
+		return err
+	}
+	for _, object := range objects {
+		if strings.HasPrefix(object.Key, keepPrefix) {
+			continue
+		}
+		if err := cfg.store.Delete(ctx, object.Key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// extractThumbnailFrame writes a single representative frame of filePath to
+// outputPath. In "scene" mode the first frame whose scene change score is
+// above cfg.thumbnailSceneThreshold is used, otherwise the frame at
+// cfg.thumbnailTimestamp. Both fall back to the first frame for videos that
+// are too short or too static.
+func (cfg *apiConfig) extractThumbnailFrame(ctx context.Context, filePath, outputPath string) error {
+	var lastErr error
+	for _, args := range cfg.thumbnailFrameAttempts(filePath) {
+		os.Remove(outputPath)
+		args = append(args, "-frames:v", "1", "-q:v", "2", "-y", outputPath)
+		cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			lastErr = fmt.Errorf("ffmpeg thumbnail err: %w: %s", err, lastLine(stderr.String()))
+			continue
+		}
+		// ffmpeg succeeds without writing anything when no frame matched.
+		if stat, err := os.Stat(outputPath); err == nil && stat.Size() > 0 {
+			return nil
+		}
+		lastErr = fmt.Errorf("no frame extracted")
+	}
+	return lastErr
+}
+
+// thumbnailFrameAttempts returns the ffmpeg input arguments for each way of
+// picking a frame, in the order they are tried.
+func (cfg *apiConfig) thumbnailFrameAttempts(filePath string) [][]string {
+	attempts := [][]string{}
+	if cfg.thumbnailMode == "scene" {
+		attempts = append(attempts, []string{
+			"-i", filePath,
+			"-vf", fmt.Sprintf("select='gt(scene,%v)'", cfg.thumbnailSceneThreshold),
+			"-fps_mode", "vfr",
+		})
+	} else {
+		attempts = append(attempts, []string{"-ss", cfg.thumbnailTimestamp, "-i", filePath})
+	}
+	return append(attempts, []string{"-i", filePath})
+}
+
+// generateThumbnail stores a frame of filePath as the video's thumbnail,
+// unless the owner has uploaded one in the meantime.
+func (cfg *apiConfig) generateThumbnail(ctx context.Context, videoID uuid.UUID, filePath string) error {
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		return err
+	}
+	if video.ThumbnailURL != nil {
+		return nil
+	}
+
+	outputDir, err := os.MkdirTemp("", "tubely-thumbnail-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(outputDir)
+
+	outputPath := filepath.Join(outputDir, "frame.png")
+	if err := cfg.extractThumbnailFrame(ctx, filePath, outputPath); err != nil {
+		return err
+	}
+
+	width, height, err := imageDimensions(outputPath)
+	if err != nil {
+		return err
+	}
+	thumbnailKey, variants, err := cfg.storeThumbnailVariants(ctx, videoID, outputPath, width, height)
+	if err != nil {
+		return err
+	}
+	video.ThumbnailURL = &thumbnailKey
+	video.Thumbnails = variants
+	setThumbnailPlaceholders(&video, outputPath)
+
+	set, err := cfg.db.SetVideoThumbnailIfEmpty(video)
+	if err != nil || !set {
+		cfg.deletePrefix(ctx, path.Dir(thumbnailKey)+"/")
+	}
+	return err
+}
+
+func imageDimensions(filePath string) (int, int, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+
+	config, _, err := image.DecodeConfig(file)
+	if err != nil {
+		return 0, 0, err
+	}
+	return config.Width, config.Height, nil
+}
+
+// setThumbnailPlaceholders fills in the BlurHash and LQIP of video from the
+// thumbnail source image. They are optional, so failures are only logged.
+func setThumbnailPlaceholders(video *database.Video, sourcePath string) {
+	blurHash, lqip, err := thumbnailPlaceholders(sourcePath)
+	if err != nil {
+		log.Printf("couldn't compute thumbnail placeholders for %v: %v", video.ID, err)
+		video.BlurHash, video.LQIP = nil, nil
+		return
+	}
+	video.BlurHash, video.LQIP = &blurHash, &lqip
+}
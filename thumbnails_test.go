@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+func TestThumbnailVariantWidths(t *testing.T) {
+	tests := []struct {
+		sourceWidth int
+		want        []int
+	}{
+		{1920, []int{160, 320, 640, 1280}},
+		{1280, []int{160, 320, 640, 1280}},
+		{500, []int{160, 320}},
+		{101, []int{100}},
+	}
+	for _, tt := range tests {
+		if got := thumbnailVariantWidths(tt.sourceWidth); !slices.Equal(got, tt.want) {
+			t.Errorf("thumbnailVariantWidths(%d) = %v, want %v", tt.sourceWidth, got, tt.want)
+		}
+	}
+}
+
+func TestThumbnailFrameAttempts(t *testing.T) {
+	cfg := &apiConfig{thumbnailMode: "timestamp", thumbnailTimestamp: "00:00:03"}
+	attempts := cfg.thumbnailFrameAttempts("in.mp4")
+	want := [][]string{{"-ss", "00:00:03", "-i", "in.mp4"}, {"-i", "in.mp4"}}
+	if !slices.EqualFunc(attempts, want, slices.Equal) {
+		t.Errorf("timestamp attempts = %v, want %v", attempts, want)
+	}
+
+	cfg = &apiConfig{thumbnailMode: "scene", thumbnailSceneThreshold: 0.4}
+	attempts = cfg.thumbnailFrameAttempts("in.mp4")
+	want = [][]string{{"-i", "in.mp4", "-vf", "select='gt(scene,0.4)'", "-fps_mode", "vfr"}, {"-i", "in.mp4"}}
+	if !slices.EqualFunc(attempts, want, slices.Equal) {
+		t.Errorf("scene attempts = %v, want %v", attempts, want)
+	}
+}
+
+// fakeFrameFFmpeg installs an ffmpeg that copies a small PNG to its output,
+// except for scene selection, which matches nothing. Every call is logged
+// to the returned file.
+func fakeFrameFFmpeg(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	frame := filepath.Join(dir, "frame.png")
+	img := image.NewRGBA(image.Rect(0, 0, 64, 36))
+	for x := range 64 {
+		for y := range 36 {
+			img.Set(x, y, color.RGBA{uint8(x * 4), uint8(y * 7), 128, 255})
+		}
+	}
+	file, err := os.Create(frame)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(file, img); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	calls := filepath.Join(dir, "calls.log")
+	fakeTool(t, "ffmpeg", `echo "$*" >> '`+calls+`'
+for last; do :; done
+case "$*" in *select=*) exit 0;; esac
+cp '`+frame+`' "$last"
+`)
+	return calls
+}
+
+func TestExtractThumbnailFrameFallsBackToFirstFrame(t *testing.T) {
+	calls := fakeFrameFFmpeg(t)
+	cfg := &apiConfig{thumbnailMode: "scene", thumbnailSceneThreshold: 0.4}
+	outputPath := filepath.Join(t.TempDir(), "frame.png")
+
+	if err := cfg.extractThumbnailFrame(context.Background(), "in.mp4", outputPath); err != nil {
+		t.Fatalf("extractThumbnailFrame() err = %v", err)
+	}
+	if stat, err := os.Stat(outputPath); err != nil || stat.Size() == 0 {
+		t.Fatalf("no frame written: %v", err)
+	}
+	log, _ := os.ReadFile(calls)
+	lines := strings.Split(strings.TrimSpace(string(log)), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], "select=") || strings.Contains(lines[1], "select=") {
+		t.Errorf("want a scene attempt then the first frame, got:\n%s", log)
+	}
+}
+
+func TestExtractThumbnailFrameFails(t *testing.T) {
+	fakeTool(t, "ffmpeg", `echo "Invalid data found when processing input" >&2; exit 1`)
+	cfg := &apiConfig{thumbnailMode: "timestamp", thumbnailTimestamp: "00:00:01"}
+
+	err := cfg.extractThumbnailFrame(context.Background(), "in.mp4", filepath.Join(t.TempDir(), "frame.png"))
+	if err == nil || !strings.Contains(err.Error(), "Invalid data") {
+		t.Errorf("extractThumbnailFrame() err = %v, want the ffmpeg error", err)
+	}
+}
+
+func TestGenerateThumbnail(t *testing.T) {
+	fakeFrameFFmpeg(t)
+	cfg := newTestConfig(t)
+	cfg.thumbnailMode = "timestamp"
+	cfg.thumbnailTimestamp = "00:00:01"
+	cfg.thumbnailFormat = "jpeg"
+	user, _ := newTestUser(t, cfg, "owner@example.com")
+	video := newTestVideo(t, cfg, user)
+
+	if err := cfg.generateThumbnail(context.Background(), video.ID, "in.mp4"); err != nil {
+		t.Fatalf("generateThumbnail() err = %v", err)
+	}
+	video, err := cfg.db.GetVideo(video.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if video.ThumbnailURL == nil || !strings.HasPrefix(*video.ThumbnailURL, thumbnailPrefix(video.ID)) || !strings.HasSuffix(*video.ThumbnailURL, "/64.jpeg") {
+		t.Errorf("ThumbnailURL = %v, want the 64px JPEG variant", video.ThumbnailURL)
+	}
+	if len(video.Thumbnails) != len(thumbnailVariantTypes) || video.BlurHash == nil || video.LQIP == nil {
+		t.Errorf("thumbnails = %+v, blurhash %v, lqip %v", video.Thumbnails, video.BlurHash, video.LQIP)
+	}
+}
+
+func TestGenerateThumbnailKeepsUploadedThumbnail(t *testing.T) {
+	fakeTool(t, "ffmpeg", `exit 1`)
+	cfg := newTestConfig(t)
+	user, _ := newTestUser(t, cfg, "owner@example.com")
+	video := newTestVideo(t, cfg, user)
+	uploaded := "videos/uploaded.jpeg"
+	if _, err := cfg.db.SetVideoThumbnailIfEmpty(database.Video{ID: video.ID, ThumbnailURL: &uploaded}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cfg.generateThumbnail(context.Background(), video.ID, "in.mp4"); err != nil {
+		t.Fatalf("generateThumbnail() err = %v, want the extraction skipped", err)
+	}
+	video, _ = cfg.db.GetVideo(video.ID)
+	if video.ThumbnailURL == nil || *video.ThumbnailURL != uploaded {
+		t.Errorf("ThumbnailURL = %v, want %q kept", video.ThumbnailURL, uploaded)
+	}
+}
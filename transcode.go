@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/google/uuid"
+)
+
+func originalPrefix(videoID uuid.UUID) string {
+	return videoPrefix(videoID) + "original/"
+}
+
+// needsTranscode reports whether uploads of mimeType are re-encoded to MP4.
+// MP4 uploads are only remuxed for faststart when they are published.
+func needsTranscode(mimeType string) bool {
+	return mimeType != "video/mp4"
+}
+
+// transcodeToMP4 re-encodes filePath to H.264/AAC in an MP4 container next
+// to the original and returns the new path. Rotation metadata is applied to
+// the frames by ffmpeg, so the output is always upright.
+func transcodeToMP4(ctx context.Context, filePath string) (string, error) {
+	outputFilePath := fmt.Sprintf("%v.transcoded.mp4", filePath)
+	cmd := exec.CommandContext(ctx, "ffmpeg",
+		"-i", filePath,
+		"-map", "0:v:0",
+		"-map", "0:a:0?",
+		"-c:v", "libx264",
+		"-preset", "veryfast",
+		"-crf", "20",
+		"-pix_fmt", "yuv420p",
+		"-c:a", "aac",
+		"-b:a", "160k",
+		"-f", "mp4",
+		"-y", outputFilePath,
+	)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		os.Remove(outputFilePath)
+		return "", fmt.Errorf("ffmpeg transcode err: %w: %s", err, lastLine(stderr.String()))
+	}
+	return outputFilePath, nil
+}
+
+// storeOriginal keeps the upload exactly as it was received, replacing any
+// original kept from an earlier upload of the same video.
+func (cfg *apiConfig) storeOriginal(ctx context.Context, videoID uuid.UUID, filePath, mimeType string) (string, error) {
+	if err := cfg.deletePrefix(ctx, originalPrefix(videoID)); err != nil {
+		return "", err
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	randKey := make([]byte, 16)
+	rand.Read(randKey)
+	key := fmt.Sprintf("%v%v.%v", originalPrefix(videoID), hex.EncodeToString(randKey), videoUploadTypes[mimeType])
+	if err := cfg.store.Put(ctx, key, file, mimeType); err != nil {
+		return "", err
+	}
+	return key, nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestNeedsTranscode(t *testing.T) {
+	for mimeType := range videoUploadTypes {
+		if got, want := needsTranscode(mimeType), mimeType != "video/mp4"; got != want {
+			t.Errorf("needsTranscode(%q) = %v, want %v", mimeType, got, want)
+		}
+	}
+}
+
+func TestTranscodeToMP4(t *testing.T) {
+	args := filepath.Join(t.TempDir(), "args")
+	fakeTool(t, "ffmpeg", `echo "$*" > '`+args+`'
+for last; do :; done
+echo transcoded > "$last"
+`)
+	filePath := filepath.Join(t.TempDir(), "upload.mov")
+
+	outputPath, err := transcodeToMP4(context.Background(), filePath)
+	if err != nil {
+		t.Fatalf("transcodeToMP4() err = %v", err)
+	}
+	if outputPath != filePath+".transcoded.mp4" {
+		t.Errorf("output = %q, want it next to the upload", outputPath)
+	}
+	if _, err := os.Stat(outputPath); err != nil {
+		t.Errorf("output not written: %v", err)
+	}
+	got, err := os.ReadFile(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"-i " + filePath, "-c:v libx264", "-pix_fmt yuv420p", "-c:a aac", "-f mp4"} {
+		if !strings.Contains(string(got), want) {
+			t.Errorf("ffmpeg args = %q, want %q", got, want)
+		}
+	}
+}
+
+func TestTranscodeToMP4_ffmpegFailure(t *testing.T) {
+	fakeTool(t, "ffmpeg", `for last; do :; done
+echo partial > "$last"
+echo "first line" >&2; echo "Unknown encoder 'libx264'" >&2; exit 1`)
+	filePath := filepath.Join(t.TempDir(), "upload.webm")
+
+	_, err := transcodeToMP4(context.Background(), filePath)
+	if err == nil || !strings.Contains(err.Error(), "Unknown encoder 'libx264'") {
+		t.Fatalf("want: ffmpeg's last stderr line in the error, got: %v", err)
+	}
+	if _, err := os.Stat(filePath + ".transcoded.mp4"); !os.IsNotExist(err) {
+		t.Errorf("partial output left behind: %v", err)
+	}
+}
+
+func TestKeepOriginal(t *testing.T) {
+	ctx := context.Background()
+	cfg := newTestConfig(t)
+	cfg.keepOriginals = true
+	video := database.Video{ID: uuid.New()}
+	filePath := filepath.Join(t.TempDir(), "upload.mov")
+	if err := os.WriteFile(filePath, []byte("original"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cfg.keepOriginal(ctx, &video, filePath, "video/quicktime"); err != nil {
+		t.Fatalf("keepOriginal() err = %v", err)
+	}
+	if video.OriginalURL == nil || !strings.HasPrefix(*video.OriginalURL, originalPrefix(video.ID)) || !strings.HasSuffix(*video.OriginalURL, ".mov") {
+		t.Fatalf("original = %v, want a .mov under %v", video.OriginalURL, originalPrefix(video.ID))
+	}
+	first := *video.OriginalURL
+	if _, err := cfg.store.Stat(ctx, first); err != nil {
+		t.Errorf("original not stored: %v", err)
+	}
+
+	// Deleting the video removes the original along with everything else
+	// under its prefix.
+	blobs, err := cfg.videoBlobs(video)
+	if err != nil {
+		t.Fatal(err)
+	}
+	covered := false
+	for _, blob := range blobs {
+		if blob.IsPrefix && strings.HasPrefix(first, blob.Key) {
+			covered = true
+		}
+	}
+	if !covered {
+		t.Errorf("videoBlobs() = %+v, want a prefix covering %q", blobs, first)
+	}
+
+	// Uploading again replaces the original.
+	if err := cfg.keepOriginal(ctx, &video, filePath, "video/quicktime"); err != nil {
+		t.Fatal(err)
+	}
+	objects, err := cfg.store.List(ctx, originalPrefix(video.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 1 || objects[0].Key != *video.OriginalURL || objects[0].Key == first {
+		t.Errorf("originals = %+v, want only %q", objects, *video.OriginalURL)
+	}
+
+	// An MP4 upload has no original, the kept one is removed.
+	if err := cfg.keepOriginal(ctx, &video, "", ""); err != nil {
+		t.Fatal(err)
+	}
+	objects, err = cfg.store.List(ctx, originalPrefix(video.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if video.OriginalURL != nil || len(objects) != 0 {
+		t.Errorf("original = %v with %d objects, want none", video.OriginalURL, len(objects))
+	}
+}
+
+func TestKeepOriginal_disabled(t *testing.T) {
+	ctx := context.Background()
+	cfg := newTestConfig(t)
+	video := database.Video{ID: uuid.New()}
+	filePath := filepath.Join(t.TempDir(), "upload.webm")
+	if err := os.WriteFile(filePath, []byte("original"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cfg.keepOriginal(ctx, &video, filePath, "video/webm"); err != nil {
+		t.Fatalf("keepOriginal() err = %v", err)
+	}
+	objects, err := cfg.store.List(ctx, originalPrefix(video.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if video.OriginalURL != nil || len(objects) != 0 {
+		t.Errorf("original = %v with %d objects, want none kept", video.OriginalURL, len(objects))
+	}
+}
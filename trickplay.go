@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	trickplayTileWidth = 160
+	trickplayColumns   = 10
+	trickplayRows      = 10
+)
+
+func trickplayPrefix(videoID uuid.UUID) string {
+	return videoPrefix(videoID) + "trickplay/"
+}
+
+// generateTrickplay renders sprite sheets of frames every
+// cfg.trickplayInterval seconds plus a WebVTT track pointing into them, and
+// stores both under trickplayPrefix.
+func (cfg *apiConfig) generateTrickplay(ctx context.Context, videoID uuid.UUID, filePath string) (*database.Trickplay, error) {
+	probe, err := probeMedia(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if !probe.HasVideo {
+		return nil, fmt.Errorf("no video streams found")
+	}
+	width, height := probe.displaySize()
+	duration := probe.DurationSeconds
+
+	tileHeight := evenScale(height, width, trickplayTileWidth)
+	frames := int(math.Ceil(duration / float64(cfg.trickplayInterval)))
+	if frames < 1 {
+		frames = 1
+	}
+	perSheet := trickplayColumns * trickplayRows
+	sheets := (frames + perSheet - 1) / perSheet
+
+	outputDir, err := os.MkdirTemp("", "tubely-trickplay-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(outputDir)
+
+	cmd := exec.CommandContext(ctx, "ffmpeg",
+		"-i", filePath,
+		"-vf", fmt.Sprintf("fps=1/%d,scale=%d:%d,tile=%dx%d", cfg.trickplayInterval, trickplayTileWidth, tileHeight, trickplayColumns, trickplayRows),
+		"-q:v", "4",
+		"-start_number", "0",
+		filepath.Join(outputDir, "sprite_%03d.jpg"),
+	)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("ffmpeg trickplay err: %w: %s", err, lastLine(stderr.String()))
+	}
+
+	vtt := buildTrickplayVTT(duration, cfg.trickplayInterval, frames, tileHeight)
+	if err := os.WriteFile(filepath.Join(outputDir, "thumbnails.vtt"), []byte(vtt), 0644); err != nil {
+		return nil, err
+	}
+
+	prefix := trickplayPrefix(videoID)
+	if err := cfg.putDir(ctx, outputDir, prefix); err != nil {
+		return nil, fmt.Errorf("couldn't store trickplay output: %w", err)
+	}
+
+	trickplay := &database.Trickplay{
+		VTTURL:     prefix + "thumbnails.vtt",
+		SpriteURLs: make([]string, 0, sheets),
+		Interval:   cfg.trickplayInterval,
+		TileWidth:  trickplayTileWidth,
+		TileHeight: tileHeight,
+		Columns:    trickplayColumns,
+		Rows:       trickplayRows,
+	}
+	for sheet := 0; sheet < sheets; sheet++ {
+		trickplay.SpriteURLs = append(trickplay.SpriteURLs, fmt.Sprintf("%vsprite_%03d.jpg", prefix, sheet))
+	}
+	return trickplay, nil
+}
+
+// buildTrickplayVTT maps each interval to its tile using media fragment
+// (#xywh) URLs relative to the VTT file. handlerVideoStream signs them when
+// playback URLs are signed.
+func buildTrickplayVTT(duration float64, interval, frames, tileHeight int) string {
+	perSheet := trickplayColumns * trickplayRows
+
+	var vtt strings.Builder
+	vtt.WriteString("WEBVTT\n")
+	for frame := 0; frame < frames; frame++ {
+		start := float64(frame * interval)
+		end := math.Min(float64((frame+1)*interval), duration)
+		if end <= start {
+			end = start + float64(interval)
+		}
+		tile := frame % perSheet
+		x := (tile % trickplayColumns) * trickplayTileWidth
+		y := (tile / trickplayColumns) * tileHeight
+
+		fmt.Fprintf(&vtt, "\n%s --> %s\nsprite_%03d.jpg#xywh=%d,%d,%d,%d\n",
+			vttTimestamp(start), vttTimestamp(end), frame/perSheet, x, y, trickplayTileWidth, tileHeight)
+	}
+	return vtt.String()
+}
+
+func vttTimestamp(seconds float64) string {
+	d := time.Duration(seconds * float64(time.Second)).Round(time.Millisecond)
+	return fmt.Sprintf("%02d:%02d:%02d.%03d",
+		int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60, d.Milliseconds()%1000)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestVTTTimestamp(t *testing.T) {
+	if got := vttTimestamp(3725.5); got != "01:02:05.500" {
+		t.Fatalf("want: 01:02:05.500, got: %v\n", got)
+	}
+}
+
+func TestBuildTrickplayVTT(t *testing.T) {
+	vtt := buildTrickplayVTT(1005, 10, 101, 90)
+	if !strings.HasPrefix(vtt, "WEBVTT\n") {
+		t.Fatalf("missing WEBVTT header: %q\n", vtt[:20])
+	}
+	if !strings.Contains(vtt, "00:00:10.000 --> 00:00:20.000\nsprite_000.jpg#xywh=160,0,160,90\n") {
+		t.Fatalf("second cue not found in:\n%v", vtt)
+	}
+	if !strings.Contains(vtt, "00:16:40.000 --> 00:16:45.000\nsprite_001.jpg#xywh=0,0,160,90\n") {
+		t.Fatalf("last cue should start a new sheet and end at the duration:\n%v", vtt)
+	}
+}
+
+func TestGenerateTrickplay_rotatedSource(t *testing.T) {
+	fakeTool(t, "ffprobe", `echo '{"streams":[{"codec_type":"video","width":1920,"height":1080,"side_data_list":[{"rotation":-90}]}],"format":{"duration":"25"}}'`)
+	args := filepath.Join(t.TempDir(), "args")
+	fakeTool(t, "ffmpeg", `echo "$*" > '`+args+`'
+for last; do :; done
+echo sprite > "$(dirname "$last")/sprite_000.jpg"
+`)
+	cfg := newTestConfig(t)
+	cfg.trickplayInterval = 10
+
+	trickplay, err := cfg.generateTrickplay(context.Background(), uuid.New(), "in.mp4")
+	if err != nil {
+		t.Fatalf("generateTrickplay() err = %v", err)
+	}
+	called, _ := os.ReadFile(args)
+	if !strings.Contains(string(called), "scale=160:284,") {
+		t.Errorf("want portrait 160x284 tiles, ffmpeg got: %s", called)
+	}
+	if trickplay.TileHeight != 284 {
+		t.Errorf("TileHeight = %d, want 284", trickplay.TileHeight)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/mail"
+)
+
+const (
+	passwordResetTTL     = time.Hour
+	emailVerificationTTL = 48 * time.Hour
+)
+
+type userTokenEmail struct {
+	purpose database.UserTokenPurpose
+	ttl     time.Duration
+	expiry  string
+	subject string
+	// intro precedes the link, param is the query parameter carrying the
+	// token to the app.
+	intro string
+	param string
+}
+
+var (
+	passwordResetEmail = userTokenEmail{
+		purpose: database.UserTokenPasswordReset,
+		ttl:     passwordResetTTL,
+		expiry:  "1 hour",
+		subject: "Reset your Tubely password",
+		intro:   "Someone asked to reset the password of your Tubely account. If it was you, choose a new password here:",
+		param:   "reset_token",
+	}
+	emailVerificationEmail = userTokenEmail{
+		purpose: database.UserTokenEmailVerification,
+		ttl:     emailVerificationTTL,
+		expiry:  "48 hours",
+		subject: "Verify your email address for Tubely",
+		intro:   "Please confirm that this is your email address:",
+		param:   "verify_token",
+	}
+)
+
+// mailUserToken issues a single-use token for the user and mails it as a
+// link into the app. Earlier tokens for the same purpose stop working.
+func (cfg *apiConfig) mailUserToken(ctx context.Context, user database.User, email userTokenEmail) error {
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		return err
+	}
+	err = cfg.db.CreateUserToken(database.CreateUserTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    user.ID,
+		Purpose:   email.purpose,
+		ExpiresAt: time.Now().Add(email.ttl),
+	})
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%v/app/?%v=%v", cfg.appBaseURL, email.param, url.QueryEscape(token))
+	body := fmt.Sprintf("%v\n\n%v\n\nThe link expires in %v and works once. If you didn't ask for this email, you can ignore it.\n",
+		email.intro, link, email.expiry)
+	return cfg.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: email.subject,
+		Body:    body,
+	})
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"io/fs"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+var assetContentTypes = map[string]string{
+	".m3u8": "application/vnd.apple.mpegurl",
+	".ts":   "video/mp2t",
+	".m4s":  "video/iso.segment",
+	".mpd":  "application/dash+xml",
+	".vtt":  "text/vtt",
+}
+
+func contentTypeForKey(key string) string {
+	ext := path.Ext(key)
+	if contentType, ok := assetContentTypes[ext]; ok {
+		return contentType
+	}
+	if contentType := mime.TypeByExtension(ext); contentType != "" {
+		return contentType
+	}
+	return "application/octet-stream"
+}
+
+// deletePrefix removes every stored object under prefix.
+func (cfg *apiConfig) deletePrefix(ctx context.Context, prefix string) error {
+	objects, err := cfg.store.List(ctx, prefix)
+	if err != nil {
+		return err
+	}
+	for _, object := range objects {
+		if err := cfg.store.Delete(ctx, object.Key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// putDir uploads every file below dir, keeping its relative path under
+// prefix. Any objects previously stored under prefix are removed first so
+// renditions from an earlier upload don't linger.
+func (cfg *apiConfig) putDir(ctx context.Context, dir, prefix string) error {
+	if err := cfg.deletePrefix(ctx, prefix); err != nil {
+		return err
+	}
+
+	return filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		file, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		key := prefix + filepath.ToSlash(rel)
+		return cfg.store.Put(ctx, key, file, contentTypeForKey(key))
+	})
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// authorizeVideoOwner loads the {videoID} path value and checks that the
+// request is authenticated as its owner, writing the error response itself
+// on failure. Owner actions need the videos:write scope.
+func (cfg *apiConfig) authorizeVideoOwner(w http.ResponseWriter, r *http.Request) (database.Video, bool) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid ID", err)
+		return database.Video{}, false
+	}
+
+	userID, ok := cfg.authenticateUser(w, r, auth.ScopeVideosWrite)
+	if !ok {
+		return database.Video{}, false
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil || video.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "videoID doesn't exist", err)
+		return database.Video{}, false
+	}
+
+	if userID != video.UserID {
+		respondWithError(w, http.StatusUnauthorized, "wrong user", nil)
+		return database.Video{}, false
+	}
+
+	return video, true
+}
+
+// authorizeVideoViewer loads the {videoID} path value for reading. Private
+// videos are only visible to their owner; to everyone else they look like
+// they don't exist.
+func (cfg *apiConfig) authorizeVideoViewer(w http.ResponseWriter, r *http.Request) (database.Video, bool) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return database.Video{}, false
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return database.Video{}, false
+	}
+	if video.ID == uuid.Nil || !cfg.canViewVideo(r, video) {
+		respondWithError(w, http.StatusNotFound, "Video not found", nil)
+		return database.Video{}, false
+	}
+
+	return video, true
+}
+
+func (cfg *apiConfig) canViewVideo(r *http.Request, video database.Video) bool {
+	if video.Visibility != database.VisibilityPrivate {
+		return true
+	}
+	userID, err := cfg.requestUser(r, auth.ScopeVideosRead)
+	return err == nil && userID == video.UserID
+}